@@ -2,11 +2,15 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/MiG-21/go-sso/internal"
 	"github.com/MiG-21/go-sso/internal/dao"
 	"github.com/MiG-21/go-sso/internal/event"
+	"github.com/MiG-21/go-sso/internal/logout"
 	"github.com/MiG-21/go-sso/internal/mail"
+	"github.com/MiG-21/go-sso/internal/passkey"
+	"github.com/MiG-21/go-sso/internal/ratelimit"
 	"github.com/MiG-21/go-sso/internal/web"
 	"go.uber.org/dig"
 )
@@ -16,15 +20,25 @@ import (
 // @description go-sso
 // @BasePath /v1
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	c := dig.New()
 
 	wrapError(c.Provide(internal.SetupValidator))
 	wrapError(c.Provide(internal.SetupConfig))
 	wrapError(c.Provide(event.SetupEventService))
 	wrapError(c.Provide(internal.SetupLogger))
-	wrapError(c.Provide(dao.SetupMysqlDao))
+	wrapError(c.Provide(dao.SetupDao))
+	wrapError(c.Provide(passkey.SetupService))
+	wrapError(c.Provide(ratelimit.SetupLimiter))
 	wrapError(c.Provide(web.SetupServer))
 	wrapError(c.Provide(mail.SetupService))
+	wrapError(c.Provide(logout.SetupService))
 
 	if err := c.Invoke(internal.Bootstrap); err != nil {
 		log.Fatal(err)
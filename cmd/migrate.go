@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/dao"
+)
+
+const migrateUsage = "usage: go-sso migrate [up | down [steps] | status]"
+
+// migrate runs the migrate command, it applies or reverts the schema migrations of the configured database.
+func migrate(args []string) error {
+	sr := internal.SetupConfig()
+	if sr.Error != nil {
+		return sr.Error
+	}
+	config := sr.Config
+	if config.Database.Driver == dao.DriverMemory {
+		return errors.New("the memory driver has no schema to migrate")
+	}
+
+	db, err := dao.OpenDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := dao.NewMigrator(db, config.Database.Driver)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch {
+	case command == "up" && len(args) <= 1:
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied %s\n", migration)
+		}
+		return err
+	case command == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %s\n", migration)
+		}
+		return err
+	case command == "status" && len(args) == 1:
+		items, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			applied := "pending"
+			if item.Applied != 0 {
+				applied = time.Unix(item.Applied, 0).UTC().Format(time.RFC3339)
+			}
+			fmt.Printf("%s\t%s\n", item.Migration, applied)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
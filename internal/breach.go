@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BreachSourceFile = "file"
+	BreachSourceApi  = "api"
+
+	// breachPrefixLength is the number of sha1 hex characters the corpus is partitioned by
+	breachPrefixLength = 5
+)
+
+type (
+	// BreachedPasswords tells how many times the password appears in known breaches. Only the first five
+	// characters of the sha1 hash select the range, so the password itself never leaves the lookup.
+	BreachedPasswords interface {
+		Count(password string) (int64, error)
+	}
+
+	// BreachCorpus reads HIBP-style range files from the directory, every file is named by the uppercase hash
+	// prefix, optionally with the .txt extension, and lists the hash suffixes as SUFFIX:COUNT lines.
+	BreachCorpus struct {
+		dir string
+	}
+
+	// BreachRangeClient queries an HTTP range API compatible with api.pwnedpasswords.com/range/{prefix}.
+	BreachRangeClient struct {
+		url    string
+		client *http.Client
+	}
+)
+
+func NewBreachCorpus(dir string) (*BreachCorpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breach corpus %s is not a directory", dir)
+	}
+	return &BreachCorpus{dir: dir}, nil
+}
+
+func (b *BreachCorpus) Count(password string) (int64, error) {
+	prefix, suffix := breachHash(password)
+	for _, name := range []string{prefix + ".txt", prefix} {
+		f, err := os.Open(filepath.Join(b.dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		count, err := breachRangeCount(f, suffix)
+		_ = f.Close()
+		return count, err
+	}
+	// the range is missing from the corpus, none of its hashes is known
+	return 0, nil
+}
+
+func NewBreachRangeClient(url string, timeout time.Duration) *BreachRangeClient {
+	return &BreachRangeClient{
+		url:    strings.TrimRight(url, "/"),
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (b *BreachRangeClient) Count(password string) (int64, error) {
+	prefix, suffix := breachHash(password)
+	req, err := http.NewRequest(http.MethodGet, b.url+"/range/"+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	// padding hides the size of the response, padded entries have zero count
+	req.Header.Set("Add-Padding", "true")
+	res, err := b.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("breach range api responded with %d", res.StatusCode)
+	}
+	return breachRangeCount(res.Body, suffix)
+}
+
+// NewBreachedPasswords returns the configured source, nil when the check is disabled.
+func NewBreachedPasswords(config *ConfigBreach) (BreachedPasswords, error) {
+	switch config.Source {
+	case "":
+		return nil, nil
+	case BreachSourceFile:
+		return NewBreachCorpus(config.Path)
+	case BreachSourceApi:
+		return NewBreachRangeClient(config.ApiUrl, time.Second*time.Duration(config.TimeoutSeconds)), nil
+	default:
+		return nil, errors.New("unknown breach source " + config.Source)
+	}
+}
+
+func breachHash(password string) (string, string) {
+	sum := sha1.Sum([]byte(password))
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return h[:breachPrefixLength], h[breachPrefixLength:]
+}
+
+func breachRangeCount(r io.Reader, suffix string) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.IndexByte(line, ':')
+		if i < 0 || !strings.EqualFold(line[:i], suffix) {
+			continue
+		}
+		return strconv.ParseInt(line[i+1:], 10, 64)
+	}
+	return 0, scanner.Err()
+}
@@ -0,0 +1,72 @@
+package internal_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type failingBreachSource struct{}
+
+func (failingBreachSource) Count(string) (int64, error) {
+	return 0, errors.New("unavailable")
+}
+
+var _ = Describe("BreachedPasswords", func() {
+	// sha1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	rangeBody := "003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"
+
+	It("reads range files", func() {
+		dir, err := os.MkdirTemp("", "breach")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(rangeBody), 0600)).To(Succeed())
+
+		corpus, err := internal.NewBreachCorpus(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(corpus.Count("password")).To(Equal(int64(9545824)))
+		Expect(corpus.Count("kT9vQz2mWpX4")).To(BeZero())
+	})
+
+	It("queries the range api", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/range/5BAA6"))
+			_, _ = w.Write([]byte(rangeBody))
+		}))
+		defer server.Close()
+
+		client := internal.NewBreachRangeClient(server.URL, time.Second)
+		Expect(client.Count("password")).To(Equal(int64(9545824)))
+	})
+
+	It("plugs into the password policy", func() {
+		dir, err := os.MkdirTemp("", "breach")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(os.WriteFile(filepath.Join(dir, "5BAA6"), []byte(rangeBody), 0600)).To(Succeed())
+		corpus, err := internal.NewBreachCorpus(dir)
+		Expect(err).NotTo(HaveOccurred())
+		config := &internal.ConfigPassword{
+			Breach:   internal.ConfigBreach{MinCount: 1},
+			Breached: corpus,
+		}
+
+		violations, err := internal.NewPasswordPolicy(config).Check("password")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(violations).To(ContainElement(internal.PasswordViolation{Tag: internal.PasswordViolationBreached}))
+
+		config.Breached = failingBreachSource{}
+		_, err = internal.NewPasswordPolicy(config).Check("password")
+		Expect(err).To(HaveOccurred())
+		config.Breach.FailOpen = true
+		_, err = internal.NewPasswordPolicy(config).Check("password")
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
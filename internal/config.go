@@ -1,16 +1,24 @@
 package internal
 
 import (
-	"crypto/rsa"
-	"io/ioutil"
+	"fmt"
 	"os"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/ilyakaznacheev/cleanenv"
 	"go.uber.org/dig"
 )
 
+// HostCookiePrefix makes the browser accept the cookie only when it is secure, host-only and set for the path /.
+const HostCookiePrefix = "__Host-"
+
+// the buckets the rate limit rule counts the request in
+const (
+	RateLimitByIp     = "ip"
+	RateLimitByEmail  = "email"
+	RateLimitByClient = "client"
+)
+
 var (
 	gitHash   string
 	gitBranch string
@@ -32,10 +40,18 @@ type (
 		Logger   ConfigLogger   `yaml:"logger"`
 		Http     ConfigHttp     `yaml:"http"`
 		Frontend ConfigFrontend `yaml:"frontend"`
-		Mysql    ConfigMysql    `yaml:"mysql"`
-		Cookie   ConfigCookie   `yaml:"cookie"`
-		Smtp     ConfigSmtp     `yaml:"smtp"`
-		Crypto   ConfigCrypto   `yaml:"crypto"`
+		Database ConfigDatabase `yaml:"database"`
+		// Deprecated: Mysql is read only while the database dsn is not set, use Database.
+		Mysql     ConfigMysql     `yaml:"mysql"`
+		Cookie    ConfigCookie    `yaml:"cookie"`
+		Smtp      ConfigSmtp      `yaml:"smtp"`
+		Crypto    ConfigCrypto    `yaml:"crypto"`
+		OAuth     ConfigOAuth     `yaml:"oauth"`
+		Mfa       ConfigMfa       `yaml:"mfa"`
+		WebAuthn  ConfigWebAuthn  `yaml:"webauthn"`
+		Lockout   ConfigLockout   `yaml:"lockout"`
+		RateLimit ConfigRateLimit `yaml:"rate_limit"`
+		Password  ConfigPassword  `yaml:"password"`
 	}
 
 	ConfigLogger struct {
@@ -50,6 +66,12 @@ type (
 		WriteTimeout    int `yaml:"write_timeout" env:"APP_HTTP_WRITE_TIMEOUT" env-default:"18"`
 		IdleTimeout     int `yaml:"idle_timeout" env:"APP_HTTP_IDLE_TIMEOUT" env-default:"60"`
 		ReqTimeout      int `yaml:"request_timeout" env:"APP_HTTP_REQUEST_TIMEOUT" env-default:"5"`
+		// PublicUrl is the base of the links sent by email, the request host is used only when it is empty.
+		PublicUrl string `yaml:"public_url" env:"APP_PUBLIC_URL"`
+		// TrustedProxies are the addresses or CIDR ranges whose X-Forwarded-* headers are honored, they are read
+		// into Proxies only, which both the client ip and the web server checks are derived from.
+		TrustedProxies []string `yaml:"trusted_proxies" env:"APP_HTTP_TRUSTED_PROXIES"`
+		Proxies        *TrustedProxies
 	}
 
 	ConfigFrontend struct {
@@ -57,17 +79,33 @@ type (
 		Index string `yaml:"index" env:"APP_FRONTEND_INDEX" env-default:"index.html"`
 	}
 
+	ConfigDatabase struct {
+		// Driver is one of mysql, postgres, sqlite3 or memory, the latter is meant for tests and local development
+		Driver       string `yaml:"driver" env:"APP_DATABASE_DRIVER" env-default:"mysql"`
+		Dsn          string `yaml:"dsn" env:"APP_DATABASE_DSN"`
+		MaxLifetime  int    `yaml:"max_lifetime" env:"APP_DATABASE_MAX_LIFETIME" env-default:"20"`
+		MaxOpenConns int    `yaml:"max_open_conns" env:"APP_DATABASE_MAX_OPEN_CONNS" env-default:"100"`
+		MaxIdleConns int    `yaml:"max_idle_conns" env:"APP_DATABASE_MAX_IDLE_CONNS" env-default:"100"`
+		// Migrate applies the pending schema migrations at startup, otherwise the migrate command applies them
+		// and the startup fails while any is pending
+		Migrate bool `yaml:"migrate" env:"APP_DATABASE_MIGRATE" env-default:"true"`
+	}
+
+	// ConfigMysql is the database section of the releases before the driver could be selected.
 	ConfigMysql struct {
 		Dsn          string `yaml:"dsn" env:"APP_MYSQL_DSN"`
-		MaxLifetime  int    `yaml:"max_lifetime" env:"APP_MYSQL_MAX_LIFETIME" env-default:"20"`
-		MaxOpenConns int    `yaml:"max_open_conns" env:"APP_MYSQL_MAX_OPEN_CONNS" env-default:"100"`
-		MaxIdleConns int    `yaml:"max_idle_conns" env:"APP_MYSQL_MAX_IDLE_CONNS" env-default:"100"`
+		MaxLifetime  int    `yaml:"max_lifetime" env:"APP_MYSQL_MAX_LIFETIME"`
+		MaxOpenConns int    `yaml:"max_open_conns" env:"APP_MYSQL_MAX_OPEN_CONNS"`
+		MaxIdleConns int    `yaml:"max_idle_conns" env:"APP_MYSQL_MAX_IDLE_CONNS"`
 	}
 
 	ConfigCookie struct {
 		Name       string `yaml:"cookie_name" env:"APP_COOKIE_NAME" env-default:"SSO_C"`
 		Domain     string `yaml:"cookie_domain" env:"APP_COOKIE_DOMAIN" env-default:"127.0.0.1"`
 		ValidHours int64  `yaml:"cookie_valid_hours" env:"APP_VALID_HOURS" env-default:"20"`
+		// CsrfName is the host-only cookie of the double-submit csrf token of the html forms, it always has the
+		// __Host- prefix, so the browser refuses the cookie set by a sibling subdomain or over http.
+		CsrfName string `yaml:"csrf_cookie_name" env:"APP_CSRF_COOKIE_NAME" env-default:"__Host-SSO_CSRF"`
 	}
 
 	ConfigSmtp struct {
@@ -79,10 +117,108 @@ type (
 	}
 
 	ConfigCrypto struct {
-		PrivateKeyPath string `yaml:"private_key_path" env:"APP_PRIVATE_KEY_PATH"`
-		PublicKeyPath  string `yaml:"public_key_path" env:"APP_PUBLIC_KEY_PATH"`
-		PrivateKey     *rsa.PrivateKey
-		PublicKey      *rsa.PublicKey
+		// PrivateKeyPath and PublicKeyPath configure single active key when Keys are not set
+		PrivateKeyPath string            `yaml:"private_key_path" env:"APP_PRIVATE_KEY_PATH"`
+		PublicKeyPath  string            `yaml:"public_key_path" env:"APP_PUBLIC_KEY_PATH"`
+		Keys           []ConfigCryptoKey `yaml:"keys"`
+		KeyRing        *KeyRing
+		// SecretKey is base64 encoded 32 byte key encrypting secrets at rest, e.g. TOTP secrets
+		SecretKey string `yaml:"secret_key" env:"APP_SECRET_KEY"`
+		SecretBox *SecretBox
+	}
+
+	ConfigCryptoKey struct {
+		Id             string `yaml:"id"`
+		Status         string `yaml:"status" env-default:"active"`
+		PrivateKeyPath string `yaml:"private_key_path"`
+		PublicKeyPath  string `yaml:"public_key_path"`
+	}
+
+	ConfigOAuth struct {
+		Issuer                   string `yaml:"issuer" env:"APP_OAUTH_ISSUER"`
+		CodeValidSeconds         int64  `yaml:"code_valid_seconds" env:"APP_OAUTH_CODE_VALID_SECONDS" env-default:"60"`
+		AccessTokenValidMinutes  int64  `yaml:"access_token_valid_minutes" env:"APP_OAUTH_ACCESS_TOKEN_VALID_MINUTES" env-default:"15"`
+		RefreshTokenValidHours   int64  `yaml:"refresh_token_valid_hours" env:"APP_OAUTH_REFRESH_TOKEN_VALID_HOURS" env-default:"720"`
+		BackchannelLogoutTimeout int    `yaml:"backchannel_logout_timeout" env:"APP_OAUTH_BACKCHANNEL_LOGOUT_TIMEOUT" env-default:"5"`
+	}
+
+	ConfigMfa struct {
+		Issuer                string   `yaml:"issuer" env:"APP_MFA_ISSUER" env-default:"go-sso"`
+		ChallengeValidMinutes int64    `yaml:"challenge_valid_minutes" env:"APP_MFA_CHALLENGE_VALID_MINUTES" env-default:"5"`
+		RequiredRoles         []string `yaml:"required_roles" env:"APP_MFA_REQUIRED_ROLES" env-default:"admin"`
+		RecoveryCodes         int      `yaml:"recovery_codes" env:"APP_MFA_RECOVERY_CODES" env-default:"10"`
+	}
+
+	ConfigWebAuthn struct {
+		RPDisplayName         string `yaml:"rp_display_name" env:"APP_WEBAUTHN_RP_DISPLAY_NAME" env-default:"go-sso"`
+		RPID                  string `yaml:"rp_id" env:"APP_WEBAUTHN_RP_ID" env-default:"localhost"`
+		RPOrigin              string `yaml:"rp_origin" env:"APP_WEBAUTHN_RP_ORIGIN" env-default:"http://localhost:8080"`
+		ChallengeValidSeconds int64  `yaml:"challenge_valid_seconds" env:"APP_WEBAUTHN_CHALLENGE_VALID_SECONDS" env-default:"300"`
+	}
+
+	// ConfigLockout limits password and second factor guessing, every further lockout of the account lasts twice
+	// as long up to MaxLockMinutes.
+	ConfigLockout struct {
+		MaxAttempts    int64 `yaml:"max_attempts" env:"APP_LOCKOUT_MAX_ATTEMPTS" env-default:"5"`
+		WindowMinutes  int64 `yaml:"window_minutes" env:"APP_LOCKOUT_WINDOW_MINUTES" env-default:"15"`
+		LockMinutes    int64 `yaml:"lock_minutes" env:"APP_LOCKOUT_LOCK_MINUTES" env-default:"5"`
+		MaxLockMinutes int64 `yaml:"max_lock_minutes" env:"APP_LOCKOUT_MAX_LOCK_MINUTES" env-default:"1440"`
+		IpMaxAttempts  int64 `yaml:"ip_max_attempts" env:"APP_LOCKOUT_IP_MAX_ATTEMPTS" env-default:"50"`
+	}
+
+	// ConfigRateLimit maps route names to their limits, routes without a rule are not limited.
+	ConfigRateLimit struct {
+		Enabled bool                           `yaml:"enabled" env:"APP_RATE_LIMIT_ENABLED" env-default:"true"`
+		Rules   map[string]ConfigRateLimitRule `yaml:"rules"`
+	}
+
+	// ConfigRateLimitRule allows Limit requests per window in every bucket, By lists the buckets the request
+	// is counted in: ip, email or client (the application code).
+	ConfigRateLimitRule struct {
+		Limit         int64    `yaml:"limit"`
+		WindowSeconds int64    `yaml:"window_seconds"`
+		By            []string `yaml:"by"`
+	}
+
+	// ConfigPassword is the policy new passwords have to meet, MinEntropy is the estimated strength in bits.
+	// HistorySize previous passwords of the user cannot be reused, passwords older than MaxAgeDays have to be
+	// changed at the next login, zero disables either.
+	ConfigPassword struct {
+		MinLength        int          `yaml:"min_length" env:"APP_PASSWORD_MIN_LENGTH" env-default:"10"`
+		MaxBytes         int          `yaml:"max_bytes" env:"APP_PASSWORD_MAX_BYTES" env-default:"72"`
+		RequireLower     bool         `yaml:"require_lower" env:"APP_PASSWORD_REQUIRE_LOWER" env-default:"true"`
+		RequireUpper     bool         `yaml:"require_upper" env:"APP_PASSWORD_REQUIRE_UPPER" env-default:"true"`
+		RequireDigit     bool         `yaml:"require_digit" env:"APP_PASSWORD_REQUIRE_DIGIT" env-default:"true"`
+		RequireSymbol    bool         `yaml:"require_symbol" env:"APP_PASSWORD_REQUIRE_SYMBOL" env-default:"false"`
+		DisallowPersonal bool         `yaml:"disallow_personal" env:"APP_PASSWORD_DISALLOW_PERSONAL" env-default:"true"`
+		MinEntropy       float64      `yaml:"min_entropy" env:"APP_PASSWORD_MIN_ENTROPY" env-default:"50"`
+		Breach           ConfigBreach `yaml:"breach"`
+		Breached         BreachedPasswords
+		Hashing          ConfigHashing `yaml:"hashing"`
+		HistorySize      int           `yaml:"history_size" env:"APP_PASSWORD_HISTORY_SIZE" env-default:"5"`
+		MaxAgeDays       int64         `yaml:"max_age_days" env:"APP_PASSWORD_MAX_AGE_DAYS" env-default:"0"`
+		Hasher           PasswordHasher
+	}
+
+	// ConfigHashing selects the algorithm of new password hashes, hashes made by the other algorithm or with
+	// other parameters are replaced on the next successful login. Argon2Memory is in KiB.
+	ConfigHashing struct {
+		Algorithm         string `yaml:"algorithm" env:"APP_PASSWORD_HASH_ALGORITHM" env-default:"argon2id"`
+		BcryptCost        int    `yaml:"bcrypt_cost" env:"APP_PASSWORD_BCRYPT_COST" env-default:"10"`
+		Argon2Memory      uint32 `yaml:"argon2_memory" env:"APP_PASSWORD_ARGON2_MEMORY" env-default:"65536"`
+		Argon2Iterations  uint32 `yaml:"argon2_iterations" env:"APP_PASSWORD_ARGON2_ITERATIONS" env-default:"3"`
+		Argon2Parallelism uint8  `yaml:"argon2_parallelism" env:"APP_PASSWORD_ARGON2_PARALLELISM" env-default:"2"`
+	}
+
+	// ConfigBreach selects where breached passwords are looked up, empty Source disables the check. Passwords
+	// seen at least MinCount times are rejected, FailOpen accepts the password when the lookup fails.
+	ConfigBreach struct {
+		Source         string `yaml:"source" env:"APP_PASSWORD_BREACH_SOURCE"`
+		Path           string `yaml:"path" env:"APP_PASSWORD_BREACH_PATH"`
+		ApiUrl         string `yaml:"api_url" env:"APP_PASSWORD_BREACH_API_URL" env-default:"https://api.pwnedpasswords.com"`
+		TimeoutSeconds int64  `yaml:"timeout_seconds" env:"APP_PASSWORD_BREACH_TIMEOUT_SECONDS" env-default:"3"`
+		MinCount       int64  `yaml:"min_count" env:"APP_PASSWORD_BREACH_MIN_COUNT" env-default:"1"`
+		FailOpen       bool   `yaml:"fail_open" env:"APP_PASSWORD_BREACH_FAIL_OPEN" env-default:"true"`
 	}
 
 	SetupConfigResult struct {
@@ -119,31 +255,111 @@ func SetupConfig() SetupConfigResult {
 		}
 	}
 
-	privateKeyData, err := ioutil.ReadFile(config.Crypto.PrivateKeyPath)
-	if err != nil {
+	if err := InitConfig(config); err != nil {
 		sr.Error = err
 		return sr
 	}
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyData)
-	if err != nil {
-		sr.Error = err
-		return sr
+
+	sr.Config = config
+	return sr
+}
+
+// InitConfig validates the read configuration and builds the services derived from it: the trusted proxies,
+// the signing keys, the secret box and the password checks.
+func InitConfig(config *Config) error {
+	config.Database.fallback(&config.Mysql)
+	if !strings.HasPrefix(config.Cookie.CsrfName, HostCookiePrefix) {
+		config.Cookie.CsrfName = HostCookiePrefix + config.Cookie.CsrfName
+	}
+
+	if err := config.RateLimit.validate(); err != nil {
+		return err
 	}
 
-	publicKeyData, err := ioutil.ReadFile(config.Crypto.PublicKeyPath)
+	if err := parsePublicUrl(config.Http.PublicUrl); err != nil {
+		return err
+	}
+	config.Http.PublicUrl = strings.TrimRight(config.Http.PublicUrl, "/")
+
+	proxies, err := NewTrustedProxies(config.Http.TrustedProxies)
 	if err != nil {
-		sr.Error = err
-		return sr
+		return err
 	}
-	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicKeyData)
+	config.Http.Proxies = proxies
+
+	keyRing, err := loadKeyRing(&config.Crypto)
 	if err != nil {
-		sr.Error = err
-		return sr
+		return err
+	}
+	config.Crypto.KeyRing = keyRing
+
+	if config.Crypto.SecretKey != "" {
+		if config.Crypto.SecretBox, err = NewSecretBox(config.Crypto.SecretKey); err != nil {
+			return err
+		}
 	}
 
-	config.Crypto.PrivateKey = privateKey
-	config.Crypto.PublicKey = publicKey
+	if config.Password.Hasher, err = NewPasswordHasher(&config.Password.Hashing); err != nil {
+		return err
+	}
 
-	sr.Config = config
-	return sr
+	if config.Password.Breached, err = NewBreachedPasswords(&config.Password.Breach); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validate refuses the buckets the limiter does not know, the rule would silently leave the route unlimited.
+func (c *ConfigRateLimit) validate() error {
+	for name, rule := range c.Rules {
+		for _, by := range rule.By {
+			if by != RateLimitByIp && by != RateLimitByEmail && by != RateLimitByClient {
+				return fmt.Errorf("rate limit rule %s counts by unknown %q, use ip, email or client", name, by)
+			}
+		}
+	}
+	return nil
+}
+
+// fallback takes the mysql section of the older configuration when the database one has no dsn, so the upgrade
+// does not need the configuration to be changed.
+func (c *ConfigDatabase) fallback(legacy *ConfigMysql) {
+	if c.Dsn != "" || legacy.Dsn == "" || c.Driver != "mysql" {
+		return
+	}
+	c.Dsn = legacy.Dsn
+	if legacy.MaxLifetime > 0 {
+		c.MaxLifetime = legacy.MaxLifetime
+	}
+	if legacy.MaxOpenConns > 0 {
+		c.MaxOpenConns = legacy.MaxOpenConns
+	}
+	if legacy.MaxIdleConns > 0 {
+		c.MaxIdleConns = legacy.MaxIdleConns
+	}
+}
+
+func loadKeyRing(config *ConfigCrypto) (*KeyRing, error) {
+	if len(config.Keys) == 0 {
+		key, err := LoadSigningKey("", KeyStatusActive, config.PrivateKeyPath, config.PublicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeyRing(key)
+	}
+
+	var keys []*SigningKey
+	for _, k := range config.Keys {
+		status := k.Status
+		if status == "" {
+			status = KeyStatusActive
+		}
+		key, err := LoadSigningKey(k.Id, status, k.PrivateKeyPath, k.PublicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewKeyRing(keys...)
 }
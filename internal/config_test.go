@@ -0,0 +1,71 @@
+package internal_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/ilyakaznacheev/cleanenv"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	load := func(yaml string) (*internal.Config, error) {
+		dir, err := os.MkdirTemp("", "config")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "app.yaml")
+		Expect(ioutil.WriteFile(file, []byte(yaml), 0600)).To(Succeed())
+		config := &internal.Config{}
+		Expect(cleanenv.ReadConfig(file, config)).To(Succeed())
+		config.Crypto.PrivateKeyPath = "../test/key_pair/demo.rsa"
+		config.Crypto.PublicKeyPath = "../test/key_pair/demo.rsa.pub"
+		return config, internal.InitConfig(config)
+	}
+
+	read := func(yaml string) *internal.Config {
+		config, err := load(yaml)
+		Expect(err).NotTo(HaveOccurred())
+		return config
+	}
+
+	It("reads the mysql section of the older configuration", func() {
+		config := read("mysql:\n  dsn: \"sso:secret@tcp(db:3306)/sso\"\n  max_open_conns: 10\n")
+		Expect(config.Database.Driver).To(Equal("mysql"))
+		Expect(config.Database.Dsn).To(Equal("sso:secret@tcp(db:3306)/sso"))
+		Expect(config.Database.MaxOpenConns).To(Equal(10))
+		Expect(config.Database.MaxIdleConns).To(Equal(100))
+	})
+
+	It("reads the mysql variables of the older configuration", func() {
+		Expect(os.Setenv("APP_MYSQL_DSN", "sso:secret@tcp(env:3306)/sso")).To(Succeed())
+		defer os.Unsetenv("APP_MYSQL_DSN")
+		config := read("port: 8080\n")
+		Expect(config.Database.Dsn).To(Equal("sso:secret@tcp(env:3306)/sso"))
+	})
+
+	It("keeps the csrf cookie to the host", func() {
+		Expect(read("port: 8080\n").Cookie.CsrfName).To(Equal("__Host-SSO_CSRF"))
+		Expect(read("cookie:\n  csrf_cookie_name: \"CSRF\"\n").Cookie.CsrfName).To(Equal("__Host-CSRF"))
+		Expect(read("cookie:\n  csrf_cookie_name: \"__Host-CSRF\"\n").Cookie.CsrfName).To(Equal("__Host-CSRF"))
+	})
+
+	It("prefers the database section", func() {
+		config := read("database:\n  dsn: \"sso:secret@tcp(new:3306)/sso\"\nmysql:\n  dsn: \"sso:secret@tcp(old:3306)/sso\"\n  max_open_conns: 10\n")
+		Expect(config.Database.Dsn).To(Equal("sso:secret@tcp(new:3306)/sso"))
+		Expect(config.Database.MaxOpenConns).To(Equal(100))
+
+		config = read("database:\n  driver: \"postgres\"\nmysql:\n  dsn: \"sso:secret@tcp(old:3306)/sso\"\n")
+		Expect(config.Database.Dsn).To(BeEmpty())
+	})
+
+	It("refuses the rate limit rule counting by an unknown bucket", func() {
+		config := read("rate_limit:\n  rules:\n    login:\n      limit: 5\n      window_seconds: 60\n      by: [\"ip\", \"email\"]\n")
+		Expect(config.RateLimit.Rules["login"].By).To(ConsistOf("ip", "email"))
+
+		_, err := load("rate_limit:\n  rules:\n    login:\n      limit: 5\n      window_seconds: 60\n      by: [\"ip\", \"user\"]\n")
+		Expect(err).To(MatchError(ContainSubstring(`unknown "user"`)))
+	})
+})
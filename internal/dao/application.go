@@ -1,8 +1,8 @@
 package dao
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"os"
 	"time"
 
@@ -16,45 +16,53 @@ type (
 	}
 )
 
-func (a *ApplicationStore) ById(id int64) (*models.ApplicationModel, error) {
-	item, err := a.db.Get(models.ApplicationModel{}, id)
+func (a *ApplicationStore) ById(ctx context.Context, id int64) (*models.ApplicationModel, error) {
+	item, err := a.exec(ctx).Get(models.ApplicationModel{}, id)
 	switch err {
 	case sql.ErrNoRows:
 		return nil, nil
 	case nil:
+		// gorp returns no error and no item for missing rows
+		if item == nil {
+			return nil, nil
+		}
 		return item.(*models.ApplicationModel), nil
 	default:
 		return nil, err
 	}
 }
 
-func (a *ApplicationStore) ByCode(code string) (*models.ApplicationModel, error) {
-	query := fmt.Sprintf("SELECT * FROM `%s` WHERE `code`=?", a.tableName)
-	return a.selectOne(query, code)
+func (a *ApplicationStore) ByCode(ctx context.Context, code string) (*models.ApplicationModel, error) {
+	query := a.query("SELECT * FROM `%s` WHERE `code`=?", a.tableName)
+	return a.selectOne(ctx, query, code)
 }
 
-func (a *ApplicationStore) Create(model *models.ApplicationModel) error {
+func (a *ApplicationStore) Create(ctx context.Context, model *models.ApplicationModel) error {
 	model.Created = time.Now().Unix()
-	return a.db.Insert(model)
+	return a.exec(ctx).Insert(model)
 }
 
-func (a *ApplicationStore) Update(model *models.ApplicationModel) (int64, error) {
+func (a *ApplicationStore) Update(ctx context.Context, model *models.ApplicationModel) (int64, error) {
 	model.Updated = time.Now().Unix()
-	return a.db.Update(model)
+	return a.exec(ctx).Update(model)
 }
 
-func (a *ApplicationStore) Delete(model *models.ApplicationModel) (int64, error) {
-	return a.db.Delete(model)
+func (a *ApplicationStore) Delete(ctx context.Context, model *models.ApplicationModel) (int64, error) {
+	return a.exec(ctx).Delete(model)
 }
 
-func (a *ApplicationStore) List() ([]*models.ApplicationModel, error) {
-	// TODO implement me
-	panic("implement me")
+func (a *ApplicationStore) List(ctx context.Context) ([]*models.ApplicationModel, error) {
+	var items []*models.ApplicationModel
+	query := a.query("SELECT * FROM `%s` ORDER BY `id`", a.tableName)
+	if _, err := a.exec(ctx).Select(&items, query); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (a *ApplicationStore) selectOne(query string, args ...interface{}) (*models.ApplicationModel, error) {
+func (a *ApplicationStore) selectOne(ctx context.Context, query string, args ...interface{}) (*models.ApplicationModel, error) {
 	item := &models.ApplicationModel{}
-	err := a.db.SelectOne(item, query, args...)
+	err := a.exec(ctx).SelectOne(item, query, args...)
 	switch err {
 	case sql.ErrNoRows:
 		return nil, nil
@@ -65,23 +73,16 @@ func (a *ApplicationStore) selectOne(query string, args ...interface{}) (*models
 	}
 }
 
-func setupApplicationStore(db *sql.DB) (*ApplicationStore, error) {
+func setupApplicationStore(db *gorp.DbMap) (*ApplicationStore, error) {
 	store := &ApplicationStore{
 		Store{
-			db:        &gorp.DbMap{Db: db, Dialect: gorp.MySQLDialect{Encoding: "UTF8", Engine: "INNODB"}},
+			db:        db,
 			tableName: "applications",
 			stdout:    os.Stderr,
 		},
 	}
 
-	table := store.db.AddTableWithName(models.ApplicationModel{}, store.tableName).SetKeys(true, "Id")
-	table.AddIndex("idx_code", "Btree", []string{"code"}).SetUnique(true)
-
-	if err := store.db.CreateTablesIfNotExists(); err != nil {
-		return nil, err
-	}
-
-	_ = store.db.CreateIndex()
+	store.db.AddTableWithName(models.ApplicationModel{}, store.tableName).SetKeys(true, "Id")
 
 	return store, nil
 }
@@ -0,0 +1,98 @@
+package dao
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	AuditStore struct {
+		Store
+	}
+)
+
+func (a *AuditStore) Add(ctx context.Context, item *models.AuditModel) error {
+	if item.Created == 0 {
+		item.Created = time.Now().Unix()
+	}
+	return a.exec(ctx).Insert(item)
+}
+
+func (a *AuditStore) Find(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditModel, error) {
+	where, args := a.where(filter)
+	query := a.query("SELECT * FROM `%s`%s ORDER BY `id` DESC LIMIT ? OFFSET ?", a.tableName, where)
+	args = append(args, filter.Limit, filter.Offset)
+	var items []*models.AuditModel
+	if _, err := a.exec(ctx).Select(&items, query, args...); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (a *AuditStore) Count(ctx context.Context, filter *models.AuditFilter) (int64, error) {
+	where, args := a.where(filter)
+	query := a.query("SELECT COUNT(*) FROM `%s`%s", a.tableName, where)
+	return a.exec(ctx).SelectInt(query, args...)
+}
+
+func (a *AuditStore) where(filter *models.AuditFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if filter.Action != "" {
+		add("`action`=?", filter.Action)
+	}
+	if filter.Outcome != "" {
+		add("`outcome`=?", filter.Outcome)
+	}
+	if filter.ActorId != 0 {
+		add("`actor_id`=?", filter.ActorId)
+	}
+	if filter.TargetId != 0 {
+		add("`target_id`=?", filter.TargetId)
+	}
+	if filter.Subject != "" {
+		add("`subject`=?", filter.Subject)
+	}
+	if filter.Application != "" {
+		add("`application`=?", filter.Application)
+	}
+	if filter.Ip != "" {
+		add("`ip`=?", filter.Ip)
+	}
+	if filter.From != 0 {
+		add("`created_at`>=?", filter.From)
+	}
+	if filter.To != 0 {
+		add("`created_at`<?", filter.To)
+	}
+	if filter.BeforeId != 0 {
+		add("`id`<?", filter.BeforeId)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func setupAuditStore(db *gorp.DbMap) (*AuditStore, error) {
+	store := &AuditStore{
+		Store{
+			db:        db,
+			tableName: "audit_log",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.AuditModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
@@ -0,0 +1,65 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	AuthorizationCodeStore struct {
+		Store
+	}
+)
+
+func (a *AuthorizationCodeStore) Create(ctx context.Context, model *models.AuthorizationCodeModel) error {
+	model.Created = time.Now().Unix()
+	return a.exec(ctx).Insert(model)
+}
+
+func (a *AuthorizationCodeStore) ByCode(ctx context.Context, code string) (*models.AuthorizationCodeModel, error) {
+	query := a.query("SELECT * FROM `%s` WHERE `code`=? LIMIT 1", a.tableName)
+	item := &models.AuthorizationCodeModel{}
+	err := a.exec(ctx).SelectOne(item, query, code)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return item, nil
+	default:
+		return nil, err
+	}
+}
+
+func (a *AuthorizationCodeStore) Consume(ctx context.Context, model *models.AuthorizationCodeModel) (bool, error) {
+	query := a.query("UPDATE `%s` SET `used`=? WHERE `id`=? AND `used`=?", a.tableName)
+	rows, err := a.affected(ctx, query, true, model.Id, false)
+	if err != nil {
+		return false, err
+	}
+	model.Used = true
+	return rows == 1, nil
+}
+
+func (a *AuthorizationCodeStore) DeleteExpired(ctx context.Context, before int64) (int64, error) {
+	query := a.query("DELETE FROM `%s` WHERE `expires_at`<?", a.tableName)
+	return a.affected(ctx, query, before)
+}
+
+func setupAuthorizationCodeStore(db *gorp.DbMap) (*AuthorizationCodeStore, error) {
+	store := &AuthorizationCodeStore{
+		Store{
+			db:        db,
+			tableName: "authorization_codes",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.AuthorizationCodeModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
@@ -0,0 +1,246 @@
+package dao
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"database/sql"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	Store struct {
+		tableName string
+		db        *gorp.DbMap
+		stdout    io.Writer
+	}
+
+	// executor runs the queries of the store bound to the context, the failures caused by the context are
+	// returned as models.ErrTimeout or models.ErrUnavailable.
+	executor struct {
+		gorp.SqlExecutor
+		ctx context.Context
+	}
+
+	// txKey is the context key of the transaction the queries take part in.
+	txKey struct{}
+
+	SqlDao struct {
+		*models.SSO
+		db                      *gorp.DbMap
+		UserStore               *UserStore
+		ApplicationStore        *ApplicationStore
+		AuthorizationCodeStore  *AuthorizationCodeStore
+		RefreshTokenStore       *RefreshTokenStore
+		SessionStore            *SessionStore
+		SessionClientStore      *SessionClientStore
+		TotpStore               *TotpStore
+		WebAuthnCredentialStore *WebAuthnCredentialStore
+		WebAuthnChallengeStore  *WebAuthnChallengeStore
+		RecoveryCodeStore       *RecoveryCodeStore
+		LoginFailureStore       *LoginFailureStore
+		PasswordHistoryStore    *PasswordHistoryStore
+		AuditStore              *AuditStore
+	}
+)
+
+// exec returns the executor of the store bound to the context, the queries run in the transaction of the context
+// if there is one.
+func (s *Store) exec(ctx context.Context) *executor {
+	if tx, ok := ctx.Value(txKey{}).(*gorp.Transaction); ok {
+		return &executor{SqlExecutor: tx.WithContext(ctx), ctx: ctx}
+	}
+	return &executor{SqlExecutor: s.db.WithContext(ctx), ctx: ctx}
+}
+
+// transaction runs fn in a transaction of the store, see transaction.
+func (s *Store) transaction(ctx context.Context, fn func(context.Context) error) error {
+	return transaction(ctx, s.db, fn)
+}
+
+// transaction runs fn in a transaction which is committed when fn returns nil and rolled back otherwise, fn joins
+// the transaction of the context if there is one.
+func transaction(ctx context.Context, db *gorp.DbMap, fn func(context.Context) error) (err error) {
+	if _, ok := ctx.Value(txKey{}).(*gorp.Transaction); ok {
+		return fn(ctx)
+	}
+	tx, err := db.WithContext(ctx).(*gorp.DbMap).Begin()
+	if err != nil {
+		return storeError(ctx, err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return storeError(ctx, tx.Commit())
+}
+
+func (s *Store) execute(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ret, err := s.exec(ctx).Exec(query, args...)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return ret, nil
+	default:
+		return nil, err
+	}
+}
+
+// query formats the query of the store, queries are written with mysql quoting and ? placeholders
+// which are rewritten for the other dialects.
+func (s *Store) query(format string, args ...interface{}) string {
+	return rewrite(s.db.Dialect, fmt.Sprintf(format, args...))
+}
+
+// rewrite replaces the mysql quoting and ? placeholders of the query with the ones of the dialect.
+func rewrite(dialect gorp.Dialect, query string) string {
+	if _, ok := dialect.(gorp.MySQLDialect); ok {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		switch r {
+		case '`':
+			b.WriteRune('"')
+		case '?':
+			b.WriteString(dialect.BindVar(n))
+			n++
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// affected executes the query and returns the number of affected rows.
+func (s *Store) affected(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	res, err := s.execute(ctx, query, args...)
+	if err != nil || res == nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// storeError returns the typed error when the query failed because of the context, the lost connection or
+// a unique index.
+func storeError(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("%w: %v", models.ErrTimeout, err)
+	case errors.Is(err, context.Canceled) || ctx.Err() == context.Canceled || errors.Is(err, driver.ErrBadConn):
+		return fmt.Errorf("%w: %v", models.ErrUnavailable, err)
+	case uniqueViolation(err):
+		return fmt.Errorf("%w: %v", models.ErrAlreadyExists, err)
+	default:
+		return err
+	}
+}
+
+func (e *executor) Get(i interface{}, keys ...interface{}) (interface{}, error) {
+	item, err := e.SqlExecutor.Get(i, keys...)
+	return item, storeError(e.ctx, err)
+}
+
+func (e *executor) Insert(list ...interface{}) error {
+	return storeError(e.ctx, e.SqlExecutor.Insert(list...))
+}
+
+func (e *executor) Update(list ...interface{}) (int64, error) {
+	rows, err := e.SqlExecutor.Update(list...)
+	return rows, storeError(e.ctx, err)
+}
+
+func (e *executor) Delete(list ...interface{}) (int64, error) {
+	rows, err := e.SqlExecutor.Delete(list...)
+	return rows, storeError(e.ctx, err)
+}
+
+func (e *executor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	res, err := e.SqlExecutor.Exec(query, args...)
+	return res, storeError(e.ctx, err)
+}
+
+func (e *executor) Select(i interface{}, query string, args ...interface{}) ([]interface{}, error) {
+	items, err := e.SqlExecutor.Select(i, query, args...)
+	return items, storeError(e.ctx, err)
+}
+
+func (e *executor) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	return storeError(e.ctx, e.SqlExecutor.SelectOne(holder, query, args...))
+}
+
+func (e *executor) SelectInt(query string, args ...interface{}) (int64, error) {
+	n, err := e.SqlExecutor.SelectInt(query, args...)
+	return n, storeError(e.ctx, err)
+}
+
+func (sso SqlDao) Transaction(ctx context.Context, fn func(context.Context) error) error {
+	return transaction(ctx, sso.db, fn)
+}
+
+func (sso SqlDao) ApplicationManager() models.ApplicationManager {
+	return sso.ApplicationStore
+}
+
+func (sso SqlDao) UserManager() models.UserManager {
+	return sso.UserStore
+}
+
+func (sso SqlDao) AuthorizationCodeManager() models.AuthorizationCodeManager {
+	return sso.AuthorizationCodeStore
+}
+
+func (sso SqlDao) RefreshTokenManager() models.RefreshTokenManager {
+	return sso.RefreshTokenStore
+}
+
+func (sso SqlDao) SessionManager() models.SessionManager {
+	return sso.SessionStore
+}
+
+func (sso SqlDao) SessionClientManager() models.SessionClientManager {
+	return sso.SessionClientStore
+}
+
+func (sso SqlDao) TotpManager() models.TotpManager {
+	return sso.TotpStore
+}
+
+func (sso SqlDao) WebAuthnCredentialManager() models.WebAuthnCredentialManager {
+	return sso.WebAuthnCredentialStore
+}
+
+func (sso SqlDao) WebAuthnChallengeManager() models.WebAuthnChallengeManager {
+	return sso.WebAuthnChallengeStore
+}
+
+func (sso SqlDao) RecoveryCodeManager() models.RecoveryCodeManager {
+	return sso.RecoveryCodeStore
+}
+
+func (sso SqlDao) LoginFailureManager() models.LoginFailureManager {
+	return sso.LoginFailureStore
+}
+
+func (sso SqlDao) PasswordHistoryManager() models.PasswordHistoryManager {
+	return sso.PasswordHistoryStore
+}
+
+func (sso SqlDao) AuditManager() models.AuditManager {
+	return sso.AuditStore
+}
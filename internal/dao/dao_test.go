@@ -0,0 +1,394 @@
+package dao_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/dao"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// every driver runs the same specs, mysql and postgres only when their test database is configured
+var backends = []struct {
+	driver string
+	dsn    string
+	env    string
+}{
+	{driver: dao.DriverMemory, dsn: "memory"},
+	{driver: dao.DriverSqlite, dsn: "file:go-sso-test?mode=memory&cache=shared"},
+	{driver: dao.DriverMysql, dsn: os.Getenv("TEST_MYSQL_DSN"), env: "TEST_MYSQL_DSN"},
+	{driver: dao.DriverPostgres, dsn: os.Getenv("TEST_POSTGRES_DSN"), env: "TEST_POSTGRES_DSN"},
+}
+
+func unique(prefix string) string {
+	return prefix + strings.ReplaceAll(uuid.NewString(), "-", "")[:16]
+}
+
+var _ = Describe("Dao", func() {
+	for _, backend := range backends {
+		backend := backend
+
+		Describe(backend.driver, func() {
+			var (
+				ctx = context.Background()
+				s   models.SSOer
+			)
+
+			BeforeEach(func() {
+				if backend.dsn == "" {
+					Skip(backend.env + " is not set")
+				}
+				if s != nil {
+					return
+				}
+				config := &internal.Config{
+					Database: internal.ConfigDatabase{Driver: backend.driver, Dsn: backend.dsn, MaxOpenConns: 4, MaxIdleConns: 4, Migrate: true},
+					Password: internal.ConfigPassword{Hashing: internal.ConfigHashing{
+						Algorithm:         internal.HashAlgorithmArgon2id,
+						BcryptCost:        4,
+						Argon2Memory:      1024,
+						Argon2Iterations:  1,
+						Argon2Parallelism: 1,
+					}},
+				}
+				hasher, err := internal.NewPasswordHasher(&config.Password.Hashing)
+				Expect(err).NotTo(HaveOccurred())
+				config.Password.Hasher = hasher
+
+				sr := dao.SetupDao(config)
+				Expect(sr.Error).NotTo(HaveOccurred())
+				s = sr.SSOer
+			})
+
+			Describe("UserManager", func() {
+				newUser := func(password string) *models.UserModel {
+					hash, err := s.PasswordHasher().Hash(password)
+					Expect(err).NotTo(HaveOccurred())
+					user := &models.UserModel{
+						Name:     "Test",
+						Email:    unique("user-") + "@example.com",
+						Password: hash,
+						Active:   true,
+						Code:     unique("code-"),
+					}
+					Expect(s.UserManager().Create(ctx, user)).To(Succeed())
+					return user
+				}
+
+				It("finds the created user", func() {
+					user := newUser("secret password")
+					Expect(user.Id).NotTo(BeZero())
+
+					byId, err := s.UserManager().ById(ctx, user.Id)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(byId.Email).To(Equal(user.Email))
+					Expect(byId.Active).To(BeTrue())
+
+					byEmail, err := s.UserManager().ByEmail(ctx, user.Email)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(byEmail.Id).To(Equal(user.Id))
+
+					byCode, err := s.UserManager().ByCode(ctx, user.Code)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(byCode.Id).To(Equal(user.Id))
+				})
+
+				It("returns nil for unknown users", func() {
+					user, err := s.UserManager().ById(ctx, -1)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(user).To(BeNil())
+
+					user, err = s.UserManager().ByEmail(ctx, unique("nobody-")+"@example.com")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(user).To(BeNil())
+				})
+
+				It("rejects taken emails", func() {
+					user := newUser("secret password")
+					err := s.UserManager().Create(ctx, &models.UserModel{Name: "Other", Email: user.Email})
+					Expect(errors.Is(err, models.ErrAlreadyExists)).To(BeTrue())
+					Expect(s.UserManager().Create(ctx, &models.UserModel{Name: "Other", Email: unique("free-") + "@example.com"})).To(Succeed())
+				})
+
+				It("authenticates by the password", func() {
+					user := newUser("secret password")
+
+					found, err := s.UserManager().Authenticate(ctx, user.Email, "secret password")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found.Id).To(Equal(user.Id))
+
+					_, err = s.UserManager().Authenticate(ctx, user.Email, "wrong password")
+					Expect(err).To(Equal(models.ErrInvalidCredentials))
+
+					user.Active = false
+					_, err = s.UserManager().Update(ctx, user)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = s.UserManager().Authenticate(ctx, user.Email, "secret password")
+					Expect(err).To(Equal(models.ErrUserLocked))
+				})
+
+				It("refuses the locked user whatever the password", func() {
+					user := newUser("secret password")
+					user.LockedTo = time.Now().Add(time.Minute).Unix()
+					_, err := s.UserManager().Update(ctx, user)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = s.UserManager().Authenticate(ctx, user.Email, "secret password")
+					Expect(err).To(Equal(models.ErrUserLocked))
+					_, err = s.UserManager().Authenticate(ctx, user.Email, "wrong password")
+					Expect(err).To(Equal(models.ErrUserLocked))
+				})
+
+				It("upgrades outdated hashes on login", func() {
+					user := newUser("secret password")
+					hash, err := (&internal.BcryptHasher{Cost: 4}).Hash("secret password")
+					Expect(err).NotTo(HaveOccurred())
+					user.Password = hash
+					_, err = s.UserManager().Update(ctx, user)
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = s.UserManager().Authenticate(ctx, user.Email, "secret password")
+					Expect(err).NotTo(HaveOccurred())
+					stored, err := s.UserManager().ById(ctx, user.Id)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stored.Password).To(HavePrefix("$argon2id$"))
+				})
+
+				It("deletes the user", func() {
+					user := newUser("secret password")
+					Expect(s.UserManager().Delete(ctx, user)).To(Succeed())
+					found, err := s.UserManager().ById(ctx, user.Id)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).To(BeNil())
+				})
+			})
+
+			Describe("ApplicationManager", func() {
+				It("creates, updates and deletes the application", func() {
+					app := &models.ApplicationModel{
+						Application:  "test",
+						Domain:       "app.example.com",
+						RedirectUrl:  "https://app.example.com/",
+						RedirectUris: "https://app.example.com/callback",
+						Code:         unique("app-"),
+					}
+					Expect(s.ApplicationManager().Create(ctx, app)).To(Succeed())
+					Expect(app.Id).NotTo(BeZero())
+
+					found, err := s.ApplicationManager().ByCode(ctx, app.Code)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found.Id).To(Equal(app.Id))
+					Expect(found.AllowsRedirectUri("https://app.example.com/callback")).To(BeTrue())
+
+					app.Domain = "other.example.com"
+					rows, err := s.ApplicationManager().Update(ctx, app)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(rows).To(BeEquivalentTo(1))
+					found, err = s.ApplicationManager().ById(ctx, app.Id)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found.Domain).To(Equal("other.example.com"))
+
+					items, err := s.ApplicationManager().List(ctx)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(items).NotTo(BeEmpty())
+
+					rows, err = s.ApplicationManager().Delete(ctx, app)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(rows).To(BeEquivalentTo(1))
+					found, err = s.ApplicationManager().ByCode(ctx, app.Code)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).To(BeNil())
+				})
+			})
+
+			Describe("SessionManager", func() {
+				It("revokes the sessions once", func() {
+					userId := time.Now().UnixNano()
+					session := &models.SessionModel{Sid: uuid.NewString(), UserId: userId, ClientId: "app", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+					Expect(s.SessionManager().Create(ctx, session)).To(Succeed())
+
+					items, err := s.SessionManager().ByUser(ctx, userId)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(items).To(HaveLen(1))
+
+					rows, err := s.SessionManager().Revoke(ctx, session.Sid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(rows).To(BeEquivalentTo(1))
+					rows, err = s.SessionManager().Revoke(ctx, session.Sid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(rows).To(BeZero())
+
+					items, err = s.SessionManager().ByUser(ctx, userId)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(items).To(BeEmpty())
+				})
+
+				It("adds the application to the session once", func() {
+					sid := uuid.NewString()
+					Expect(s.SessionClientManager().Add(ctx, &models.SessionClientModel{Sid: sid, ClientId: "app"})).To(Succeed())
+					Expect(s.SessionClientManager().Add(ctx, &models.SessionClientModel{Sid: sid, ClientId: "app"})).To(Succeed())
+					items, err := s.SessionClientManager().BySid(ctx, sid)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(items).To(HaveLen(1))
+				})
+			})
+
+			Describe("RefreshTokenManager", func() {
+				It("consumes the token once", func() {
+					token := &models.RefreshTokenModel{Token: unique("token-"), FamilyId: uuid.NewString(), ExpiresAt: time.Now().Add(time.Hour).Unix()}
+					Expect(s.RefreshTokenManager().Create(ctx, token)).To(Succeed())
+
+					ok, err := s.RefreshTokenManager().Consume(ctx, token)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ok).To(BeTrue())
+					ok, err = s.RefreshTokenManager().Consume(ctx, token)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ok).To(BeFalse())
+
+					rows, err := s.RefreshTokenManager().RevokeFamily(ctx, token.FamilyId)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(rows).To(BeEquivalentTo(1))
+				})
+			})
+
+			Describe("LoginFailureManager", func() {
+				It("counts the failures within the window", func() {
+					key := unique("ip-")
+					now := time.Now().Unix()
+					for i := 1; i <= 3; i++ {
+						item, err := s.LoginFailureManager().Count(ctx, models.LoginFailureScopeIp, key, now-60)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(item.Failures).To(BeEquivalentTo(i))
+					}
+
+					item, err := s.LoginFailureManager().ByKey(ctx, models.LoginFailureScopeIp, key)
+					Expect(err).NotTo(HaveOccurred())
+					item.Lockouts = 2
+					Expect(s.LoginFailureManager().Save(ctx, item)).To(Succeed())
+
+					// the passed window starts over, the lockouts stay
+					item, err = s.LoginFailureManager().Count(ctx, models.LoginFailureScopeIp, key, now+60)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(item.Failures).To(BeEquivalentTo(1))
+					Expect(item.Lockouts).To(BeEquivalentTo(2))
+
+					Expect(s.LoginFailureManager().Reset(ctx, models.LoginFailureScopeIp, key)).To(Succeed())
+					item, err = s.LoginFailureManager().ByKey(ctx, models.LoginFailureScopeIp, key)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(item).To(BeNil())
+				})
+			})
+
+			Describe("PasswordHistoryManager", func() {
+				It("keeps the latest hashes", func() {
+					userId := time.Now().UnixNano()
+					for _, hash := range []string{"first", "second", "third"} {
+						Expect(s.PasswordHistoryManager().Add(ctx, &models.PasswordHistoryModel{UserId: userId, Password: hash})).To(Succeed())
+					}
+					Expect(s.PasswordHistoryManager().Prune(ctx, userId, 2)).To(Succeed())
+
+					items, err := s.PasswordHistoryManager().Recent(ctx, userId, 5)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(items).To(HaveLen(2))
+					Expect(items[0].Password).To(Equal("third"))
+					Expect(items[1].Password).To(Equal("second"))
+				})
+			})
+
+			Describe("AuditManager", func() {
+				It("filters and pages the records", func() {
+					subject := unique("audit-") + "@example.com"
+					for _, outcome := range []string{models.AuditOutcomeFailure, models.AuditOutcomeFailure, models.AuditOutcomeSuccess} {
+						item := &models.AuditModel{Action: models.AuditActionLogin, Outcome: outcome, Subject: subject}
+						Expect(s.AuditManager().Add(ctx, item)).To(Succeed())
+					}
+
+					filter := &models.AuditFilter{Subject: subject, Outcome: models.AuditOutcomeFailure, Limit: 1}
+					count, err := s.AuditManager().Count(ctx, filter)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(count).To(BeEquivalentTo(2))
+
+					items, err := s.AuditManager().Find(ctx, filter)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(items).To(HaveLen(1))
+
+					filter.BeforeId = items[0].Id
+					items, err = s.AuditManager().Find(ctx, filter)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(items).To(HaveLen(1))
+					Expect(items[0].Id).To(BeNumerically("<", filter.BeforeId))
+				})
+			})
+
+			Describe("Transaction", func() {
+				It("commits the changes of all managers", func() {
+					user := &models.UserModel{Name: "Test", Email: unique("tx-") + "@example.com"}
+					err := s.Transaction(ctx, func(ctx context.Context) error {
+						if err := s.UserManager().Create(ctx, user); err != nil {
+							return err
+						}
+						return s.PasswordHistoryManager().Add(ctx, &models.PasswordHistoryModel{UserId: user.Id, Password: "hash"})
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					found, err := s.UserManager().ById(ctx, user.Id)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).NotTo(BeNil())
+					items, err := s.PasswordHistoryManager().Recent(ctx, user.Id, 5)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(items).To(HaveLen(1))
+				})
+
+				It("rolls back the changes when the function fails", func() {
+					if backend.driver == dao.DriverMemory {
+						Skip("the memory driver does not roll back")
+					}
+					user := &models.UserModel{Name: "Test", Email: unique("tx-") + "@example.com"}
+					failure := errors.New("failure")
+					err := s.Transaction(ctx, func(ctx context.Context) error {
+						if err := s.UserManager().Create(ctx, user); err != nil {
+							return err
+						}
+						// the nested transaction joins the outer one
+						return s.Transaction(ctx, func(ctx context.Context) error {
+							if err := s.PasswordHistoryManager().Add(ctx, &models.PasswordHistoryModel{UserId: user.Id, Password: "hash"}); err != nil {
+								return err
+							}
+							return failure
+						})
+					})
+					Expect(err).To(Equal(failure))
+
+					found, err := s.UserManager().ByEmail(ctx, user.Email)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found).To(BeNil())
+					items, err := s.PasswordHistoryManager().Recent(ctx, user.Id, 5)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(items).To(BeEmpty())
+				})
+			})
+
+			Describe("context", func() {
+				It("reports the passed deadline as the storage timeout", func() {
+					if backend.driver == dao.DriverMemory {
+						Skip("the memory driver does not block")
+					}
+					expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+					defer cancel()
+
+					_, err := s.UserManager().ById(expired, 1)
+					Expect(errors.Is(err, models.ErrTimeout)).To(BeTrue())
+					_, err = s.SessionManager().Revoke(expired, unique("sid-"))
+					Expect(errors.Is(err, models.ErrTimeout)).To(BeTrue())
+				})
+			})
+		})
+	}
+})
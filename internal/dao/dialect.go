@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"errors"
+
+	"github.com/go-gorp/gorp/v3"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	DriverMysql    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite3"
+	// DriverMemory keeps the data in the process, nothing survives a restart
+	DriverMemory = "memory"
+)
+
+// newDialect returns the gorp dialect of the database driver.
+func newDialect(driver string) (gorp.Dialect, error) {
+	switch driver {
+	case DriverMysql:
+		return gorp.MySQLDialect{Encoding: "UTF8", Engine: "INNODB"}, nil
+	case DriverPostgres:
+		return gorp.PostgresDialect{}, nil
+	case DriverSqlite:
+		return gorp.SqliteDialect{}, nil
+	default:
+		return nil, errors.New("unknown database driver " + driver)
+	}
+}
+
+// uniqueViolation reports whether the driver refused the row because of a unique index.
+func uniqueViolation(err error) bool {
+	var (
+		mysqlErr  *mysql.MySQLError
+		pqErr     *pq.Error
+		sqliteErr sqlite3.Error
+	)
+	switch {
+	case errors.As(err, &mysqlErr):
+		// ER_DUP_ENTRY
+		return mysqlErr.Number == 1062
+	case errors.As(err, &pqErr):
+		return pqErr.Code == "23505"
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	default:
+		return false
+	}
+}
@@ -0,0 +1,78 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	LoginFailureStore struct {
+		Store
+	}
+)
+
+func (l *LoginFailureStore) ByKey(ctx context.Context, scope, key string) (*models.LoginFailureModel, error) {
+	query := l.query("SELECT * FROM `%s` WHERE `scope`=? AND `key`=? LIMIT 1", l.tableName)
+	item := &models.LoginFailureModel{}
+	err := l.exec(ctx).SelectOne(item, query, scope, key)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return item, nil
+	default:
+		return nil, err
+	}
+}
+
+func (l *LoginFailureStore) Count(ctx context.Context, scope, key string, since int64) (*models.LoginFailureModel, error) {
+	now := time.Now().Unix()
+	upsert := "ON CONFLICT (`scope`, `key`) DO UPDATE SET"
+	if _, ok := l.db.Dialect.(gorp.MySQLDialect); ok {
+		upsert = "ON DUPLICATE KEY UPDATE"
+	}
+	// the failures are set before the window, so both compare the window of the stored row
+	query := l.query("INSERT INTO `%[1]s` (`scope`, `key`, `failures`, `lockouts`, `window_start`, `blocked_to`, `updated_at`) "+
+		"VALUES (?, ?, 1, 0, ?, 0, ?) %[2]s "+
+		"`failures`=CASE WHEN `%[1]s`.`window_start`<? THEN 1 ELSE `%[1]s`.`failures`+1 END, "+
+		"`window_start`=CASE WHEN `%[1]s`.`window_start`<? THEN ? ELSE `%[1]s`.`window_start` END, "+
+		"`updated_at`=?", l.tableName, upsert)
+	if _, err := l.execute(ctx, query, scope, key, now, now, since, since, now, now); err != nil {
+		return nil, err
+	}
+	return l.ByKey(ctx, scope, key)
+}
+
+func (l *LoginFailureStore) Save(ctx context.Context, model *models.LoginFailureModel) error {
+	model.Updated = time.Now().Unix()
+	if model.Id == 0 {
+		return l.exec(ctx).Insert(model)
+	}
+	_, err := l.exec(ctx).Update(model)
+	return err
+}
+
+func (l *LoginFailureStore) Reset(ctx context.Context, scope, key string) error {
+	query := l.query("DELETE FROM `%s` WHERE `scope`=? AND `key`=?", l.tableName)
+	_, err := l.execute(ctx, query, scope, key)
+	return err
+}
+
+func setupLoginFailureStore(db *gorp.DbMap) (*LoginFailureStore, error) {
+	store := &LoginFailureStore{
+		Store{
+			db:        db,
+			tableName: "login_failures",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.LoginFailureModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
@@ -0,0 +1,126 @@
+package dao
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+)
+
+type (
+	// memoryTable guards the rows of the in-memory store and assigns their ids, the stores hand out copies
+	// of the rows, so changes are visible only after they are saved like with the sql stores.
+	memoryTable struct {
+		mu     sync.RWMutex
+		lastId int64
+	}
+
+	// MemoryDao keeps everything in memory, it is meant for tests and local development.
+	MemoryDao struct {
+		*models.SSO
+		UserStore               *MemoryUserStore
+		ApplicationStore        *MemoryApplicationStore
+		AuthorizationCodeStore  *MemoryAuthorizationCodeStore
+		RefreshTokenStore       *MemoryRefreshTokenStore
+		SessionStore            *MemorySessionStore
+		SessionClientStore      *MemorySessionClientStore
+		TotpStore               *MemoryTotpStore
+		WebAuthnCredentialStore *MemoryWebAuthnCredentialStore
+		WebAuthnChallengeStore  *MemoryWebAuthnChallengeStore
+		RecoveryCodeStore       *MemoryRecoveryCodeStore
+		LoginFailureStore       *MemoryLoginFailureStore
+		PasswordHistoryStore    *MemoryPasswordHistoryStore
+		AuditStore              *MemoryAuditStore
+		// transactions runs the transactions one at a time
+		transactions *sync.Mutex
+	}
+)
+
+// nextId returns the id of the new row, the write lock has to be held.
+func (t *memoryTable) nextId() int64 {
+	t.lastId++
+	return t.lastId
+}
+
+func NewMemoryDao(config *internal.Config) *MemoryDao {
+	return &MemoryDao{
+		SSO:                     models.SetupSSO(config),
+		UserStore:               &MemoryUserStore{items: map[int64]*models.UserModel{}, hasher: config.Password.Hasher},
+		ApplicationStore:        &MemoryApplicationStore{items: map[int64]*models.ApplicationModel{}},
+		AuthorizationCodeStore:  &MemoryAuthorizationCodeStore{items: map[int64]*models.AuthorizationCodeModel{}},
+		RefreshTokenStore:       &MemoryRefreshTokenStore{items: map[int64]*models.RefreshTokenModel{}},
+		SessionStore:            &MemorySessionStore{items: map[int64]*models.SessionModel{}},
+		SessionClientStore:      &MemorySessionClientStore{items: map[int64]*models.SessionClientModel{}},
+		TotpStore:               &MemoryTotpStore{items: map[int64]*models.TotpModel{}},
+		WebAuthnCredentialStore: &MemoryWebAuthnCredentialStore{items: map[int64]*models.WebAuthnCredentialModel{}},
+		WebAuthnChallengeStore:  &MemoryWebAuthnChallengeStore{items: map[int64]*models.WebAuthnChallengeModel{}},
+		RecoveryCodeStore:       &MemoryRecoveryCodeStore{items: map[int64]*models.RecoveryCodeModel{}},
+		LoginFailureStore:       &MemoryLoginFailureStore{items: map[int64]*models.LoginFailureModel{}},
+		PasswordHistoryStore:    &MemoryPasswordHistoryStore{items: map[int64]*models.PasswordHistoryModel{}},
+		AuditStore:              &MemoryAuditStore{items: map[int64]*models.AuditModel{}},
+		transactions:            &sync.Mutex{},
+	}
+}
+
+// Transaction runs the transactions one at a time, the memory stores cannot roll back the changes of a failed one.
+func (sso MemoryDao) Transaction(ctx context.Context, fn func(context.Context) error) error {
+	if ctx.Value(txKey{}) == sso.transactions {
+		return fn(ctx)
+	}
+	sso.transactions.Lock()
+	defer sso.transactions.Unlock()
+	return fn(context.WithValue(ctx, txKey{}, sso.transactions))
+}
+
+func (sso MemoryDao) ApplicationManager() models.ApplicationManager {
+	return sso.ApplicationStore
+}
+
+func (sso MemoryDao) UserManager() models.UserManager {
+	return sso.UserStore
+}
+
+func (sso MemoryDao) AuthorizationCodeManager() models.AuthorizationCodeManager {
+	return sso.AuthorizationCodeStore
+}
+
+func (sso MemoryDao) RefreshTokenManager() models.RefreshTokenManager {
+	return sso.RefreshTokenStore
+}
+
+func (sso MemoryDao) SessionManager() models.SessionManager {
+	return sso.SessionStore
+}
+
+func (sso MemoryDao) SessionClientManager() models.SessionClientManager {
+	return sso.SessionClientStore
+}
+
+func (sso MemoryDao) TotpManager() models.TotpManager {
+	return sso.TotpStore
+}
+
+func (sso MemoryDao) WebAuthnCredentialManager() models.WebAuthnCredentialManager {
+	return sso.WebAuthnCredentialStore
+}
+
+func (sso MemoryDao) WebAuthnChallengeManager() models.WebAuthnChallengeManager {
+	return sso.WebAuthnChallengeStore
+}
+
+func (sso MemoryDao) RecoveryCodeManager() models.RecoveryCodeManager {
+	return sso.RecoveryCodeStore
+}
+
+func (sso MemoryDao) LoginFailureManager() models.LoginFailureManager {
+	return sso.LoginFailureStore
+}
+
+func (sso MemoryDao) PasswordHistoryManager() models.PasswordHistoryManager {
+	return sso.PasswordHistoryStore
+}
+
+func (sso MemoryDao) AuditManager() models.AuditManager {
+	return sso.AuditStore
+}
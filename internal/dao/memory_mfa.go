@@ -0,0 +1,240 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+)
+
+type (
+	MemoryTotpStore struct {
+		memoryTable
+		items map[int64]*models.TotpModel
+	}
+
+	MemoryWebAuthnCredentialStore struct {
+		memoryTable
+		items map[int64]*models.WebAuthnCredentialModel
+	}
+
+	MemoryWebAuthnChallengeStore struct {
+		memoryTable
+		items map[int64]*models.WebAuthnChallengeModel
+	}
+
+	MemoryRecoveryCodeStore struct {
+		memoryTable
+		items map[int64]*models.RecoveryCodeModel
+	}
+)
+
+func (t *MemoryTotpStore) Save(ctx context.Context, model *models.TotpModel) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, item := range t.items {
+		if item.UserId == model.UserId {
+			delete(t.items, id)
+		}
+	}
+	model.Created = time.Now().Unix()
+	model.Id = t.nextId()
+	c := *model
+	t.items[c.Id] = &c
+	return nil
+}
+
+func (t *MemoryTotpStore) ByUser(ctx context.Context, userId int64) (*models.TotpModel, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, item := range t.items {
+		if item.UserId == userId {
+			c := *item
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (t *MemoryTotpStore) Confirm(ctx context.Context, model *models.TotpModel) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	model.Confirmed = true
+	if item, ok := t.items[model.Id]; ok {
+		item.Confirmed = true
+	}
+	return nil
+}
+
+func (t *MemoryTotpStore) Use(ctx context.Context, model *models.TotpModel, counter int64) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item, ok := t.items[model.Id]
+	if !ok || item.LastCounter >= counter {
+		return false, nil
+	}
+	item.LastCounter = counter
+	model.LastCounter = counter
+	return true, nil
+}
+
+func (t *MemoryTotpStore) DeleteByUser(ctx context.Context, userId int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, item := range t.items {
+		if item.UserId == userId {
+			delete(t.items, id)
+		}
+	}
+	return nil
+}
+
+func (w *MemoryWebAuthnCredentialStore) Create(ctx context.Context, model *models.WebAuthnCredentialModel) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	model.Created = time.Now().Unix()
+	model.Id = w.nextId()
+	c := *model
+	w.items[c.Id] = &c
+	return nil
+}
+
+func (w *MemoryWebAuthnCredentialStore) ByUser(ctx context.Context, userId int64) ([]*models.WebAuthnCredentialModel, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var items []*models.WebAuthnCredentialModel
+	for _, item := range w.items {
+		if item.UserId == userId {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Created != items[j].Created {
+			return items[i].Created < items[j].Created
+		}
+		return items[i].Id < items[j].Id
+	})
+	return items, nil
+}
+
+func (w *MemoryWebAuthnCredentialStore) Use(ctx context.Context, model *models.WebAuthnCredentialModel) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	model.LastUsed = time.Now().Unix()
+	if item, ok := w.items[model.Id]; ok {
+		item.SignCount = model.SignCount
+		item.LastUsed = model.LastUsed
+	}
+	return nil
+}
+
+func (w *MemoryWebAuthnCredentialStore) Delete(ctx context.Context, userId, id int64) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if item, ok := w.items[id]; !ok || item.UserId != userId {
+		return 0, nil
+	}
+	delete(w.items, id)
+	return 1, nil
+}
+
+func (w *MemoryWebAuthnChallengeStore) Create(ctx context.Context, model *models.WebAuthnChallengeModel) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	model.Created = time.Now().Unix()
+	model.Id = w.nextId()
+	c := *model
+	w.items[c.Id] = &c
+	return nil
+}
+
+func (w *MemoryWebAuthnChallengeStore) ByChallenge(ctx context.Context, challenge string) (*models.WebAuthnChallengeModel, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, item := range w.items {
+		if item.Challenge == challenge {
+			c := *item
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (w *MemoryWebAuthnChallengeStore) Consume(ctx context.Context, model *models.WebAuthnChallengeModel) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.items[model.Id]; !ok {
+		return false, nil
+	}
+	delete(w.items, model.Id)
+	return true, nil
+}
+
+func (w *MemoryWebAuthnChallengeStore) DeleteExpired(ctx context.Context, before int64) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var rows int64
+	for id, item := range w.items {
+		if item.ExpiresAt < before {
+			delete(w.items, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *MemoryRecoveryCodeStore) Replace(ctx context.Context, userId int64, items []*models.RecoveryCodeModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleteByUser(userId)
+	now := time.Now().Unix()
+	for _, item := range items {
+		item.UserId = userId
+		item.Created = now
+		item.Id = r.nextId()
+		c := *item
+		r.items[c.Id] = &c
+	}
+	return nil
+}
+
+func (r *MemoryRecoveryCodeStore) Use(ctx context.Context, userId int64, hash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, item := range r.items {
+		if item.UserId == userId && item.CodeHash == hash && item.UsedAt == 0 {
+			item.UsedAt = time.Now().Unix()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryRecoveryCodeStore) Remaining(ctx context.Context, userId int64) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var count int64
+	for _, item := range r.items {
+		if item.UserId == userId && item.UsedAt == 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *MemoryRecoveryCodeStore) DeleteByUser(ctx context.Context, userId int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleteByUser(userId)
+	return nil
+}
+
+func (r *MemoryRecoveryCodeStore) deleteByUser(userId int64) {
+	for id, item := range r.items {
+		if item.UserId == userId {
+			delete(r.items, id)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+)
+
+type (
+	MemoryLoginFailureStore struct {
+		memoryTable
+		items map[int64]*models.LoginFailureModel
+	}
+
+	MemoryPasswordHistoryStore struct {
+		memoryTable
+		items map[int64]*models.PasswordHistoryModel
+	}
+
+	MemoryAuditStore struct {
+		memoryTable
+		items map[int64]*models.AuditModel
+	}
+)
+
+func (l *MemoryLoginFailureStore) ByKey(ctx context.Context, scope, key string) (*models.LoginFailureModel, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, item := range l.items {
+		if item.Scope == scope && item.Key == key {
+			c := *item
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (l *MemoryLoginFailureStore) Count(ctx context.Context, scope, key string, since int64) (*models.LoginFailureModel, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now().Unix()
+	var counter *models.LoginFailureModel
+	for _, item := range l.items {
+		if item.Scope == scope && item.Key == key {
+			counter = item
+			break
+		}
+	}
+	if counter == nil {
+		counter = &models.LoginFailureModel{Id: l.nextId(), Scope: scope, Key: key, WindowStart: now}
+		l.items[counter.Id] = counter
+	}
+	if counter.WindowStart < since {
+		counter.Failures = 0
+		counter.WindowStart = now
+	}
+	counter.Failures++
+	counter.Updated = now
+	c := *counter
+	return &c, nil
+}
+
+func (l *MemoryLoginFailureStore) Save(ctx context.Context, model *models.LoginFailureModel) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	model.Updated = time.Now().Unix()
+	if model.Id == 0 {
+		model.Id = l.nextId()
+	}
+	c := *model
+	l.items[c.Id] = &c
+	return nil
+}
+
+func (l *MemoryLoginFailureStore) Reset(ctx context.Context, scope, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, item := range l.items {
+		if item.Scope == scope && item.Key == key {
+			delete(l.items, id)
+		}
+	}
+	return nil
+}
+
+func (p *MemoryPasswordHistoryStore) Add(ctx context.Context, model *models.PasswordHistoryModel) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	model.Created = time.Now().Unix()
+	model.Id = p.nextId()
+	c := *model
+	p.items[c.Id] = &c
+	return nil
+}
+
+func (p *MemoryPasswordHistoryStore) Recent(ctx context.Context, userId int64, limit int) ([]*models.PasswordHistoryModel, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	items := p.byUser(userId)
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	for i, item := range items {
+		c := *item
+		items[i] = &c
+	}
+	return items, nil
+}
+
+func (p *MemoryPasswordHistoryStore) Prune(ctx context.Context, userId int64, keep int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	items := p.byUser(userId)
+	if len(items) <= keep {
+		return nil
+	}
+	for _, item := range items[keep:] {
+		delete(p.items, item.Id)
+	}
+	return nil
+}
+
+// byUser returns the rows of the user newest first, the lock has to be held.
+func (p *MemoryPasswordHistoryStore) byUser(userId int64) []*models.PasswordHistoryModel {
+	var items []*models.PasswordHistoryModel
+	for _, item := range p.items {
+		if item.UserId == userId {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Id > items[j].Id
+	})
+	return items
+}
+
+func (a *MemoryAuditStore) Add(ctx context.Context, item *models.AuditModel) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if item.Created == 0 {
+		item.Created = time.Now().Unix()
+	}
+	item.Id = a.nextId()
+	c := *item
+	a.items[c.Id] = &c
+	return nil
+}
+
+func (a *MemoryAuditStore) Find(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditModel, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	items := a.match(filter)
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Id > items[j].Id
+	})
+	if filter.Offset >= len(items) {
+		return nil, nil
+	}
+	items = items[filter.Offset:]
+	if len(items) > filter.Limit {
+		items = items[:filter.Limit]
+	}
+	for i, item := range items {
+		c := *item
+		items[i] = &c
+	}
+	return items, nil
+}
+
+func (a *MemoryAuditStore) Count(ctx context.Context, filter *models.AuditFilter) (int64, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return int64(len(a.match(filter))), nil
+}
+
+// match returns the rows selected by the filter, the lock has to be held.
+func (a *MemoryAuditStore) match(filter *models.AuditFilter) []*models.AuditModel {
+	var items []*models.AuditModel
+	for _, item := range a.items {
+		switch {
+		case filter.Action != "" && item.Action != filter.Action,
+			filter.Outcome != "" && item.Outcome != filter.Outcome,
+			filter.ActorId != 0 && item.ActorId != filter.ActorId,
+			filter.TargetId != 0 && item.TargetId != filter.TargetId,
+			filter.Subject != "" && item.Subject != filter.Subject,
+			filter.Application != "" && item.Application != filter.Application,
+			filter.Ip != "" && item.Ip != filter.Ip,
+			filter.From != 0 && item.Created < filter.From,
+			filter.To != 0 && item.Created >= filter.To,
+			filter.BeforeId != 0 && item.Id >= filter.BeforeId:
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
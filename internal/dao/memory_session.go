@@ -0,0 +1,258 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+)
+
+type (
+	MemoryAuthorizationCodeStore struct {
+		memoryTable
+		items map[int64]*models.AuthorizationCodeModel
+	}
+
+	MemoryRefreshTokenStore struct {
+		memoryTable
+		items map[int64]*models.RefreshTokenModel
+	}
+
+	MemorySessionStore struct {
+		memoryTable
+		items map[int64]*models.SessionModel
+	}
+
+	MemorySessionClientStore struct {
+		memoryTable
+		items map[int64]*models.SessionClientModel
+	}
+)
+
+func (a *MemoryAuthorizationCodeStore) Create(ctx context.Context, model *models.AuthorizationCodeModel) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	model.Created = time.Now().Unix()
+	model.Id = a.nextId()
+	c := *model
+	a.items[c.Id] = &c
+	return nil
+}
+
+func (a *MemoryAuthorizationCodeStore) ByCode(ctx context.Context, code string) (*models.AuthorizationCodeModel, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, item := range a.items {
+		if item.Code == code {
+			c := *item
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (a *MemoryAuthorizationCodeStore) Consume(ctx context.Context, model *models.AuthorizationCodeModel) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	model.Used = true
+	item, ok := a.items[model.Id]
+	if !ok || item.Used {
+		return false, nil
+	}
+	item.Used = true
+	return true, nil
+}
+
+func (a *MemoryAuthorizationCodeStore) DeleteExpired(ctx context.Context, before int64) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var rows int64
+	for id, item := range a.items {
+		if item.ExpiresAt < before {
+			delete(a.items, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *MemoryRefreshTokenStore) Create(ctx context.Context, model *models.RefreshTokenModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	model.Created = time.Now().Unix()
+	model.Id = r.nextId()
+	c := *model
+	r.items[c.Id] = &c
+	return nil
+}
+
+func (r *MemoryRefreshTokenStore) ByToken(ctx context.Context, token string) (*models.RefreshTokenModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, item := range r.items {
+		if item.Token == token {
+			c := *item
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *MemoryRefreshTokenStore) Consume(ctx context.Context, model *models.RefreshTokenModel) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	model.Used = true
+	item, ok := r.items[model.Id]
+	if !ok || item.Used || item.Revoked {
+		return false, nil
+	}
+	item.Used = true
+	return true, nil
+}
+
+func (r *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, familyId string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for _, item := range r.items {
+		if item.FamilyId == familyId && !item.Revoked {
+			item.Revoked = true
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (r *MemoryRefreshTokenStore) DeleteExpired(ctx context.Context, before int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows int64
+	for id, item := range r.items {
+		if item.ExpiresAt < before {
+			delete(r.items, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (s *MemorySessionStore) Create(ctx context.Context, model *models.SessionModel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	model.Created = time.Now().Unix()
+	model.LastSeen = model.Created
+	model.Id = s.nextId()
+	c := *model
+	s.items[c.Id] = &c
+	return nil
+}
+
+func (s *MemorySessionStore) BySid(ctx context.Context, sid string) (*models.SessionModel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, item := range s.items {
+		if item.Sid == sid {
+			c := *item
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemorySessionStore) ByUser(ctx context.Context, userId int64) ([]*models.SessionModel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now().Unix()
+	var items []*models.SessionModel
+	for _, item := range s.items {
+		if item.UserId == userId && item.IsActive(now) {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].LastSeen > items[j].LastSeen
+	})
+	return items, nil
+}
+
+func (s *MemorySessionStore) Touch(ctx context.Context, model *models.SessionModel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	model.LastSeen = time.Now().Unix()
+	if item, ok := s.items[model.Id]; ok {
+		item.LastSeen = model.LastSeen
+		item.ExpiresAt = model.ExpiresAt
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) Revoke(ctx context.Context, sid string) (int64, error) {
+	return s.revoke(func(item *models.SessionModel) bool {
+		return item.Sid == sid
+	}), nil
+}
+
+func (s *MemorySessionStore) RevokeByUser(ctx context.Context, userId int64) (int64, error) {
+	return s.revoke(func(item *models.SessionModel) bool {
+		return item.UserId == userId
+	}), nil
+}
+
+func (s *MemorySessionStore) DeleteExpired(ctx context.Context, before int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows int64
+	for id, item := range s.items {
+		if item.ExpiresAt < before {
+			delete(s.items, id)
+			rows++
+		}
+	}
+	return rows, nil
+}
+
+func (s *MemorySessionStore) revoke(match func(*models.SessionModel) bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows int64
+	for _, item := range s.items {
+		if !item.Revoked && match(item) {
+			item.Revoked = true
+			rows++
+		}
+	}
+	return rows
+}
+
+func (s *MemorySessionClientStore) Add(ctx context.Context, model *models.SessionClientModel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	model.Created = time.Now().Unix()
+	for _, item := range s.items {
+		if item.Sid == model.Sid && item.ClientId == model.ClientId {
+			return nil
+		}
+	}
+	model.Id = s.nextId()
+	c := *model
+	s.items[c.Id] = &c
+	return nil
+}
+
+func (s *MemorySessionClientStore) BySid(ctx context.Context, sid string) ([]*models.SessionClientModel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var items []*models.SessionClientModel
+	for _, item := range s.items {
+		if item.Sid == sid {
+			c := *item
+			items = append(items, &c)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Id < items[j].Id
+	})
+	return items, nil
+}
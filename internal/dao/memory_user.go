@@ -0,0 +1,195 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+)
+
+type (
+	MemoryUserStore struct {
+		memoryTable
+		items  map[int64]*models.UserModel
+		hasher internal.PasswordHasher
+	}
+
+	MemoryApplicationStore struct {
+		memoryTable
+		items map[int64]*models.ApplicationModel
+	}
+)
+
+func (u *MemoryUserStore) ById(ctx context.Context, id int64) (*models.UserModel, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if item, ok := u.items[id]; ok {
+		c := *item
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (u *MemoryUserStore) ByEmail(ctx context.Context, email string) (*models.UserModel, error) {
+	return u.find(func(item *models.UserModel) bool {
+		return item.Email == email
+	}), nil
+}
+
+func (u *MemoryUserStore) ByCode(ctx context.Context, code string) (*models.UserModel, error) {
+	return u.find(func(item *models.UserModel) bool {
+		return item.Code == code
+	}), nil
+}
+
+func (u *MemoryUserStore) Authenticate(ctx context.Context, email string, password string) (*models.UserModel, error) {
+	item, err := u.ByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyUser(u.hasher, item, password); err != nil {
+		return nil, err
+	}
+	if u.hasher.NeedsRehash(item.Password) {
+		// the sign in does not fail if the upgrade does, the old hash is still valid
+		_ = u.rehash(ctx, item, password)
+	}
+	return item, nil
+}
+
+func (u *MemoryUserStore) Create(ctx context.Context, user *models.UserModel) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, item := range u.items {
+		if item.Email == user.Email {
+			return fmt.Errorf("%w: email %s", models.ErrAlreadyExists, user.Email)
+		}
+	}
+	user.Created = time.Now().Unix()
+	user.Id = u.nextId()
+	c := *user
+	u.items[c.Id] = &c
+	return nil
+}
+
+func (u *MemoryUserStore) Update(ctx context.Context, user *models.UserModel) (int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user.Updated = time.Now().Unix()
+	if _, ok := u.items[user.Id]; !ok {
+		return 0, nil
+	}
+	c := *user
+	u.items[c.Id] = &c
+	return 1, nil
+}
+
+func (u *MemoryUserStore) Delete(ctx context.Context, user *models.UserModel) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.items, user.Id)
+	return nil
+}
+
+// rehash replaces the outdated password hash of the user with the one made by the configured algorithm.
+func (u *MemoryUserStore) rehash(ctx context.Context, user *models.UserModel, password string) error {
+	hash, err := u.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if item, ok := u.items[user.Id]; ok && item.Password == user.Password {
+		item.Password = hash
+	}
+	user.Password = hash
+	return nil
+}
+
+func (u *MemoryUserStore) find(match func(*models.UserModel) bool) *models.UserModel {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for _, item := range u.items {
+		if match(item) {
+			c := *item
+			return &c
+		}
+	}
+	return nil
+}
+
+func (a *MemoryApplicationStore) ById(ctx context.Context, id int64) (*models.ApplicationModel, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if item, ok := a.items[id]; ok {
+		c := *item
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (a *MemoryApplicationStore) ByCode(ctx context.Context, code string) (*models.ApplicationModel, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, item := range a.items {
+		if item.Code == code {
+			c := *item
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (a *MemoryApplicationStore) Create(ctx context.Context, model *models.ApplicationModel) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, item := range a.items {
+		if item.Code == model.Code {
+			return fmt.Errorf("%w: application code %s", models.ErrAlreadyExists, model.Code)
+		}
+	}
+	model.Created = time.Now().Unix()
+	model.Id = a.nextId()
+	c := *model
+	a.items[c.Id] = &c
+	return nil
+}
+
+func (a *MemoryApplicationStore) Update(ctx context.Context, model *models.ApplicationModel) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	model.Updated = time.Now().Unix()
+	if _, ok := a.items[model.Id]; !ok {
+		return 0, nil
+	}
+	c := *model
+	a.items[c.Id] = &c
+	return 1, nil
+}
+
+func (a *MemoryApplicationStore) Delete(ctx context.Context, model *models.ApplicationModel) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.items[model.Id]; !ok {
+		return 0, nil
+	}
+	delete(a.items, model.Id)
+	return 1, nil
+}
+
+func (a *MemoryApplicationStore) List(ctx context.Context) ([]*models.ApplicationModel, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	items := make([]*models.ApplicationModel, 0, len(a.items))
+	for _, item := range a.items {
+		c := *item
+		items = append(items, &c)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Id < items[j].Id
+	})
+	return items, nil
+}
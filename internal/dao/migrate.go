@@ -0,0 +1,326 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gorp/gorp/v3"
+)
+
+const (
+	// migrationLock is the mysql named lock held by the instance which migrates the database
+	migrationLock        = "go-sso-migrate"
+	migrationLockTimeout = 60
+	// migrationLockKey is the postgres advisory lock key, "go-sso" in hex
+	migrationLockKey int64 = 0x676f2d73736f
+)
+
+// migrationFiles keeps the scripts of every driver in migrations/<driver>/<version>_<name>.(up|down).sql,
+// statements of the script end with ; at the end of the line. A migration without the down script cannot be
+// reverted, like the baseline which adopts the tables created before the migrations.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type (
+	// Migration is the versioned schema change with its up and down scripts.
+	Migration struct {
+		Version int64
+		Name    string
+		up      string
+		down    string
+	}
+
+	// MigrationStatus tells when the migration was applied, Applied is zero while it is pending.
+	MigrationStatus struct {
+		*Migration
+		Applied int64
+	}
+
+	// Migrator applies the embedded migrations of the driver, the applied versions are recorded in the
+	// schema_migrations table. Concurrent instances wait for the database lock, sqlite has none, there the second
+	// instance fails on the version recorded by the first one.
+	Migrator struct {
+		db         *sql.DB
+		driver     string
+		dialect    gorp.Dialect
+		migrations []*Migration
+	}
+)
+
+func NewMigrator(db *sql.DB, driver string) (*Migrator, error) {
+	dialect, err := newDialect(driver)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		driver:     driver,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// Up applies the pending migrations in order and returns them.
+func (m *Migrator) Up() ([]*Migration, error) {
+	var done []*Migration
+	err := m.locked(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			query := "INSERT INTO `schema_migrations` (`version`, `name`, `applied_at`) VALUES (?, ?, ?)"
+			if err = m.apply(ctx, conn, migration.up, query, migration.Version, migration.Name, time.Now().Unix()); err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts up to the given number of the latest applied migrations and returns them.
+func (m *Migrator) Down(steps int) ([]*Migration, error) {
+	var done []*Migration
+	err := m.locked(func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		var revert []*Migration
+		for i := len(m.migrations) - 1; i >= 0 && len(revert) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			// nothing is reverted when the steps reach the migration which cannot be
+			if migration.down == "" {
+				return fmt.Errorf("migration %s cannot be reverted", migration)
+			}
+			revert = append(revert, migration)
+		}
+		for _, migration := range revert {
+			query := "DELETE FROM `schema_migrations` WHERE `version`=?"
+			if err = m.apply(ctx, conn, migration.down, query, migration.Version); err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists the migrations in order with the time they were applied.
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = m.createTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		items = append(items, &MigrationStatus{Migration: migration, Applied: applied[migration.Version]})
+	}
+	return items, nil
+}
+
+// Pending returns the migrations which are not applied yet.
+func (m *Migrator) Pending() ([]*Migration, error) {
+	items, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	var pending []*Migration
+	for _, item := range items {
+		if item.Applied == 0 {
+			pending = append(pending, item.Migration)
+		}
+	}
+	return pending, nil
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// locked runs fn on the connection which holds the migration lock.
+func (m *Migrator) locked(fn func(context.Context, *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch m.driver {
+	case DriverMysql:
+		var locked sql.NullInt64
+		if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLock, migrationLockTimeout).Scan(&locked); err != nil {
+			return err
+		}
+		if locked.Int64 != 1 {
+			return errors.New("timeout waiting for the migration lock")
+		}
+		defer func() {
+			_ = conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", migrationLock).Scan(&locked)
+		}()
+	case DriverPostgres:
+		if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return err
+		}
+		defer func() {
+			_, _ = conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		}()
+	}
+
+	if err = m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(ctx, conn)
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	query := "CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` bigint NOT NULL PRIMARY KEY, `name` varchar(255) NOT NULL, `applied_at` bigint NOT NULL)"
+	_, err := conn.ExecContext(ctx, rewrite(m.dialect, query))
+	return err
+}
+
+// applied returns the time of every applied version.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]int64, error) {
+	rows, err := conn.QueryContext(ctx, rewrite(m.dialect, "SELECT `version`, `applied_at` FROM `schema_migrations`"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]int64{}
+	for rows.Next() {
+		var version, at int64
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// apply runs the script and records it in one transaction, mysql commits every schema change implicitly,
+// so there a failed script may be left half applied.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements(script) {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, rewrite(m.dialect, record), args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func loadMigrations(driver string) ([]*Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s/%s", dir, entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("duplicate migration version %s/%s", dir, entry.Name())
+		}
+		if match[3] == "up" {
+			migration.up = string(data)
+		} else {
+			migration.down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" {
+			return nil, fmt.Errorf("migration %s/%s has no up script", dir, migration)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// statements splits the script into its statements, comment lines are skipped.
+func statements(script string) []string {
+	var items []string
+	var b strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			items = append(items, strings.TrimSuffix(strings.TrimSpace(b.String()), ";"))
+			b.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(b.String()); rest != "" {
+		items = append(items, rest)
+	}
+	return items
+}
@@ -0,0 +1,138 @@
+package dao_test
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/dao"
+	"github.com/MiG-21/go-sso/internal/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migrator", func() {
+	var (
+		config   *internal.Config
+		db       *sql.DB
+		migrator *dao.Migrator
+	)
+
+	BeforeEach(func() {
+		// every spec gets an empty database of its own, it lives as long as the idle connection
+		config = &internal.Config{
+			Database: internal.ConfigDatabase{
+				Driver:       dao.DriverSqlite,
+				Dsn:          "file:" + unique("migrate-") + "?mode=memory&cache=shared",
+				MaxIdleConns: 1,
+			},
+		}
+		var err error
+		db, err = dao.OpenDatabase(config)
+		Expect(err).NotTo(HaveOccurred())
+		migrator, err = dao.NewMigrator(db, config.Database.Driver)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = db.Close()
+	})
+
+	It("applies the pending migrations once", func() {
+		pending, err := migrator.Pending()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).NotTo(BeEmpty())
+
+		applied, err := migrator.Up()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(Equal(pending))
+
+		applied, err = migrator.Up()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(BeEmpty())
+
+		items, err := migrator.Status()
+		Expect(err).NotTo(HaveOccurred())
+		for _, item := range items {
+			Expect(item.Applied).NotTo(BeZero())
+		}
+	})
+
+	It("reverts the latest migration", func() {
+		_, err := migrator.Up()
+		Expect(err).NotTo(HaveOccurred())
+
+		reverted, err := migrator.Down(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reverted).To(HaveLen(1))
+		pending, err := migrator.Pending()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(Equal(reverted))
+
+		applied, err := migrator.Up()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(applied).To(Equal(reverted))
+	})
+
+	It("refuses to revert the baseline", func() {
+		_, err := migrator.Up()
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = migrator.Down(2)
+		Expect(err).To(MatchError(ContainSubstring("0001_initial cannot be reverted")))
+		pending, err := migrator.Pending()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending).To(BeEmpty())
+	})
+
+	It("upgrades the tables created before the migrations", func() {
+		// the tables and the row as the releases before the migrations left them
+		for _, statement := range []string{
+			`CREATE TABLE "users" ("id" integer not null primary key autoincrement, "name" varchar(255), "email" varchar(255),
+				"password" varchar(100), "gender" varchar(50), "data" varchar(2048), "role" varchar(100), "active" integer,
+				"locked" integer, "locked_to" integer, "verification_code" varchar(50), "created_at" integer,
+				"updated_at" integer, "last_visit_at" integer)`,
+			`CREATE UNIQUE INDEX "idx_email" ON "users" ("email")`,
+			`CREATE TABLE "applications" ("id" integer not null primary key autoincrement, "application" varchar(255),
+				"domain" varchar(255), "redirect_url" varchar(255), "code" varchar(50), "created_at" integer,
+				"updated_at" integer)`,
+			`INSERT INTO "users" VALUES (1, 'Old', 'old@example.com', 'hash', '', '', 'user', 1, 0, 0, '', 1, 1, 1)`,
+			`INSERT INTO "applications" VALUES (1, 'Old', 'example.com', 'https://example.com/cb', 'old', 1, 1)`,
+		} {
+			_, err := db.Exec(statement)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		config.Database.Migrate = true
+		sr := dao.SetupDao(config)
+		Expect(sr.Error).NotTo(HaveOccurred())
+		ctx := context.Background()
+
+		user, err := sr.SSOer.UserManager().ById(ctx, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.Email).To(Equal("old@example.com"))
+		Expect(user.MfaEnabled).To(BeFalse())
+		user.MfaEnabled = true
+		_, err = sr.SSOer.UserManager().Update(ctx, user)
+		Expect(err).NotTo(HaveOccurred())
+
+		app, err := sr.SSOer.ApplicationManager().ByCode(ctx, "old")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(app.RedirectUriList()).To(Equal([]string{"https://example.com/cb"}))
+		app.RedirectUris = "https://example.com/other"
+		_, err = sr.SSOer.ApplicationManager().Update(ctx, app)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(sr.SSOer.SessionManager().Create(ctx, &models.SessionModel{Sid: "sid", UserId: user.Id})).To(Succeed())
+	})
+
+	It("refuses the outdated schema when the startup migration is disabled", func() {
+		sr := dao.SetupDao(config)
+		Expect(sr.Error).To(MatchError(ContainSubstring("migrations are pending")))
+
+		_, err := migrator.Up()
+		Expect(err).NotTo(HaveOccurred())
+		sr = dao.SetupDao(config)
+		Expect(sr.Error).NotTo(HaveOccurred())
+	})
+})
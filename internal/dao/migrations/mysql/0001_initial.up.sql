@@ -0,0 +1,33 @@
+-- baseline schema, the users and applications tables gorp used to create before the migrations, so existing
+-- databases are adopted as they are, it cannot be reverted
+
+CREATE TABLE IF NOT EXISTS `users` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `name` varchar(255),
+    `email` varchar(255),
+    `password` varchar(100),
+    `gender` varchar(50),
+    `data` text,
+    `role` varchar(100),
+    `active` boolean,
+    `locked` boolean,
+    `locked_to` bigint,
+    `verification_code` varchar(50),
+    `created_at` bigint,
+    `updated_at` bigint,
+    `last_visit_at` bigint,
+    UNIQUE KEY `idx_email` (`email`),
+    KEY `idx_login` (`email`, `password`),
+    KEY `idx_verification` (`verification_code`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS `applications` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `application` varchar(255),
+    `domain` varchar(255),
+    `redirect_url` varchar(255),
+    `code` varchar(50),
+    `created_at` bigint,
+    `updated_at` bigint,
+    UNIQUE KEY `idx_code` (`code`)
+) ENGINE=INNODB CHARSET=UTF8;
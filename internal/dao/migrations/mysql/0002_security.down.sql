@@ -0,0 +1,21 @@
+DROP TABLE IF EXISTS `audit_log`;
+DROP TABLE IF EXISTS `user_password_history`;
+DROP TABLE IF EXISTS `login_failures`;
+DROP TABLE IF EXISTS `user_recovery_codes`;
+DROP TABLE IF EXISTS `webauthn_challenges`;
+DROP TABLE IF EXISTS `webauthn_credentials`;
+DROP TABLE IF EXISTS `user_totp`;
+DROP TABLE IF EXISTS `session_clients`;
+DROP TABLE IF EXISTS `sessions`;
+DROP TABLE IF EXISTS `refresh_tokens`;
+DROP TABLE IF EXISTS `authorization_codes`;
+ALTER TABLE `applications`
+    DROP `frontchannel_logout_url`,
+    DROP `backchannel_logout_url`,
+    DROP `redirect_uris`,
+    DROP `post_logout_redirect_uris`,
+    DROP `public_url`;
+-- the password column stays wide, narrowing it would truncate the argon2id hashes
+ALTER TABLE `users`
+    DROP `mfa_enabled`,
+    DROP `password_changed_at`;
@@ -0,0 +1,163 @@
+-- oauth clients, sessions, mfa and security tables, the password column grows for the argon2id hashes
+
+ALTER TABLE `users`
+    MODIFY `password` varchar(255),
+    ADD `mfa_enabled` boolean,
+    ADD `password_changed_at` bigint;
+ALTER TABLE `applications`
+    ADD `frontchannel_logout_url` varchar(255),
+    ADD `backchannel_logout_url` varchar(255),
+    ADD `redirect_uris` text,
+    ADD `post_logout_redirect_uris` text,
+    ADD `public_url` varchar(255);
+-- the rows of the baseline get the values the models expect instead of null
+UPDATE `users` SET `mfa_enabled`=false, `password_changed_at`=0;
+UPDATE `applications` SET `frontchannel_logout_url`='', `backchannel_logout_url`='', `redirect_uris`='', `post_logout_redirect_uris`='', `public_url`='';
+
+CREATE TABLE `authorization_codes` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `code` varchar(64),
+    `client_id` varchar(50),
+    `user_id` bigint,
+    `session_id` varchar(36),
+    `redirect_uri` varchar(255),
+    `scope` varchar(255),
+    `code_challenge` varchar(128),
+    `code_challenge_method` varchar(10),
+    `nonce` varchar(255),
+    `auth_time` bigint,
+    `used` boolean,
+    `expires_at` bigint,
+    `created_at` bigint,
+    UNIQUE KEY `idx_code` (`code`),
+    KEY `idx_expires` (`expires_at`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `refresh_tokens` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `token` varchar(64),
+    `family_id` varchar(36),
+    `parent_id` bigint,
+    `client_id` varchar(50),
+    `user_id` bigint,
+    `session_id` varchar(36),
+    `scope` varchar(255),
+    `used` boolean,
+    `revoked` boolean,
+    `expires_at` bigint,
+    `created_at` bigint,
+    UNIQUE KEY `idx_token` (`token`),
+    KEY `idx_family` (`family_id`),
+    KEY `idx_expires` (`expires_at`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `sessions` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `sid` varchar(36),
+    `user_id` bigint,
+    `client_id` varchar(50),
+    `ip` varchar(45),
+    `user_agent` varchar(255),
+    `revoked` boolean,
+    `mfa` boolean,
+    `expires_at` bigint,
+    `created_at` bigint,
+    `last_seen_at` bigint,
+    UNIQUE KEY `idx_sid` (`sid`),
+    KEY `idx_user` (`user_id`),
+    KEY `idx_expires` (`expires_at`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `session_clients` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `sid` varchar(36),
+    `client_id` varchar(50),
+    `created_at` bigint,
+    UNIQUE KEY `idx_sid_client` (`sid`, `client_id`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `user_totp` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `user_id` bigint,
+    `secret` varchar(255),
+    `confirmed` boolean,
+    `last_counter` bigint,
+    `created_at` bigint,
+    UNIQUE KEY `idx_user` (`user_id`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `webauthn_credentials` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `user_id` bigint,
+    `credential_id` varchar(255),
+    `public_key` mediumblob,
+    `attestation_type` varchar(50),
+    `aaguid` mediumblob,
+    `sign_count` bigint,
+    `name` varchar(100),
+    `created_at` bigint,
+    `last_used_at` bigint,
+    UNIQUE KEY `idx_credential` (`credential_id`),
+    KEY `idx_user` (`user_id`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `webauthn_challenges` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `challenge` varchar(100),
+    `user_id` bigint,
+    `ceremony` varchar(20),
+    `data` text,
+    `expires_at` bigint,
+    `created_at` bigint,
+    UNIQUE KEY `idx_challenge` (`challenge`),
+    KEY `idx_expires` (`expires_at`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `user_recovery_codes` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `user_id` bigint,
+    `code_hash` varchar(64),
+    `used_at` bigint,
+    `created_at` bigint,
+    UNIQUE KEY `idx_user_code` (`user_id`, `code_hash`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `login_failures` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `scope` varchar(10),
+    `key` varchar(255),
+    `failures` bigint,
+    `lockouts` bigint,
+    `window_start` bigint,
+    `blocked_to` bigint,
+    `updated_at` bigint,
+    UNIQUE KEY `idx_scope_key` (`scope`, `key`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `user_password_history` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `user_id` bigint,
+    `password` varchar(255),
+    `created_at` bigint,
+    KEY `idx_user` (`user_id`)
+) ENGINE=INNODB CHARSET=UTF8;
+
+CREATE TABLE `audit_log` (
+    `id` bigint NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `action` varchar(50),
+    `outcome` varchar(20),
+    `actor_id` bigint,
+    `target_id` bigint,
+    `subject` varchar(255),
+    `application` varchar(50),
+    `ip` varchar(45),
+    `user_agent` varchar(255),
+    `request_id` varchar(64),
+    `detail` text,
+    `created_at` bigint,
+    KEY `idx_action` (`action`, `created_at`),
+    KEY `idx_actor` (`actor_id`),
+    KEY `idx_target` (`target_id`),
+    KEY `idx_subject` (`subject`),
+    KEY `idx_created` (`created_at`)
+) ENGINE=INNODB CHARSET=UTF8;
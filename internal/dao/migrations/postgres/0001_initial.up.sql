@@ -0,0 +1,33 @@
+-- baseline schema, the users and applications tables gorp used to create before the migrations, so existing
+-- databases are adopted as they are, it cannot be reverted
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "name" varchar(255),
+    "email" varchar(255),
+    "password" varchar(100),
+    "gender" varchar(50),
+    "data" varchar(2048),
+    "role" varchar(100),
+    "active" boolean,
+    "locked" boolean,
+    "locked_to" bigint,
+    "verification_code" varchar(50),
+    "created_at" bigint,
+    "updated_at" bigint,
+    "last_visit_at" bigint
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "users_idx_email" ON "users" ("email");
+CREATE INDEX IF NOT EXISTS "users_idx_login" ON "users" ("email", "password");
+CREATE INDEX IF NOT EXISTS "users_idx_verification" ON "users" ("verification_code");
+
+CREATE TABLE IF NOT EXISTS "applications" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "application" varchar(255),
+    "domain" varchar(255),
+    "redirect_url" varchar(255),
+    "code" varchar(50),
+    "created_at" bigint,
+    "updated_at" bigint
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "applications_idx_code" ON "applications" ("code");
@@ -0,0 +1,161 @@
+-- oauth clients, sessions, mfa and security tables, the password column grows for the argon2id hashes
+
+ALTER TABLE "users" ALTER COLUMN "password" TYPE varchar(255);
+ALTER TABLE "users" ADD COLUMN "mfa_enabled" boolean;
+ALTER TABLE "users" ADD COLUMN "password_changed_at" bigint;
+ALTER TABLE "applications" ADD COLUMN "frontchannel_logout_url" varchar(255);
+ALTER TABLE "applications" ADD COLUMN "backchannel_logout_url" varchar(255);
+ALTER TABLE "applications" ADD COLUMN "redirect_uris" varchar(2048);
+ALTER TABLE "applications" ADD COLUMN "post_logout_redirect_uris" varchar(2048);
+ALTER TABLE "applications" ADD COLUMN "public_url" varchar(255);
+-- the rows of the baseline get the values the models expect instead of null
+UPDATE "users" SET "mfa_enabled"=false, "password_changed_at"=0;
+UPDATE "applications" SET "frontchannel_logout_url"='', "backchannel_logout_url"='', "redirect_uris"='', "post_logout_redirect_uris"='', "public_url"='';
+
+CREATE TABLE "authorization_codes" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "code" varchar(64),
+    "client_id" varchar(50),
+    "user_id" bigint,
+    "session_id" varchar(36),
+    "redirect_uri" varchar(255),
+    "scope" varchar(255),
+    "code_challenge" varchar(128),
+    "code_challenge_method" varchar(10),
+    "nonce" varchar(255),
+    "auth_time" bigint,
+    "used" boolean,
+    "expires_at" bigint,
+    "created_at" bigint
+);
+CREATE UNIQUE INDEX "authorization_codes_idx_code" ON "authorization_codes" ("code");
+CREATE INDEX "authorization_codes_idx_expires" ON "authorization_codes" ("expires_at");
+
+CREATE TABLE "refresh_tokens" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "token" varchar(64),
+    "family_id" varchar(36),
+    "parent_id" bigint,
+    "client_id" varchar(50),
+    "user_id" bigint,
+    "session_id" varchar(36),
+    "scope" varchar(255),
+    "used" boolean,
+    "revoked" boolean,
+    "expires_at" bigint,
+    "created_at" bigint
+);
+CREATE UNIQUE INDEX "refresh_tokens_idx_token" ON "refresh_tokens" ("token");
+CREATE INDEX "refresh_tokens_idx_family" ON "refresh_tokens" ("family_id");
+CREATE INDEX "refresh_tokens_idx_expires" ON "refresh_tokens" ("expires_at");
+
+CREATE TABLE "sessions" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "sid" varchar(36),
+    "user_id" bigint,
+    "client_id" varchar(50),
+    "ip" varchar(45),
+    "user_agent" varchar(255),
+    "revoked" boolean,
+    "mfa" boolean,
+    "expires_at" bigint,
+    "created_at" bigint,
+    "last_seen_at" bigint
+);
+CREATE UNIQUE INDEX "sessions_idx_sid" ON "sessions" ("sid");
+CREATE INDEX "sessions_idx_user" ON "sessions" ("user_id");
+CREATE INDEX "sessions_idx_expires" ON "sessions" ("expires_at");
+
+CREATE TABLE "session_clients" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "sid" varchar(36),
+    "client_id" varchar(50),
+    "created_at" bigint
+);
+CREATE UNIQUE INDEX "session_clients_idx_sid_client" ON "session_clients" ("sid", "client_id");
+
+CREATE TABLE "user_totp" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "user_id" bigint,
+    "secret" varchar(255),
+    "confirmed" boolean,
+    "last_counter" bigint,
+    "created_at" bigint
+);
+CREATE UNIQUE INDEX "user_totp_idx_user" ON "user_totp" ("user_id");
+
+CREATE TABLE "webauthn_credentials" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "user_id" bigint,
+    "credential_id" varchar(255),
+    "public_key" bytea,
+    "attestation_type" varchar(50),
+    "aaguid" bytea,
+    "sign_count" bigint,
+    "name" varchar(100),
+    "created_at" bigint,
+    "last_used_at" bigint
+);
+CREATE UNIQUE INDEX "webauthn_credentials_idx_credential" ON "webauthn_credentials" ("credential_id");
+CREATE INDEX "webauthn_credentials_idx_user" ON "webauthn_credentials" ("user_id");
+
+CREATE TABLE "webauthn_challenges" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "challenge" varchar(100),
+    "user_id" bigint,
+    "ceremony" varchar(20),
+    "data" varchar(4096),
+    "expires_at" bigint,
+    "created_at" bigint
+);
+CREATE UNIQUE INDEX "webauthn_challenges_idx_challenge" ON "webauthn_challenges" ("challenge");
+CREATE INDEX "webauthn_challenges_idx_expires" ON "webauthn_challenges" ("expires_at");
+
+CREATE TABLE "user_recovery_codes" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "user_id" bigint,
+    "code_hash" varchar(64),
+    "used_at" bigint,
+    "created_at" bigint
+);
+CREATE UNIQUE INDEX "user_recovery_codes_idx_user_code" ON "user_recovery_codes" ("user_id", "code_hash");
+
+CREATE TABLE "login_failures" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "scope" varchar(10),
+    "key" varchar(255),
+    "failures" bigint,
+    "lockouts" bigint,
+    "window_start" bigint,
+    "blocked_to" bigint,
+    "updated_at" bigint
+);
+CREATE UNIQUE INDEX "login_failures_idx_scope_key" ON "login_failures" ("scope", "key");
+
+CREATE TABLE "user_password_history" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "user_id" bigint,
+    "password" varchar(255),
+    "created_at" bigint
+);
+CREATE INDEX "user_password_history_idx_user" ON "user_password_history" ("user_id");
+
+CREATE TABLE "audit_log" (
+    "id" bigserial NOT NULL PRIMARY KEY,
+    "action" varchar(50),
+    "outcome" varchar(20),
+    "actor_id" bigint,
+    "target_id" bigint,
+    "subject" varchar(255),
+    "application" varchar(50),
+    "ip" varchar(45),
+    "user_agent" varchar(255),
+    "request_id" varchar(64),
+    "detail" varchar(1024),
+    "created_at" bigint
+);
+CREATE INDEX "audit_log_idx_action" ON "audit_log" ("action", "created_at");
+CREATE INDEX "audit_log_idx_actor" ON "audit_log" ("actor_id");
+CREATE INDEX "audit_log_idx_target" ON "audit_log" ("target_id");
+CREATE INDEX "audit_log_idx_subject" ON "audit_log" ("subject");
+CREATE INDEX "audit_log_idx_created" ON "audit_log" ("created_at");
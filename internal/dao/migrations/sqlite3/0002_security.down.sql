@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS "audit_log";
+DROP TABLE IF EXISTS "user_password_history";
+DROP TABLE IF EXISTS "login_failures";
+DROP TABLE IF EXISTS "user_recovery_codes";
+DROP TABLE IF EXISTS "webauthn_challenges";
+DROP TABLE IF EXISTS "webauthn_credentials";
+DROP TABLE IF EXISTS "user_totp";
+DROP TABLE IF EXISTS "session_clients";
+DROP TABLE IF EXISTS "sessions";
+DROP TABLE IF EXISTS "refresh_tokens";
+DROP TABLE IF EXISTS "authorization_codes";
+ALTER TABLE "applications" DROP COLUMN "frontchannel_logout_url";
+ALTER TABLE "applications" DROP COLUMN "backchannel_logout_url";
+ALTER TABLE "applications" DROP COLUMN "redirect_uris";
+ALTER TABLE "applications" DROP COLUMN "post_logout_redirect_uris";
+ALTER TABLE "applications" DROP COLUMN "public_url";
+-- the password column stays wide, narrowing it would truncate the argon2id hashes
+ALTER TABLE "users" DROP COLUMN "mfa_enabled";
+ALTER TABLE "users" DROP COLUMN "password_changed_at";
@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	PasswordHistoryStore struct {
+		Store
+	}
+)
+
+func (p *PasswordHistoryStore) Add(ctx context.Context, item *models.PasswordHistoryModel) error {
+	item.Created = time.Now().Unix()
+	return p.exec(ctx).Insert(item)
+}
+
+func (p *PasswordHistoryStore) Recent(ctx context.Context, userId int64, limit int) ([]*models.PasswordHistoryModel, error) {
+	var items []*models.PasswordHistoryModel
+	query := p.query("SELECT * FROM `%s` WHERE `user_id`=? ORDER BY `id` DESC LIMIT ?", p.tableName)
+	if _, err := p.exec(ctx).Select(&items, query, userId, limit); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (p *PasswordHistoryStore) Prune(ctx context.Context, userId int64, keep int) error {
+	// the derived table works around the LIMIT in IN subquery restriction of mysql
+	query := p.query("DELETE FROM `%[1]s` WHERE `user_id`=? AND `id` NOT IN "+
+		"(SELECT `id` FROM (SELECT `id` FROM `%[1]s` WHERE `user_id`=? ORDER BY `id` DESC LIMIT ?) AS `recent`)", p.tableName)
+	_, err := p.execute(ctx, query, userId, userId, keep)
+	return err
+}
+
+func setupPasswordHistoryStore(db *gorp.DbMap) (*PasswordHistoryStore, error) {
+	store := &PasswordHistoryStore{
+		Store{
+			db:        db,
+			tableName: "user_password_history",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.PasswordHistoryModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
@@ -0,0 +1,67 @@
+package dao
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	RecoveryCodeStore struct {
+		Store
+	}
+)
+
+func (r *RecoveryCodeStore) Replace(ctx context.Context, userId int64, items []*models.RecoveryCodeModel) error {
+	return r.transaction(ctx, func(ctx context.Context) error {
+		if err := r.DeleteByUser(ctx, userId); err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		for _, item := range items {
+			item.UserId = userId
+			item.Created = now
+			if err := r.exec(ctx).Insert(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *RecoveryCodeStore) Use(ctx context.Context, userId int64, hash string) (bool, error) {
+	query := r.query("UPDATE `%s` SET `used_at`=? WHERE `user_id`=? AND `code_hash`=? AND `used_at`=0", r.tableName)
+	rows, err := r.affected(ctx, query, time.Now().Unix(), userId, hash)
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (r *RecoveryCodeStore) Remaining(ctx context.Context, userId int64) (int64, error) {
+	query := r.query("SELECT COUNT(*) FROM `%s` WHERE `user_id`=? AND `used_at`=0", r.tableName)
+	return r.exec(ctx).SelectInt(query, userId)
+}
+
+func (r *RecoveryCodeStore) DeleteByUser(ctx context.Context, userId int64) error {
+	query := r.query("DELETE FROM `%s` WHERE `user_id`=?", r.tableName)
+	_, err := r.execute(ctx, query, userId)
+	return err
+}
+
+func setupRecoveryCodeStore(db *gorp.DbMap) (*RecoveryCodeStore, error) {
+	store := &RecoveryCodeStore{
+		Store{
+			db:        db,
+			tableName: "user_recovery_codes",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.RecoveryCodeModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
@@ -0,0 +1,70 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	RefreshTokenStore struct {
+		Store
+	}
+)
+
+func (r *RefreshTokenStore) Create(ctx context.Context, model *models.RefreshTokenModel) error {
+	model.Created = time.Now().Unix()
+	return r.exec(ctx).Insert(model)
+}
+
+func (r *RefreshTokenStore) ByToken(ctx context.Context, token string) (*models.RefreshTokenModel, error) {
+	query := r.query("SELECT * FROM `%s` WHERE `token`=? LIMIT 1", r.tableName)
+	item := &models.RefreshTokenModel{}
+	err := r.exec(ctx).SelectOne(item, query, token)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return item, nil
+	default:
+		return nil, err
+	}
+}
+
+func (r *RefreshTokenStore) Consume(ctx context.Context, model *models.RefreshTokenModel) (bool, error) {
+	query := r.query("UPDATE `%s` SET `used`=? WHERE `id`=? AND `used`=? AND `revoked`=?", r.tableName)
+	rows, err := r.affected(ctx, query, true, model.Id, false, false)
+	if err != nil {
+		return false, err
+	}
+	model.Used = true
+	return rows == 1, nil
+}
+
+func (r *RefreshTokenStore) RevokeFamily(ctx context.Context, familyId string) (int64, error) {
+	query := r.query("UPDATE `%s` SET `revoked`=? WHERE `family_id`=? AND `revoked`=?", r.tableName)
+	return r.affected(ctx, query, true, familyId, false)
+}
+
+func (r *RefreshTokenStore) DeleteExpired(ctx context.Context, before int64) (int64, error) {
+	query := r.query("DELETE FROM `%s` WHERE `expires_at`<?", r.tableName)
+	return r.affected(ctx, query, before)
+}
+
+func setupRefreshTokenStore(db *gorp.DbMap) (*RefreshTokenStore, error) {
+	store := &RefreshTokenStore{
+		Store{
+			db:        db,
+			tableName: "refresh_tokens",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.RefreshTokenModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
@@ -0,0 +1,82 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	SessionStore struct {
+		Store
+	}
+)
+
+func (s *SessionStore) Create(ctx context.Context, model *models.SessionModel) error {
+	model.Created = time.Now().Unix()
+	model.LastSeen = model.Created
+	return s.exec(ctx).Insert(model)
+}
+
+func (s *SessionStore) BySid(ctx context.Context, sid string) (*models.SessionModel, error) {
+	query := s.query("SELECT * FROM `%s` WHERE `sid`=? LIMIT 1", s.tableName)
+	item := &models.SessionModel{}
+	err := s.exec(ctx).SelectOne(item, query, sid)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return item, nil
+	default:
+		return nil, err
+	}
+}
+
+func (s *SessionStore) ByUser(ctx context.Context, userId int64) ([]*models.SessionModel, error) {
+	var items []*models.SessionModel
+	query := s.query("SELECT * FROM `%s` WHERE `user_id`=? AND `revoked`=? AND `expires_at`>=? ORDER BY `last_seen_at` DESC", s.tableName)
+	if _, err := s.exec(ctx).Select(&items, query, userId, false, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *SessionStore) Touch(ctx context.Context, model *models.SessionModel) error {
+	model.LastSeen = time.Now().Unix()
+	query := s.query("UPDATE `%s` SET `last_seen_at`=?, `expires_at`=? WHERE `id`=?", s.tableName)
+	_, err := s.execute(ctx, query, model.LastSeen, model.ExpiresAt, model.Id)
+	return err
+}
+
+func (s *SessionStore) Revoke(ctx context.Context, sid string) (int64, error) {
+	query := s.query("UPDATE `%s` SET `revoked`=? WHERE `sid`=? AND `revoked`=?", s.tableName)
+	return s.affected(ctx, query, true, sid, false)
+}
+
+func (s *SessionStore) RevokeByUser(ctx context.Context, userId int64) (int64, error) {
+	query := s.query("UPDATE `%s` SET `revoked`=? WHERE `user_id`=? AND `revoked`=?", s.tableName)
+	return s.affected(ctx, query, true, userId, false)
+}
+
+func (s *SessionStore) DeleteExpired(ctx context.Context, before int64) (int64, error) {
+	query := s.query("DELETE FROM `%s` WHERE `expires_at`<?", s.tableName)
+	return s.affected(ctx, query, before)
+}
+
+func setupSessionStore(db *gorp.DbMap) (*SessionStore, error) {
+	store := &SessionStore{
+		Store{
+			db:        db,
+			tableName: "sessions",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.SessionModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
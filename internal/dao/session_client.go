@@ -0,0 +1,53 @@
+package dao
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	SessionClientStore struct {
+		Store
+	}
+)
+
+func (s *SessionClientStore) Add(ctx context.Context, model *models.SessionClientModel) error {
+	model.Created = time.Now().Unix()
+	format := "INSERT IGNORE INTO `%s` (`sid`, `client_id`, `created_at`) VALUES (?, ?, ?)"
+	switch s.db.Dialect.(type) {
+	case gorp.PostgresDialect:
+		format = "INSERT INTO `%s` (`sid`, `client_id`, `created_at`) VALUES (?, ?, ?) ON CONFLICT DO NOTHING"
+	case gorp.SqliteDialect:
+		format = "INSERT OR IGNORE INTO `%s` (`sid`, `client_id`, `created_at`) VALUES (?, ?, ?)"
+	}
+	query := s.query(format, s.tableName)
+	_, err := s.execute(ctx, query, model.Sid, model.ClientId, model.Created)
+	return err
+}
+
+func (s *SessionClientStore) BySid(ctx context.Context, sid string) ([]*models.SessionClientModel, error) {
+	var items []*models.SessionClientModel
+	query := s.query("SELECT * FROM `%s` WHERE `sid`=?", s.tableName)
+	if _, err := s.exec(ctx).Select(&items, query, sid); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func setupSessionClientStore(db *gorp.DbMap) (*SessionClientStore, error) {
+	store := &SessionClientStore{
+		Store{
+			db:        db,
+			tableName: "session_clients",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.SessionClientModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
@@ -1,11 +1,13 @@
 package dao
 
 import (
+	"fmt"
 	"time"
 
 	"database/sql"
 	"github.com/MiG-21/go-sso/internal"
 	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
 	"go.uber.org/dig"
 )
 
@@ -18,36 +20,165 @@ type (
 	}
 )
 
-func SetupMysqlDao(config *internal.Config) SetupResult {
+// SetupDao opens the database of the configured driver and brings its schema up to date, the memory driver needs
+// no database.
+func SetupDao(config *internal.Config) SetupResult {
 	sr := SetupResult{}
+	if config.Database.Driver == DriverMemory {
+		sr.SSOer = NewMemoryDao(config)
+		return sr
+	}
 	s := models.SetupSSO(config)
 
-	db, err := sql.Open("mysql", config.Mysql.Dsn)
+	dialect, err := newDialect(config.Database.Driver)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+	db, err := OpenDatabase(config)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+	if err = migrateDatabase(config, db); err != nil {
+		sr.Error = err
+		return sr
+	}
+	// the stores share the map, so a transaction can span all of them
+	dbMap := &gorp.DbMap{Db: db, Dialect: dialect}
+
+	uStore, err := setupUserStore(dbMap, config.Password.Hasher)
 	if err != nil {
 		sr.Error = err
 		return sr
 	}
-	db.SetMaxOpenConns(config.Mysql.MaxOpenConns)
-	db.SetMaxIdleConns(config.Mysql.MaxIdleConns)
-	db.SetConnMaxLifetime(time.Duration(config.Mysql.MaxLifetime) * time.Second)
 
-	uStore, err := setupUserStore(db)
+	aStore, err := setupApplicationStore(dbMap)
 	if err != nil {
 		sr.Error = err
 		return sr
 	}
 
-	aStore, err := setupApplicationStore(db)
+	acStore, err := setupAuthorizationCodeStore(dbMap)
 	if err != nil {
 		sr.Error = err
 		return sr
 	}
 
-	sr.SSOer = &MysqlDao{
-		SSO:              s,
-		UserStore:        uStore,
-		ApplicationStore: aStore,
+	rtStore, err := setupRefreshTokenStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	sStore, err := setupSessionStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	scStore, err := setupSessionClientStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	tStore, err := setupTotpStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	wcStore, err := setupWebAuthnCredentialStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	whStore, err := setupWebAuthnChallengeStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	rcStore, err := setupRecoveryCodeStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	lfStore, err := setupLoginFailureStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	phStore, err := setupPasswordHistoryStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	auStore, err := setupAuditStore(dbMap)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	sr.SSOer = &SqlDao{
+		SSO:                     s,
+		db:                      dbMap,
+		UserStore:               uStore,
+		ApplicationStore:        aStore,
+		AuthorizationCodeStore:  acStore,
+		RefreshTokenStore:       rtStore,
+		SessionStore:            sStore,
+		SessionClientStore:      scStore,
+		TotpStore:               tStore,
+		WebAuthnCredentialStore: wcStore,
+		WebAuthnChallengeStore:  whStore,
+		RecoveryCodeStore:       rcStore,
+		LoginFailureStore:       lfStore,
+		PasswordHistoryStore:    phStore,
+		AuditStore:              auStore,
 	}
 
 	return sr
 }
+
+// OpenDatabase opens the database of the configured sql driver.
+func OpenDatabase(config *internal.Config) (*sql.DB, error) {
+	db, err := sql.Open(config.Database.Driver, config.Database.Dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(config.Database.MaxOpenConns)
+	db.SetMaxIdleConns(config.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(config.Database.MaxLifetime) * time.Second)
+	if config.Database.Driver == DriverSqlite {
+		// sqlite allows a single writer, concurrent connections fail with database is locked
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// migrateDatabase applies the pending migrations, when the startup migration is disabled it only refuses
+// the outdated schema.
+func migrateDatabase(config *internal.Config, db *sql.DB) error {
+	migrator, err := NewMigrator(db, config.Database.Driver)
+	if err != nil {
+		return err
+	}
+	if config.Database.Migrate {
+		_, err = migrator.Up()
+		return err
+	}
+	pending, err := migrator.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is outdated, %d migrations are pending, run the migrate command", len(pending))
+	}
+	return nil
+}
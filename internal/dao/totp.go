@@ -0,0 +1,80 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	TotpStore struct {
+		Store
+	}
+)
+
+func (t *TotpStore) Save(ctx context.Context, model *models.TotpModel) error {
+	return t.transaction(ctx, func(ctx context.Context) error {
+		if err := t.DeleteByUser(ctx, model.UserId); err != nil {
+			return err
+		}
+		model.Created = time.Now().Unix()
+		return t.exec(ctx).Insert(model)
+	})
+}
+
+func (t *TotpStore) ByUser(ctx context.Context, userId int64) (*models.TotpModel, error) {
+	query := t.query("SELECT * FROM `%s` WHERE `user_id`=? LIMIT 1", t.tableName)
+	item := &models.TotpModel{}
+	err := t.exec(ctx).SelectOne(item, query, userId)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return item, nil
+	default:
+		return nil, err
+	}
+}
+
+func (t *TotpStore) Confirm(ctx context.Context, model *models.TotpModel) error {
+	model.Confirmed = true
+	query := t.query("UPDATE `%s` SET `confirmed`=? WHERE `id`=?", t.tableName)
+	_, err := t.execute(ctx, query, true, model.Id)
+	return err
+}
+
+func (t *TotpStore) Use(ctx context.Context, model *models.TotpModel, counter int64) (bool, error) {
+	query := t.query("UPDATE `%s` SET `last_counter`=? WHERE `id`=? AND `last_counter`<?", t.tableName)
+	rows, err := t.affected(ctx, query, counter, model.Id, counter)
+	if err != nil {
+		return false, err
+	}
+	if rows == 1 {
+		model.LastCounter = counter
+	}
+	return rows == 1, nil
+}
+
+func (t *TotpStore) DeleteByUser(ctx context.Context, userId int64) error {
+	query := t.query("DELETE FROM `%s` WHERE `user_id`=?", t.tableName)
+	_, err := t.execute(ctx, query, userId)
+	return err
+}
+
+func setupTotpStore(db *gorp.DbMap) (*TotpStore, error) {
+	store := &TotpStore{
+		Store{
+			db:        db,
+			tableName: "user_totp",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.TotpModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
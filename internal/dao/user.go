@@ -1,92 +1,110 @@
 package dao
 
 import (
+	"context"
 	"database/sql"
-	"errors"
-	"fmt"
 	"os"
 	"time"
 
+	"github.com/MiG-21/go-sso/internal"
 	"github.com/MiG-21/go-sso/internal/models"
 	"github.com/go-gorp/gorp/v3"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type (
 	UserStore struct {
 		Store
+		hasher internal.PasswordHasher
 	}
 )
 
-func (u *UserStore) ById(id int64) (*models.UserModel, error) {
-	item, err := u.db.Get(models.UserModel{}, id)
+func (u *UserStore) ById(ctx context.Context, id int64) (*models.UserModel, error) {
+	item, err := u.exec(ctx).Get(models.UserModel{}, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	// gorp returns no error and no item for missing rows
+	if item == nil {
+		return nil, nil
+	}
 	return item.(*models.UserModel), nil
 }
 
-func (u *UserStore) ByEmail(email string) (*models.UserModel, error) {
-	query := fmt.Sprintf("SELECT * FROM `%s` WHERE `email`=? LIMIT 1", u.tableName)
-	return u.selectOne(query, email)
+func (u *UserStore) ByEmail(ctx context.Context, email string) (*models.UserModel, error) {
+	query := u.query("SELECT * FROM `%s` WHERE `email`=? LIMIT 1", u.tableName)
+	return u.selectOne(ctx, query, email)
 }
 
-func (u *UserStore) ByCode(code string) (*models.UserModel, error) {
-	query := fmt.Sprintf("SELECT * FROM `%s` WHERE `verification_code`=? LIMIT 1", u.tableName)
-	return u.selectOne(query, code)
+func (u *UserStore) ByCode(ctx context.Context, code string) (*models.UserModel, error) {
+	query := u.query("SELECT * FROM `%s` WHERE `verification_code`=? LIMIT 1", u.tableName)
+	return u.selectOne(ctx, query, code)
 }
 
-func (u *UserStore) Validate(user *models.UserModel) error {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM `%s` WHERE `email`=?", u.tableName)
-	n, err := u.db.SelectInt(query, user.Email)
+func (u *UserStore) Authenticate(ctx context.Context, email string, password string) (*models.UserModel, error) {
+	item, err := u.ByEmail(ctx, email)
 	if err != nil {
-		return err
-	}
-	if n > 0 {
-		return errors.New("email already taken")
-	}
-	return nil
-}
-
-func (u *UserStore) Authenticate(email string, password string) (*models.UserModel, error) {
-	item, err := u.ByEmail(email)
-	if err = bcrypt.CompareHashAndPassword([]byte(item.Password), []byte(password)); err != nil {
-		return nil, errors.New("invalid credentials")
-	}
-	if !item.Active {
-		return nil, errors.New("user not verified")
+		return nil, err
 	}
-	if item.Locked {
-		return nil, errors.New("user is locked")
+	if err = verifyUser(u.hasher, item, password); err != nil {
+		return nil, err
 	}
-	now := time.Now()
-	if item.LockedTo > now.Unix() {
-		return nil, errors.New("user is locked to " + now.Format(time.RFC822))
+	if u.hasher.NeedsRehash(item.Password) {
+		// the sign in does not fail if the upgrade does, the old hash is still valid
+		_ = u.rehash(ctx, item, password)
 	}
 	return item, nil
 }
 
-func (u *UserStore) Create(user *models.UserModel) error {
+func (u *UserStore) Create(ctx context.Context, user *models.UserModel) error {
 	user.Created = time.Now().Unix()
-	return u.db.Insert(user)
+	return u.exec(ctx).Insert(user)
 }
 
-func (u *UserStore) Update(user *models.UserModel) (int64, error) {
+func (u *UserStore) Update(ctx context.Context, user *models.UserModel) (int64, error) {
 	user.Updated = time.Now().Unix()
-	return u.db.Update(user)
+	return u.exec(ctx).Update(user)
 }
 
-func (u *UserStore) Delete(model *models.UserModel) error {
-	// TODO implement me
-	panic("implement me")
+func (u *UserStore) Delete(ctx context.Context, model *models.UserModel) error {
+	_, err := u.exec(ctx).Delete(model)
+	return err
 }
 
-func (u *UserStore) selectOne(query string, args ...interface{}) (*models.UserModel, error) {
+// rehash replaces the outdated password hash of the user with the one made by the configured algorithm.
+func (u *UserStore) rehash(ctx context.Context, user *models.UserModel, password string) error {
+	hash, err := u.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	query := u.query("UPDATE `%s` SET `password`=? WHERE `id`=? AND `password`=?", u.tableName)
+	if _, err = u.exec(ctx).Exec(query, hash, user.Id, user.Password); err != nil {
+		return err
+	}
+	user.Password = hash
+	return nil
+}
+
+// verifyUser checks whether the user found by email can sign in and then the password of the user.
+func verifyUser(hasher internal.PasswordHasher, item *models.UserModel, password string) error {
+	if item == nil {
+		return models.ErrInvalidCredentials
+	}
+	if !item.Active || item.Locked || item.LockedTo > time.Now().Unix() {
+		return models.ErrUserLocked
+	}
+	ok, err := hasher.Verify(item.Password, password)
+	if err != nil || !ok {
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (u *UserStore) selectOne(ctx context.Context, query string, args ...interface{}) (*models.UserModel, error) {
 	item := &models.UserModel{}
-	err := u.db.SelectOne(item, query, args...)
+	err := u.exec(ctx).SelectOne(item, query, args...)
 	switch err {
 	case sql.ErrNoRows:
 		return nil, nil
@@ -97,25 +115,17 @@ func (u *UserStore) selectOne(query string, args ...interface{}) (*models.UserMo
 	}
 }
 
-func setupUserStore(db *sql.DB) (*UserStore, error) {
+func setupUserStore(db *gorp.DbMap, hasher internal.PasswordHasher) (*UserStore, error) {
 	store := &UserStore{
 		Store{
-			db:        &gorp.DbMap{Db: db, Dialect: gorp.MySQLDialect{Encoding: "UTF8", Engine: "INNODB"}},
+			db:        db,
 			tableName: "users",
 			stdout:    os.Stderr,
 		},
+		hasher,
 	}
 
-	table := store.db.AddTableWithName(models.UserModel{}, store.tableName).SetKeys(true, "Id")
-	table.AddIndex("idx_email", "Btree", []string{"email"}).SetUnique(true)
-	table.AddIndex("idx_login", "Btree", []string{"email", "password"})
-	table.AddIndex("idx_verification", "Btree", []string{"verification_code"})
-
-	if err := store.db.CreateTablesIfNotExists(); err != nil {
-		return nil, err
-	}
-
-	_ = store.db.CreateIndex()
+	store.db.AddTableWithName(models.UserModel{}, store.tableName).SetKeys(true, "Id")
 
 	return store, nil
 }
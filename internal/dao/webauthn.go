@@ -0,0 +1,108 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/go-gorp/gorp/v3"
+)
+
+type (
+	WebAuthnCredentialStore struct {
+		Store
+	}
+
+	WebAuthnChallengeStore struct {
+		Store
+	}
+)
+
+func (w *WebAuthnCredentialStore) Create(ctx context.Context, model *models.WebAuthnCredentialModel) error {
+	model.Created = time.Now().Unix()
+	return w.exec(ctx).Insert(model)
+}
+
+func (w *WebAuthnCredentialStore) ByUser(ctx context.Context, userId int64) ([]*models.WebAuthnCredentialModel, error) {
+	var items []*models.WebAuthnCredentialModel
+	query := w.query("SELECT * FROM `%s` WHERE `user_id`=? ORDER BY `created_at`", w.tableName)
+	if _, err := w.exec(ctx).Select(&items, query, userId); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (w *WebAuthnCredentialStore) Use(ctx context.Context, model *models.WebAuthnCredentialModel) error {
+	model.LastUsed = time.Now().Unix()
+	query := w.query("UPDATE `%s` SET `sign_count`=?, `last_used_at`=? WHERE `id`=?", w.tableName)
+	_, err := w.execute(ctx, query, model.SignCount, model.LastUsed, model.Id)
+	return err
+}
+
+func (w *WebAuthnCredentialStore) Delete(ctx context.Context, userId, id int64) (int64, error) {
+	query := w.query("DELETE FROM `%s` WHERE `id`=? AND `user_id`=?", w.tableName)
+	return w.affected(ctx, query, id, userId)
+}
+
+func (w *WebAuthnChallengeStore) Create(ctx context.Context, model *models.WebAuthnChallengeModel) error {
+	model.Created = time.Now().Unix()
+	return w.exec(ctx).Insert(model)
+}
+
+func (w *WebAuthnChallengeStore) ByChallenge(ctx context.Context, challenge string) (*models.WebAuthnChallengeModel, error) {
+	query := w.query("SELECT * FROM `%s` WHERE `challenge`=? LIMIT 1", w.tableName)
+	item := &models.WebAuthnChallengeModel{}
+	err := w.exec(ctx).SelectOne(item, query, challenge)
+	switch err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+		return item, nil
+	default:
+		return nil, err
+	}
+}
+
+func (w *WebAuthnChallengeStore) Consume(ctx context.Context, model *models.WebAuthnChallengeModel) (bool, error) {
+	query := w.query("DELETE FROM `%s` WHERE `id`=?", w.tableName)
+	rows, err := w.affected(ctx, query, model.Id)
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (w *WebAuthnChallengeStore) DeleteExpired(ctx context.Context, before int64) (int64, error) {
+	query := w.query("DELETE FROM `%s` WHERE `expires_at`<?", w.tableName)
+	return w.affected(ctx, query, before)
+}
+
+func setupWebAuthnCredentialStore(db *gorp.DbMap) (*WebAuthnCredentialStore, error) {
+	store := &WebAuthnCredentialStore{
+		Store{
+			db:        db,
+			tableName: "webauthn_credentials",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.WebAuthnCredentialModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
+
+func setupWebAuthnChallengeStore(db *gorp.DbMap) (*WebAuthnChallengeStore, error) {
+	store := &WebAuthnChallengeStore{
+		Store{
+			db:        db,
+			tableName: "webauthn_challenges",
+			stdout:    os.Stderr,
+		},
+	}
+
+	store.db.AddTableWithName(models.WebAuthnChallengeModel{}, store.tableName).SetKeys(true, "Id")
+
+	return store, nil
+}
@@ -89,7 +89,7 @@ func (s *Service) handleEvent(event Event) {
 		for _, listener := range listeners {
 			go func(l Listener) {
 				if err := l(event.Data()); err != nil {
-					s.logger.Err(err)
+					s.logger.Err(err).Str("event", event.Name()).Send()
 				}
 			}(listener)
 		}
@@ -3,8 +3,11 @@ package event
 import "github.com/rs/zerolog"
 
 const (
-	UserCreatedEvent     = "user_created"
-	PasswordRecoverEvent = "password_recover_request"
+	UserCreatedEvent      = "user_created"
+	PasswordRecoverEvent  = "password_recover_request"
+	SessionLogoutEvent    = "session_logout"
+	RecoveryCodeUsedEvent = "recovery_code_used"
+	UserLockedEvent       = "user_locked"
 )
 
 func SetupEventService(logger *zerolog.Logger) *Service {
@@ -16,6 +16,36 @@ type (
 		UserEmail       string
 		VerificationUrl *url.URL
 	}
+
+	// RecoveryCodeUsed is emitted when the user signs in with a recovery code instead of the second factor
+	RecoveryCodeUsed struct {
+		UserName  string
+		UserEmail string
+		Ip        string
+		UserAgent string
+		Remaining int64
+	}
+
+	// UserLocked is emitted when too many failed sign in attempts lock the account
+	UserLocked struct {
+		UserName  string
+		UserEmail string
+		Ip        string
+		LockedTo  int64
+	}
+
+	SessionLogoutClient struct {
+		ClientId             string
+		BackchannelLogoutUrl string
+	}
+
+	// SessionLogout is emitted when the session ends, clients are notified via back-channel
+	SessionLogout struct {
+		Issuer  string
+		Subject string
+		Sid     string
+		Clients []SessionLogoutClient
+	}
 )
 
 func (uc *UserCreated) Name() string {
@@ -33,3 +63,27 @@ func (uc *UserPasswordRecover) Name() string {
 func (uc *UserPasswordRecover) Data() interface{} {
 	return uc
 }
+
+func (rc *RecoveryCodeUsed) Name() string {
+	return RecoveryCodeUsedEvent
+}
+
+func (rc *RecoveryCodeUsed) Data() interface{} {
+	return rc
+}
+
+func (ul *UserLocked) Name() string {
+	return UserLockedEvent
+}
+
+func (ul *UserLocked) Data() interface{} {
+	return ul
+}
+
+func (sl *SessionLogout) Name() string {
+	return SessionLogoutEvent
+}
+
+func (sl *SessionLogout) Data() interface{} {
+	return sl
+}
@@ -1,16 +1,34 @@
 package internal
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"reflect"
 )
 
-func GetPasswordHash(password []byte) string {
-	hashedPassword, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+// RandomString returns url safe base64 representation of n random bytes.
+func RandomString(n int) (string, error) {
+	b, err := randomBytes(n)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return string(hashedPassword)
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// HashToken returns hex encoded sha256 of the token, opaque tokens are stored only in this form.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func InArray(val interface{}, array interface{}) (exists bool, index int) {
@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	HashAlgorithmBcrypt   = "bcrypt"
+	HashAlgorithmArgon2id = "argon2id"
+)
+
+var (
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+type (
+	// PasswordHasher hashes new passwords with the configured algorithm and verifies hashes of any supported one,
+	// NeedsRehash tells whether the hash was made by another algorithm or with other parameters.
+	PasswordHasher interface {
+		Hash(password string) (string, error)
+		Verify(hash, password string) (bool, error)
+		NeedsRehash(hash string) bool
+	}
+
+	// passwordHashing dispatches by the hash prefix, so stored hashes keep working after the algorithm changes.
+	passwordHashing struct {
+		algorithm string
+		bcrypt    *BcryptHasher
+		argon2id  *Argon2idHasher
+	}
+
+	BcryptHasher struct {
+		Cost int
+	}
+
+	// Argon2idHasher produces PHC formatted hashes: $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+	Argon2idHasher struct {
+		Memory      uint32
+		Iterations  uint32
+		Parallelism uint8
+		SaltLength  uint32
+		KeyLength   uint32
+	}
+
+	argon2idParams struct {
+		memory      uint32
+		iterations  uint32
+		parallelism uint8
+		salt        []byte
+		key         []byte
+	}
+)
+
+func NewPasswordHasher(config *ConfigHashing) (PasswordHasher, error) {
+	h := &passwordHashing{
+		algorithm: config.Algorithm,
+		bcrypt:    &BcryptHasher{Cost: config.BcryptCost},
+		argon2id: &Argon2idHasher{
+			Memory:      config.Argon2Memory,
+			Iterations:  config.Argon2Iterations,
+			Parallelism: config.Argon2Parallelism,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+	switch config.Algorithm {
+	case HashAlgorithmBcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost has to be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashAlgorithmArgon2id:
+		if config.Argon2Memory == 0 || config.Argon2Iterations == 0 || config.Argon2Parallelism == 0 {
+			return nil, errors.New("argon2id memory, iterations and parallelism are required")
+		}
+	default:
+		return nil, errors.New("unknown password hash algorithm " + config.Algorithm)
+	}
+	return h, nil
+}
+
+func (p *passwordHashing) Hash(password string) (string, error) {
+	if p.algorithm == HashAlgorithmBcrypt {
+		return p.bcrypt.Hash(password)
+	}
+	return p.argon2id.Hash(password)
+}
+
+func (p *passwordHashing) Verify(hash, password string) (bool, error) {
+	switch hashAlgorithm(hash) {
+	case HashAlgorithmBcrypt:
+		return p.bcrypt.Verify(hash, password)
+	case HashAlgorithmArgon2id:
+		return p.argon2id.Verify(hash, password)
+	default:
+		return false, ErrUnknownHash
+	}
+}
+
+func (p *passwordHashing) NeedsRehash(hash string) bool {
+	if hashAlgorithm(hash) != p.algorithm {
+		return true
+	}
+	if p.algorithm == HashAlgorithmBcrypt {
+		return p.bcrypt.NeedsRehash(hash)
+	}
+	return p.argon2id.NeedsRehash(hash)
+}
+
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *BcryptHasher) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.Cost
+}
+
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := randomBytes(int(a.SaltLength))
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2idHasher) Verify(hash, password string) (bool, error) {
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (a *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.memory != a.Memory || params.iterations != a.Iterations || params.parallelism != a.Parallelism ||
+		uint32(len(params.key)) != a.KeyLength
+}
+
+func hashAlgorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return HashAlgorithmBcrypt
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return HashAlgorithmArgon2id
+	default:
+		return ""
+	}
+}
+
+func parseArgon2id(hash string) (*argon2idParams, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashAlgorithmArgon2id {
+		return nil, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnknownHash
+	}
+	params := &argon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, ErrUnknownHash
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnknownHash
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return nil, ErrUnknownHash
+	}
+	return params, nil
+}
@@ -0,0 +1,96 @@
+package internal_test
+
+import (
+	"strings"
+
+	"github.com/MiG-21/go-sso/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PasswordHasher", func() {
+	argon2Config := &internal.ConfigHashing{
+		Algorithm:         internal.HashAlgorithmArgon2id,
+		BcryptCost:        4,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}
+	bcryptConfig := &internal.ConfigHashing{
+		Algorithm:         internal.HashAlgorithmBcrypt,
+		BcryptCost:        4,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}
+
+	It("hashes with argon2id in phc format", func() {
+		hasher, err := internal.NewPasswordHasher(argon2Config)
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := hasher.Hash("Secret Password 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(HavePrefix("$argon2id$v=19$m=1024,t=1,p=1$"))
+		Expect(strings.Split(hash, "$")).To(HaveLen(6))
+
+		ok, err := hasher.Verify(hash, "Secret Password 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		ok, err = hasher.Verify(hash, "Secret Password 2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(hasher.NeedsRehash(hash)).To(BeFalse())
+	})
+
+	It("verifies bcrypt hashes and asks to upgrade them", func() {
+		legacy, err := internal.NewPasswordHasher(bcryptConfig)
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := legacy.Hash("Secret Password 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(HavePrefix("$2a$04$"))
+		Expect(legacy.NeedsRehash(hash)).To(BeFalse())
+
+		hasher, err := internal.NewPasswordHasher(argon2Config)
+		Expect(err).NotTo(HaveOccurred())
+		ok, err := hasher.Verify(hash, "Secret Password 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(hasher.NeedsRehash(hash)).To(BeTrue())
+	})
+
+	It("asks to rehash when the parameters change", func() {
+		hasher, err := internal.NewPasswordHasher(argon2Config)
+		Expect(err).NotTo(HaveOccurred())
+		hash, err := hasher.Hash("Secret Password 1")
+		Expect(err).NotTo(HaveOccurred())
+
+		stronger := *argon2Config
+		stronger.Argon2Iterations = 2
+		hasher, err = internal.NewPasswordHasher(&stronger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hasher.NeedsRehash(hash)).To(BeTrue())
+
+		cost := *bcryptConfig
+		cost.BcryptCost = 5
+		legacy, err := internal.NewPasswordHasher(bcryptConfig)
+		Expect(err).NotTo(HaveOccurred())
+		hash, err = legacy.Hash("Secret Password 1")
+		Expect(err).NotTo(HaveOccurred())
+		hasher, err = internal.NewPasswordHasher(&cost)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hasher.NeedsRehash(hash)).To(BeTrue())
+	})
+
+	It("rejects unknown hashes and configs", func() {
+		hasher, err := internal.NewPasswordHasher(argon2Config)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = hasher.Verify("plain", "plain")
+		Expect(err).To(Equal(internal.ErrUnknownHash))
+		_, err = hasher.Verify("$argon2id$v=19$m=1024,t=1,p=1$%%$%%", "plain")
+		Expect(err).To(Equal(internal.ErrUnknownHash))
+
+		_, err = internal.NewPasswordHasher(&internal.ConfigHashing{Algorithm: "md5"})
+		Expect(err).To(HaveOccurred())
+		_, err = internal.NewPasswordHasher(&internal.ConfigHashing{Algorithm: internal.HashAlgorithmBcrypt, BcryptCost: 99})
+		Expect(err).To(HaveOccurred())
+	})
+})
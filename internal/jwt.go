@@ -1,15 +1,42 @@
 package internal
 
 import (
-	"crypto/rsa"
-
 	"github.com/dgrijalva/jwt-go"
 )
 
+const (
+	BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	// TokenUseAccess marks the access tokens, id_tokens and logout tokens are signed by the same keys and must
+	// never pass as one.
+	TokenUseAccess = "access"
+	// TokenUseSession marks the token of the sso cookie, it is only good for reusing the session on the next login.
+	TokenUseSession = "session"
+)
+
 type (
 	SignInClaims struct {
-		Id    int64    `json:"Id"`
-		Roles []string `json:"roles,omitempty"`
+		Id        int64    `json:"Id"`
+		Roles     []string `json:"roles,omitempty"`
+		SessionId string   `json:"sid,omitempty"`
+		TokenUse  string   `json:"token_use"`
+		Scope     string   `json:"scope,omitempty"`
+		jwt.StandardClaims
+	}
+
+	IdTokenClaims struct {
+		Nonce         string `json:"nonce,omitempty"`
+		AuthTime      int64  `json:"auth_time,omitempty"`
+		Name          string `json:"name,omitempty"`
+		Email         string `json:"email,omitempty"`
+		EmailVerified bool   `json:"email_verified"`
+		SessionId     string `json:"sid,omitempty"`
+		jwt.StandardClaims
+	}
+
+	LogoutTokenClaims struct {
+		SessionId string                 `json:"sid,omitempty"`
+		Events    map[string]interface{} `json:"events"`
 		jwt.StandardClaims
 	}
 
@@ -32,21 +59,39 @@ func (sic *SignInClaims) IsAuthorized(roles ...string) bool {
 	return false
 }
 
-func GenSignInJWT(id int64, roles []string, p *rsa.PrivateKey, t int64) (string, error) {
+// GenSignInJWT signs access token bound to the server side session sid, every token gets unique jti. The audience
+// is the code of the application the token is issued for, the scope is the one granted to the application.
+func GenSignInJWT(id int64, roles []string, sid, audience, scope string, k *SigningKey, t int64) (string, error) {
+	return genSignInJWT(id, roles, sid, audience, scope, TokenUseAccess, k, t)
+}
+
+// GenSessionJWT signs the token of the sso cookie bound to the server side session sid, it has no audience.
+func GenSessionJWT(id int64, sid string, k *SigningKey, t int64) (string, error) {
+	return genSignInJWT(id, nil, sid, "", "", TokenUseSession, k, t)
+}
+
+func genSignInJWT(id int64, roles []string, sid, audience, scope, use string, k *SigningKey, t int64) (string, error) {
+	jti, err := RandomString(16)
+	if err != nil {
+		return "", err
+	}
 	claims := SignInClaims{
 		id,
 		roles,
+		sid,
+		use,
+		scope,
 		jwt.StandardClaims{
+			Id:        jti,
+			Audience:  audience,
 			ExpiresAt: t,
 			Issuer:    "Login_Server",
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
-
-	return token.SignedString(p)
+	return signJWT(jwt.SigningMethodRS512, claims, k)
 }
 
-func GenVerificationJWT(id, action string, p *rsa.PrivateKey, t int64) (string, error) {
+func GenVerificationJWT(id, action string, k *SigningKey, t int64) (string, error) {
 	claims := VerificationClaims{
 		id,
 		action,
@@ -55,7 +100,26 @@ func GenVerificationJWT(id, action string, p *rsa.PrivateKey, t int64) (string,
 			Issuer:    "Login_Server",
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
+	return signJWT(jwt.SigningMethodRS512, claims, k)
+}
+
+// GenIdTokenJWT signs OpenID Connect id_token, RS256 is used since it is the algorithm every OIDC client supports.
+func GenIdTokenJWT(claims *IdTokenClaims, k *SigningKey) (string, error) {
+	return signJWT(jwt.SigningMethodRS256, claims, k)
+}
+
+// GenLogoutTokenJWT signs OpenID Connect back-channel logout token.
+func GenLogoutTokenJWT(claims *LogoutTokenClaims, k *SigningKey) (string, error) {
+	if claims.Events == nil {
+		claims.Events = map[string]interface{}{BackchannelLogoutEvent: struct{}{}}
+	}
+	return signJWT(jwt.SigningMethodRS256, claims, k)
+}
+
+// signJWT signs the claims and sets kid header, so verifiers could pick the right key of the key ring.
+func signJWT(method jwt.SigningMethod, claims jwt.Claims, k *SigningKey) (string, error) {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = k.Id
 
-	return token.SignedString(p)
+	return token.SignedString(k.PrivateKey)
 }
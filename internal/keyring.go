@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	KeyStatusActive   = "active"
+	KeyStatusRetiring = "retiring"
+)
+
+type (
+	// SigningKey is one RSA key of the key ring, retiring keys are only used for verification.
+	SigningKey struct {
+		Id         string
+		Status     string
+		PrivateKey *rsa.PrivateKey
+		PublicKey  *rsa.PublicKey
+	}
+
+	// KeyRing keeps exactly one active signing key and any number of retiring ones,
+	// so the keys can be rotated without invalidating already issued tokens.
+	KeyRing struct {
+		active *SigningKey
+		keys   []*SigningKey
+	}
+)
+
+func NewKeyRing(keys ...*SigningKey) (*KeyRing, error) {
+	r := &KeyRing{}
+	ids := map[string]bool{}
+	for _, key := range keys {
+		if ids[key.Id] {
+			return nil, fmt.Errorf("duplicated key id %s", key.Id)
+		}
+		ids[key.Id] = true
+		switch key.Status {
+		case KeyStatusActive:
+			if r.active != nil {
+				return nil, errors.New("only one active key is allowed")
+			}
+			if key.PrivateKey == nil {
+				return nil, fmt.Errorf("active key %s has no private key", key.Id)
+			}
+			r.active = key
+		case KeyStatusRetiring:
+		default:
+			return nil, fmt.Errorf("unknown key status %s", key.Status)
+		}
+		r.keys = append(r.keys, key)
+	}
+	if r.active == nil {
+		return nil, errors.New("no active key configured")
+	}
+	return r, nil
+}
+
+// Active returns the key new tokens are signed with.
+func (r *KeyRing) Active() *SigningKey {
+	return r.active
+}
+
+// Keys returns all keys, both active and retiring.
+func (r *KeyRing) Keys() []*SigningKey {
+	return r.keys
+}
+
+// Key returns the key by its id or nil.
+func (r *KeyRing) Key(kid string) *SigningKey {
+	for _, key := range r.keys {
+		if key.Id == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// Keyfunc is jwt.Keyfunc picking the verification key by the token kid header,
+// tokens issued before kid was introduced are verified against the active key.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return r.active.PublicKey, nil
+	}
+	if key := r.Key(kid); key != nil {
+		return key.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unknown key id %s", kid)
+}
+
+// LoadSigningKey reads PEM encoded key pair, private key is optional for retiring keys.
+// When id is empty the RFC 7638 thumbprint of the public key is used.
+func LoadSigningKey(id, status, privateKeyPath, publicKeyPath string) (*SigningKey, error) {
+	key := &SigningKey{Id: id, Status: status}
+
+	if privateKeyPath != "" {
+		privateKeyData, err := ioutil.ReadFile(privateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		if key.PrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(privateKeyData); err != nil {
+			return nil, err
+		}
+	}
+
+	if publicKeyPath != "" {
+		publicKeyData, err := ioutil.ReadFile(publicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		if key.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicKeyData); err != nil {
+			return nil, err
+		}
+	} else if key.PrivateKey != nil {
+		key.PublicKey = &key.PrivateKey.PublicKey
+	}
+
+	if key.PublicKey == nil {
+		return nil, errors.New("public key is required")
+	}
+	if key.Id == "" {
+		key.Id = KeyThumbprint(key.PublicKey)
+	}
+	return key, nil
+}
+
+// KeyThumbprint returns RFC 7638 JWK thumbprint of the RSA public key.
+func KeyThumbprint(key *rsa.PublicKey) string {
+	jwk := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, KeyExponent(key), KeyModulus(key))
+	sum := sha256.Sum256([]byte(jwk))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// KeyModulus returns base64url encoded modulus as used in JWK.
+func KeyModulus(key *rsa.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+}
+
+// KeyExponent returns base64url encoded exponent as used in JWK.
+func KeyExponent(key *rsa.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+}
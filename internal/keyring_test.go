@@ -0,0 +1,70 @@
+package internal_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/dgrijalva/jwt-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KeyRing", func() {
+	var (
+		oldKey *internal.SigningKey
+		newKey *internal.SigningKey
+	)
+
+	BeforeEach(func() {
+		var err error
+		oldKey, err = internal.LoadSigningKey("", internal.KeyStatusActive, "../test/key_pair/demo.rsa", "../test/key_pair/demo.rsa.pub")
+		Expect(err).NotTo(HaveOccurred())
+		p, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		newKey = &internal.SigningKey{Id: "new", Status: internal.KeyStatusActive, PrivateKey: p, PublicKey: &p.PublicKey}
+	})
+
+	It("LoadSigningKey", func() {
+		Expect(oldKey.Id).To(Equal(internal.KeyThumbprint(oldKey.PublicKey)))
+		Expect(oldKey.PrivateKey).NotTo(BeNil())
+	})
+
+	It("NewKeyRing", func() {
+		_, err := internal.NewKeyRing(oldKey, newKey)
+		Expect(err).To(HaveOccurred())
+		oldKey.Status = internal.KeyStatusRetiring
+		_, err = internal.NewKeyRing(oldKey)
+		Expect(err).To(HaveOccurred())
+		ring, err := internal.NewKeyRing(oldKey, newKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ring.Active()).To(Equal(newKey))
+		Expect(ring.Keys()).To(HaveLen(2))
+	})
+
+	It("Keyfunc", func() {
+		issued, err := internal.GenSignInJWT(1, nil, "sid", "", "", oldKey, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		// rotate: new key signs, old one only verifies
+		oldKey.Status = internal.KeyStatusRetiring
+		ring, err := internal.NewKeyRing(newKey, oldKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		token, err := jwt.ParseWithClaims(issued, &internal.SignInClaims{}, ring.Keyfunc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.Header["kid"]).To(Equal(oldKey.Id))
+
+		issued, err = internal.GenSignInJWT(1, nil, "sid", "", "", ring.Active(), 0)
+		Expect(err).NotTo(HaveOccurred())
+		token, err = jwt.ParseWithClaims(issued, &internal.SignInClaims{}, ring.Keyfunc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.Header["kid"]).To(Equal("new"))
+
+		unknown := &internal.SigningKey{Id: "unknown", PrivateKey: newKey.PrivateKey}
+		issued, err = internal.GenSignInJWT(1, nil, "sid", "", "", unknown, 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = jwt.ParseWithClaims(issued, &internal.SignInClaims{}, ring.Keyfunc)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,80 @@
+package logout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/event"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/google/uuid"
+)
+
+// tokenLifetime is kept short, the logout token is delivered right away and must not be replayed later.
+const tokenLifetime = 2 * time.Minute
+
+type (
+	// Service delivers OpenID Connect back-channel logout tokens to the applications of the ended session.
+	Service struct {
+		sso    models.SSOer
+		client *http.Client
+	}
+)
+
+func (s *Service) SendBackchannelLogout(i interface{}) error {
+	e, ok := i.(*event.SessionLogout)
+	if !ok {
+		return errors.New("input data should be SessionLogout")
+	}
+
+	var errs []string
+	for _, client := range e.Clients {
+		if client.BackchannelLogoutUrl == "" {
+			continue
+		}
+		if err := s.send(e, client); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", client.ClientId, err.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("back-channel logout failed for %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *Service) send(e *event.SessionLogout, client event.SessionLogoutClient) error {
+	jti, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	claims := &internal.LogoutTokenClaims{
+		SessionId: e.Sid,
+	}
+	claims.Id = jti.String()
+	claims.Issuer = e.Issuer
+	claims.Subject = e.Subject
+	claims.Audience = client.ClientId
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(tokenLifetime).Unix()
+	token, err := s.sso.BuildLogoutToken(claims)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("logout_token", token)
+	resp, err := s.client.PostForm(client.BackchannelLogoutUrl, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
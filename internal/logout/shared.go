@@ -0,0 +1,35 @@
+package logout
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/event"
+	"github.com/MiG-21/go-sso/internal/models"
+	"go.uber.org/dig"
+)
+
+type (
+	SetupResult struct {
+		dig.Out
+
+		LogoutService *Service
+		Error         error `group:"errors"`
+	}
+)
+
+func SetupService(config *internal.Config, sso models.SSOer, eventService *event.Service) SetupResult {
+	sr := SetupResult{}
+
+	service := &Service{
+		sso:    sso,
+		client: &http.Client{Timeout: time.Duration(config.OAuth.BackchannelLogoutTimeout) * time.Second},
+	}
+
+	eventService.AddListener(event.SessionLogoutEvent, service.SendBackchannelLogout)
+
+	sr.LogoutService = service
+
+	return sr
+}
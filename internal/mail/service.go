@@ -3,6 +3,7 @@ package mail
 import (
 	"errors"
 	"html/template"
+	"time"
 
 	"github.com/MiG-21/go-sso/internal/event"
 )
@@ -14,6 +15,8 @@ type (
 
 		verificationEmailTpl    *template.Template
 		passwordRecoverEmailTpl *template.Template
+		recoveryCodeUsedTpl     *template.Template
+		userLockedTpl           *template.Template
 	}
 )
 
@@ -50,3 +53,39 @@ func (s *Service) SendPasswordRecoverEmail(i interface{}) error {
 	}
 	return errors.New("input data should be UserModel")
 }
+
+func (s *Service) SendRecoveryCodeUsedEmail(i interface{}) error {
+	if e, ok := i.(*event.RecoveryCodeUsed); ok {
+		data := struct {
+			Name      string
+			Ip        string
+			UserAgent string
+			Remaining int64
+		}{
+			Name:      e.UserName,
+			Ip:        e.Ip,
+			UserAgent: e.UserAgent,
+			Remaining: e.Remaining,
+		}
+		m := NewTemplate(s.EmailFrom, "Recovery code used", data, s.recoveryCodeUsedTpl, e.UserEmail)
+		return s.sender.Send(m)
+	}
+	return errors.New("input data should be RecoveryCodeUsed")
+}
+
+func (s *Service) SendUserLockedEmail(i interface{}) error {
+	if e, ok := i.(*event.UserLocked); ok {
+		data := struct {
+			Name     string
+			Ip       string
+			LockedTo string
+		}{
+			Name:     e.UserName,
+			Ip:       e.Ip,
+			LockedTo: time.Unix(e.LockedTo, 0).UTC().Format(time.RFC1123),
+		}
+		m := NewTemplate(s.EmailFrom, "Account locked", data, s.userLockedTpl, e.UserEmail)
+		return s.sender.Send(m)
+	}
+	return errors.New("input data should be UserLocked")
+}
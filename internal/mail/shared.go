@@ -38,6 +38,20 @@ func SetupService(config *internal.Config, eventService *event.Service) SetupRes
 		return sr
 	}
 
+	recoveryCodeUsedPath := dir + "recovery_code_used.html"
+	recoveryCodeUsedTpl, err := template.New("layout").ParseFiles(recoveryCodeUsedPath, layoutPath)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	userLockedPath := dir + "user_locked.html"
+	userLockedTpl, err := template.New("layout").ParseFiles(userLockedPath, layoutPath)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
 	sender := &Smtp{
 		host:     config.Smtp.SmtpHost,
 		port:     config.Smtp.SmtpPort,
@@ -51,10 +65,14 @@ func SetupService(config *internal.Config, eventService *event.Service) SetupRes
 		sender:                  sender,
 		verificationEmailTpl:    verificationEmailTpl,
 		passwordRecoverEmailTpl: passwordRecoverEmailTpl,
+		recoveryCodeUsedTpl:     recoveryCodeUsedTpl,
+		userLockedTpl:           userLockedTpl,
 	}
 
 	eventService.AddListener(event.UserCreatedEvent, service.SendActivationEmail)
 	eventService.AddListener(event.PasswordRecoverEvent, service.SendPasswordRecoverEmail)
+	eventService.AddListener(event.RecoveryCodeUsedEvent, service.SendRecoveryCodeUsedEmail)
+	eventService.AddListener(event.UserLockedEvent, service.SendUserLockedEmail)
 
 	sr.EmailService = service
 
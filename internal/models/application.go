@@ -1,22 +1,116 @@
 package models
 
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+)
+
 type (
 	ApplicationModel struct {
-		Id          int64  `db:"id,primarykey,autoincrement"`
-		Application string `db:"application,size:255"`
-		Domain      string `db:"domain,size:255"`
-		RedirectUrl string `db:"redirect_url,size:255"`
-		Code        string `db:"code,size:50"`
-		Created     int64  `db:"created_at"`
-		Updated     int64  `db:"updated_at"`
+		Id                    int64  `db:"id,primarykey,autoincrement"`
+		Application           string `db:"application,size:255"`
+		Domain                string `db:"domain,size:255"`
+		RedirectUrl           string `db:"redirect_url,size:255"`
+		Code                  string `db:"code,size:50"`
+		FrontchannelLogoutUrl string `db:"frontchannel_logout_url,size:255"`
+		BackchannelLogoutUrl  string `db:"backchannel_logout_url,size:255"`
+		// RedirectUris and PostLogoutRedirectUris are space separated, see AllowsRedirectUri for the patterns.
+		RedirectUris           string `db:"redirect_uris,size:2048"`
+		PostLogoutRedirectUris string `db:"post_logout_redirect_uris,size:2048"`
+		// PublicUrl is the base of the links sent to the users of the application, the global one is used if empty.
+		PublicUrl string `db:"public_url,size:255"`
+		Created   int64  `db:"created_at"`
+		Updated   int64  `db:"updated_at"`
 	}
 
 	ApplicationManager interface {
-		Create(*ApplicationModel) error
-		Update(*ApplicationModel) (int64, error)
-		Delete(*ApplicationModel) (int64, error)
-		ById(int64) (*ApplicationModel, error)
-		ByCode(string) (*ApplicationModel, error)
-		List() ([]*ApplicationModel, error)
+		Create(context.Context, *ApplicationModel) error
+		Update(context.Context, *ApplicationModel) (int64, error)
+		Delete(context.Context, *ApplicationModel) (int64, error)
+		ById(context.Context, int64) (*ApplicationModel, error)
+		ByCode(context.Context, string) (*ApplicationModel, error)
+		List(context.Context) ([]*ApplicationModel, error)
 	}
 )
+
+// RedirectUriList returns the redirect uris of the application, RedirectUrl is the default one.
+func (a ApplicationModel) RedirectUriList() []string {
+	return append([]string{a.RedirectUrl}, strings.Fields(a.RedirectUris)...)
+}
+
+// PostLogoutRedirectUriList returns the uris the user can be sent to after the logout.
+func (a ApplicationModel) PostLogoutRedirectUriList() []string {
+	return strings.Fields(a.PostLogoutRedirectUris)
+}
+
+// AllowsRedirectUri reports whether the uri is registered for the application. Uris are compared exactly, only
+// the registered uris containing * are patterns: * matches a part of the host label or of the path segment, it is
+// never allowed in the last two labels of the host, the registrable domain.
+func (a ApplicationModel) AllowsRedirectUri(uri string) bool {
+	return matchesAnyUri(a.RedirectUriList(), uri)
+}
+
+// AllowsPostLogoutRedirectUri is AllowsRedirectUri for the post logout redirect uris.
+func (a ApplicationModel) AllowsPostLogoutRedirectUri(uri string) bool {
+	return matchesAnyUri(a.PostLogoutRedirectUriList(), uri)
+}
+
+func matchesAnyUri(patterns []string, uri string) bool {
+	if uri == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if pattern == uri || (strings.Contains(pattern, "*") && matchUriPattern(pattern, uri)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchUriPattern matches the host and the path of the uri against the pattern, the scheme and the query have to be
+// equal. Uris with user info, fragment or dot segments never match a pattern.
+func matchUriPattern(pattern, uri string) bool {
+	p, err := url.Parse(pattern)
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.User != nil || u.Fragment != "" || u.Opaque != "" || u.Host == "" {
+		return false
+	}
+	if strings.Contains(u.Path+"/", "/../") || strings.Contains(u.Path+"/", "/./") {
+		return false
+	}
+	if p.Scheme != u.Scheme || p.RawQuery != u.RawQuery {
+		return false
+	}
+	if p.Port() != u.Port() || !matchHostPattern(p.Hostname(), u.Hostname()) {
+		return false
+	}
+	ok, _ := path.Match(p.Path, u.Path)
+	return ok
+}
+
+// matchHostPattern matches the host label by label, so * never spans the dot, the host has to have as many labels
+// as the pattern and the registrable domain of the pattern is compared exactly.
+func matchHostPattern(pattern, host string) bool {
+	patternLabels := strings.Split(strings.ToLower(pattern), ".")
+	hostLabels := strings.Split(strings.ToLower(host), ".")
+	if len(patternLabels) != len(hostLabels) || len(patternLabels) < 2 {
+		return false
+	}
+	for i, label := range patternLabels {
+		if i >= len(patternLabels)-2 {
+			if label != hostLabels[i] {
+				return false
+			}
+			continue
+		}
+		if ok, err := path.Match(label, hostLabels[i]); err != nil || !ok || hostLabels[i] == "" {
+			return false
+		}
+	}
+	return true
+}
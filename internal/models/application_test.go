@@ -0,0 +1,58 @@
+package models_test
+
+import (
+	"github.com/MiG-21/go-sso/internal/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ApplicationModel", func() {
+	app := models.ApplicationModel{
+		RedirectUrl:            "https://app.example.com/",
+		RedirectUris:           "https://app.example.com/callback https://*.preview.example.com/auth/* http://localhost:8080/cb?mode=dev",
+		PostLogoutRedirectUris: "https://app.example.com/bye",
+	}
+
+	It("matches registered redirect uris exactly", func() {
+		Expect(app.AllowsRedirectUri("https://app.example.com/")).To(BeTrue())
+		Expect(app.AllowsRedirectUri("https://app.example.com/callback")).To(BeTrue())
+		Expect(app.AllowsRedirectUri("http://localhost:8080/cb?mode=dev")).To(BeTrue())
+		Expect(app.AllowsRedirectUri("https://app.example.com/callback/")).To(BeFalse())
+		Expect(app.AllowsRedirectUri("https://app.example.com/callback?next=https://evil.com")).To(BeFalse())
+		Expect(app.AllowsRedirectUri("http://app.example.com/callback")).To(BeFalse())
+		Expect(app.AllowsRedirectUri("")).To(BeFalse())
+	})
+
+	It("matches patterns within the host label and the path segment", func() {
+		Expect(app.AllowsRedirectUri("https://pr-12.preview.example.com/auth/done")).To(BeTrue())
+		Expect(app.AllowsRedirectUri("https://pr-12.preview.example.com/auth/done/more")).To(BeFalse())
+		Expect(app.AllowsRedirectUri("https://preview.example.com.evil.com/auth/done")).To(BeFalse())
+		Expect(app.AllowsRedirectUri("https://evil.com/?.preview.example.com/auth/done")).To(BeFalse())
+		Expect(app.AllowsRedirectUri("https://user@pr-12.preview.example.com/auth/done")).To(BeFalse())
+		Expect(app.AllowsRedirectUri("https://pr-12.preview.example.com/auth/..")).To(BeFalse())
+		Expect(app.AllowsRedirectUri("https://pr-12.preview.example.com/auth/done#x")).To(BeFalse())
+	})
+
+	It("never lets * match across the host labels", func() {
+		wildcard := models.ApplicationModel{RedirectUris: "https://*.example.com/cb https://app.example.*/cb https://app.*/cb https://*-qa.apps.example.com:8443/cb"}
+		Expect(wildcard.AllowsRedirectUri("https://app.example.com/cb")).To(BeTrue())
+		Expect(wildcard.AllowsRedirectUri("https://APP.Example.com/cb")).To(BeTrue())
+		Expect(wildcard.AllowsRedirectUri("https://pr-1-qa.apps.example.com:8443/cb")).To(BeTrue())
+		Expect(wildcard.AllowsRedirectUri("https://evil.com.example.com/cb")).To(BeFalse())
+		Expect(wildcard.AllowsRedirectUri("https://a.b.example.com/cb")).To(BeFalse())
+		Expect(wildcard.AllowsRedirectUri("https://example.com/cb")).To(BeFalse())
+		Expect(wildcard.AllowsRedirectUri("https://.example.com/cb")).To(BeFalse())
+		// the pattern of the registrable domain matches nothing
+		Expect(wildcard.AllowsRedirectUri("https://app.example.evil.com/cb")).To(BeFalse())
+		Expect(wildcard.AllowsRedirectUri("https://app.example.org/cb")).To(BeFalse())
+		Expect(wildcard.AllowsRedirectUri("https://app.evil.com/cb")).To(BeFalse())
+		Expect(wildcard.AllowsRedirectUri("https://pr-1-qa.apps.example.com/cb")).To(BeFalse())
+		Expect(wildcard.AllowsRedirectUri("https://pr-1-qa.apps.example.com:9443/cb")).To(BeFalse())
+	})
+
+	It("keeps post logout redirect uris apart", func() {
+		Expect(app.AllowsPostLogoutRedirectUri("https://app.example.com/bye")).To(BeTrue())
+		Expect(app.AllowsPostLogoutRedirectUri("https://app.example.com/callback")).To(BeFalse())
+		Expect(app.AllowsRedirectUri("https://app.example.com/bye")).To(BeFalse())
+	})
+})
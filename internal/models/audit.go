@@ -0,0 +1,77 @@
+package models
+
+import "context"
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+
+	AuditActionLogin               = "login"
+	AuditActionLoginFailed         = "login_failed"
+	AuditActionMfaFailed           = "mfa_failed"
+	AuditActionPasskeyFailed       = "passkey_failed"
+	AuditActionLogout              = "logout"
+	AuditActionToken               = "token"
+	AuditActionRegister            = "register"
+	AuditActionVerification        = "verification"
+	AuditActionPasswordRecover     = "password_recover"
+	AuditActionPasswordChange      = "password_change"
+	AuditActionPasswordExpired     = "password_expired"
+	AuditActionUserLocked          = "user_locked"
+	AuditActionUserUnlock          = "user_unlock"
+	AuditActionTotpEnroll          = "totp_enroll"
+	AuditActionTotpConfirm         = "totp_confirm"
+	AuditActionTotpDisable         = "totp_disable"
+	AuditActionRecoveryCodes       = "recovery_codes"
+	AuditActionRecoveryCodeUsed    = "recovery_code_used"
+	AuditActionPasskeyRegister     = "passkey_register"
+	AuditActionPasskeyDelete       = "passkey_delete"
+	AuditActionSessionRevoke       = "session_revoke"
+	AuditActionSessionsRevokeAll   = "sessions_revoke_all"
+	AuditActionApplicationCreate   = "application_create"
+	AuditActionAuditExport         = "audit_export"
+	AuditActionAuthorizationDenied = "authorization_denied"
+)
+
+type (
+	// AuditModel is a record of the security relevant action: ActorId is the user who acted, zero if anonymous,
+	// TargetId is the user the action is about, Subject names the target when there is no user id, e.g. the email
+	// of a failed login.
+	AuditModel struct {
+		Id          int64  `db:"id,primarykey,autoincrement"`
+		Action      string `db:"action,size:50"`
+		Outcome     string `db:"outcome,size:20"`
+		ActorId     int64  `db:"actor_id"`
+		TargetId    int64  `db:"target_id"`
+		Subject     string `db:"subject,size:255"`
+		Application string `db:"application,size:50"`
+		Ip          string `db:"ip,size:45"`
+		UserAgent   string `db:"user_agent,size:255"`
+		RequestId   string `db:"request_id,size:64"`
+		Detail      string `db:"detail,size:1024"`
+		Created     int64  `db:"created_at"`
+	}
+
+	// AuditFilter selects the records, zero values match everything. BeforeId pages by id, newest first.
+	AuditFilter struct {
+		Action      string
+		Outcome     string
+		ActorId     int64
+		TargetId    int64
+		Subject     string
+		Application string
+		Ip          string
+		From        int64
+		To          int64
+		BeforeId    int64
+		Offset      int
+		Limit       int
+	}
+
+	AuditManager interface {
+		Add(context.Context, *AuditModel) error
+		// Find returns the matching records, newest first.
+		Find(context.Context, *AuditFilter) ([]*AuditModel, error)
+		Count(context.Context, *AuditFilter) (int64, error)
+	}
+)
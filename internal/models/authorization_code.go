@@ -0,0 +1,36 @@
+package models
+
+import "context"
+
+type (
+	AuthorizationCodeModel struct {
+		Id                  int64  `db:"id,primarykey,autoincrement"`
+		Code                string `db:"code,size:64"`
+		ClientId            string `db:"client_id,size:50"`
+		UserId              int64  `db:"user_id"`
+		SessionId           string `db:"session_id,size:36"`
+		RedirectUri         string `db:"redirect_uri,size:255"`
+		Scope               string `db:"scope,size:255"`
+		CodeChallenge       string `db:"code_challenge,size:128"`
+		CodeChallengeMethod string `db:"code_challenge_method,size:10"`
+		Nonce               string `db:"nonce,size:255"`
+		AuthTime            int64  `db:"auth_time"`
+		Used                bool   `db:"used"`
+		ExpiresAt           int64  `db:"expires_at"`
+		Created             int64  `db:"created_at"`
+	}
+
+	AuthorizationCodeManager interface {
+		Create(context.Context, *AuthorizationCodeModel) error
+		// ByCode looks the code up by its hash.
+		ByCode(context.Context, string) (*AuthorizationCodeModel, error)
+		// Consume marks the code as used, false is returned if the code has been used already.
+		Consume(context.Context, *AuthorizationCodeModel) (bool, error)
+		// DeleteExpired removes the codes expired before the given unix time.
+		DeleteExpired(context.Context, int64) (int64, error)
+	}
+)
+
+func (m AuthorizationCodeModel) IsExpired(now int64) bool {
+	return m.ExpiresAt < now
+}
@@ -0,0 +1,34 @@
+package models
+
+import "context"
+
+const (
+	LoginFailureScopeUser = "user"
+	LoginFailureScopeIp   = "ip"
+)
+
+type (
+	// LoginFailureModel counts failed sign in attempts of an account or of a client ip within the window,
+	// Lockouts tells how many times the account got locked since its last successful sign in.
+	LoginFailureModel struct {
+		Id          int64  `db:"id,primarykey,autoincrement"`
+		Scope       string `db:"scope,size:10"`
+		Key         string `db:"key,size:255"`
+		Failures    int64  `db:"failures"`
+		Lockouts    int64  `db:"lockouts"`
+		WindowStart int64  `db:"window_start"`
+		BlockedTo   int64  `db:"blocked_to"`
+		Updated     int64  `db:"updated_at"`
+	}
+
+	LoginFailureManager interface {
+		ByKey(context.Context, string, string) (*LoginFailureModel, error)
+		// Count adds the failure to the counter of the scope and key in one statement and returns the counter,
+		// it starts over when its window started before the given time.
+		Count(ctx context.Context, scope, key string, since int64) (*LoginFailureModel, error)
+		// Save inserts or updates the counter.
+		Save(context.Context, *LoginFailureModel) error
+		// Reset removes the counter of the key.
+		Reset(context.Context, string, string) error
+	}
+)
@@ -0,0 +1,21 @@
+package models
+
+import "context"
+
+type (
+	// PasswordHistoryModel is a previous password hash of the user, kept to refuse its reuse.
+	PasswordHistoryModel struct {
+		Id       int64  `db:"id,primarykey,autoincrement"`
+		UserId   int64  `db:"user_id"`
+		Password string `db:"password,size:255"`
+		Created  int64  `db:"created_at"`
+	}
+
+	PasswordHistoryManager interface {
+		Add(context.Context, *PasswordHistoryModel) error
+		// Recent returns up to the given number of the latest hashes of the user, newest first.
+		Recent(context.Context, int64, int) ([]*PasswordHistoryModel, error)
+		// Prune keeps only the given number of the latest hashes of the user.
+		Prune(context.Context, int64, int) error
+	}
+)
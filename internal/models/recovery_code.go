@@ -0,0 +1,24 @@
+package models
+
+import "context"
+
+type (
+	// RecoveryCodeModel is a single-use code which replaces the second factor, only its hash is stored.
+	RecoveryCodeModel struct {
+		Id       int64  `db:"id,primarykey,autoincrement"`
+		UserId   int64  `db:"user_id"`
+		CodeHash string `db:"code_hash,size:64"`
+		UsedAt   int64  `db:"used_at"`
+		Created  int64  `db:"created_at"`
+	}
+
+	RecoveryCodeManager interface {
+		// Replace removes the codes of the user and stores the new set.
+		Replace(context.Context, int64, []*RecoveryCodeModel) error
+		// Use marks the unused code of the user as used, false is returned when there is no such code.
+		Use(context.Context, int64, string) (bool, error)
+		// Remaining returns the number of unused codes of the user.
+		Remaining(context.Context, int64) (int64, error)
+		DeleteByUser(context.Context, int64) error
+	}
+)
@@ -0,0 +1,37 @@
+package models
+
+import "context"
+
+type (
+	// RefreshTokenModel is the opaque refresh token, every rotation issues a new token within the same family.
+	RefreshTokenModel struct {
+		Id        int64  `db:"id,primarykey,autoincrement"`
+		Token     string `db:"token,size:64"`
+		FamilyId  string `db:"family_id,size:36"`
+		ParentId  int64  `db:"parent_id"`
+		ClientId  string `db:"client_id,size:50"`
+		UserId    int64  `db:"user_id"`
+		SessionId string `db:"session_id,size:36"`
+		Scope     string `db:"scope,size:255"`
+		Used      bool   `db:"used"`
+		Revoked   bool   `db:"revoked"`
+		ExpiresAt int64  `db:"expires_at"`
+		Created   int64  `db:"created_at"`
+	}
+
+	RefreshTokenManager interface {
+		Create(context.Context, *RefreshTokenModel) error
+		// ByToken looks the token up by its hash.
+		ByToken(context.Context, string) (*RefreshTokenModel, error)
+		// Consume marks the token as used, false is returned if the token has been used or revoked already.
+		Consume(context.Context, *RefreshTokenModel) (bool, error)
+		// RevokeFamily revokes every token of the family.
+		RevokeFamily(context.Context, string) (int64, error)
+		// DeleteExpired removes the tokens expired before the given unix time.
+		DeleteExpired(context.Context, int64) (int64, error)
+	}
+)
+
+func (m RefreshTokenModel) IsExpired(now int64) bool {
+	return m.ExpiresAt < now
+}
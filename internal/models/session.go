@@ -0,0 +1,39 @@
+package models
+
+import "context"
+
+type (
+	// SessionModel is a server side record of the login, tokens reference it by sid claim.
+	// Mfa is set when the login was confirmed by the second factor.
+	SessionModel struct {
+		Id        int64  `db:"id,primarykey,autoincrement"`
+		Sid       string `db:"sid,size:36"`
+		UserId    int64  `db:"user_id"`
+		ClientId  string `db:"client_id,size:50"`
+		Ip        string `db:"ip,size:45"`
+		UserAgent string `db:"user_agent,size:255"`
+		Revoked   bool   `db:"revoked"`
+		Mfa       bool   `db:"mfa"`
+		ExpiresAt int64  `db:"expires_at"`
+		Created   int64  `db:"created_at"`
+		LastSeen  int64  `db:"last_seen_at"`
+	}
+
+	SessionManager interface {
+		Create(context.Context, *SessionModel) error
+		BySid(context.Context, string) (*SessionModel, error)
+		// ByUser returns not revoked and not expired sessions of the user.
+		ByUser(context.Context, int64) ([]*SessionModel, error)
+		// Touch updates last_seen_at and expires_at of the session.
+		Touch(context.Context, *SessionModel) error
+		Revoke(context.Context, string) (int64, error)
+		// RevokeByUser revokes every session of the user.
+		RevokeByUser(context.Context, int64) (int64, error)
+		// DeleteExpired removes the sessions expired before the given unix time.
+		DeleteExpired(context.Context, int64) (int64, error)
+	}
+)
+
+func (m SessionModel) IsActive(now int64) bool {
+	return !m.Revoked && m.ExpiresAt >= now
+}
@@ -0,0 +1,19 @@
+package models
+
+import "context"
+
+type (
+	// SessionClientModel records the application which participated in the session, used for single logout.
+	SessionClientModel struct {
+		Id       int64  `db:"id,primarykey,autoincrement"`
+		Sid      string `db:"sid,size:36"`
+		ClientId string `db:"client_id,size:50"`
+		Created  int64  `db:"created_at"`
+	}
+
+	SessionClientManager interface {
+		// Add records the application participation, adding it twice is not an error.
+		Add(context.Context, *SessionClientModel) error
+		BySid(context.Context, string) ([]*SessionClientModel, error)
+	}
+)
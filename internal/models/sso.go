@@ -1,24 +1,92 @@
 package models
 
 import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/MiG-21/go-sso/internal"
 	"github.com/gofiber/fiber/v2"
 )
 
+var (
+	// ErrTimeout is returned by the managers when the deadline of the request passes before the storage answers.
+	ErrTimeout = errors.New("storage timeout")
+	// ErrUnavailable is returned by the managers when the request is canceled or the storage cannot be reached.
+	ErrUnavailable = errors.New("storage unavailable")
+	// ErrAlreadyExists is returned by the managers when the row violates a unique index, like a second user
+	// with the same email.
+	ErrAlreadyExists = errors.New("already exists")
+)
+
 type (
 	// SSOer is what it needs to be implemented for sso functionality.
 	SSOer interface {
 		UserManager() UserManager
 		ApplicationManager() ApplicationManager
+		AuthorizationCodeManager() AuthorizationCodeManager
+		RefreshTokenManager() RefreshTokenManager
+		SessionManager() SessionManager
+		SessionClientManager() SessionClientManager
+		TotpManager() TotpManager
+		WebAuthnCredentialManager() WebAuthnCredentialManager
+		WebAuthnChallengeManager() WebAuthnChallengeManager
+		RecoveryCodeManager() RecoveryCodeManager
+		LoginFailureManager() LoginFailureManager
+		PasswordHistoryManager() PasswordHistoryManager
+		AuditManager() AuditManager
+		// Transaction runs the function in a transaction, the managers take part in it when they are called with
+		// the context passed to the function. It is committed when the function returns nil and rolled back
+		// otherwise, nested calls join the outer transaction.
+		Transaction(context.Context, func(context.Context) error) error
 		// CTValidHours returns the cookie/jwt token validity in hours.
 		CTValidHours() int64
 		CookieName() string
 		CookieDomain() string
-		// BuildJWTToken takes the user and the user roles info which is then signed by the private
-		// key of the login server. The expiry of the token is set per the third argument.
-		BuildJWTToken(int64, []string, time.Time) (string, error)
+		// CodeValidSeconds returns the oauth authorization code validity in seconds.
+		CodeValidSeconds() int64
+		// AccessTokenValidMinutes returns the validity of access tokens issued along with refresh tokens.
+		AccessTokenValidMinutes() int64
+		// RefreshTokenValidHours returns the refresh token validity in hours.
+		RefreshTokenValidHours() int64
+		// BuildJWTToken takes the user, the user roles info, the session id, the application code as the audience
+		// and the granted scope which is then signed by the private key of the login server. The expiry of the token
+		// is set per the sixth argument.
+		BuildJWTToken(int64, []string, string, string, string, time.Time) (string, error)
+		// BuildSessionToken signs the token of the sso cookie for the user and the session id, it expires at the
+		// third argument.
+		BuildSessionToken(int64, string, time.Time) (string, error)
+		// BuildIdToken signs OpenID Connect id_token claims.
+		BuildIdToken(*internal.IdTokenClaims) (string, error)
+		// BuildLogoutToken signs OpenID Connect back-channel logout token claims.
+		BuildLogoutToken(*internal.LogoutTokenClaims) (string, error)
+		// Issuer returns configured OpenID Connect issuer, empty value means the issuer is taken from the request.
+		Issuer() string
+		// BuildMfaToken signs the token which proves the password of the user was checked, the token is exchanged
+		// for a session once the second factor is verified.
+		BuildMfaToken(int64, time.Time) (string, error)
+		// MfaIssuer returns the issuer name shown by authenticator apps.
+		MfaIssuer() string
+		// MfaChallengeValidMinutes returns the time the user has to enter the second factor.
+		MfaChallengeValidMinutes() int64
+		// MfaRequired reports whether any of the roles requires the second factor.
+		MfaRequired([]string) bool
+		// MfaRecoveryCodes returns the number of recovery codes issued to the user at once.
+		MfaRecoveryCodes() int
+		// LockoutPolicy returns the limits of failed sign in attempts.
+		LockoutPolicy() *internal.ConfigLockout
+		// PasswordPolicy returns the rules new passwords are checked against.
+		PasswordPolicy() *internal.PasswordPolicy
+		// PasswordHasher returns the hasher of new passwords.
+		PasswordHasher() internal.PasswordHasher
+		// PublicUrl returns the configured base url of the sso, empty if the request host has to be used.
+		PublicUrl() string
+		// SealSecret encrypts the secret to be stored at rest.
+		SealSecret(string) (string, error)
+		// OpenSecret decrypts the secret sealed by SealSecret.
+		OpenSecret(string) (string, error)
 		// BuildCookie takes the jwt token and returns a cookie and sets the expiration time of the same to that of
 		// the second arg.
 		BuildCookie(string, time.Time, string) *fiber.Cookie
@@ -27,13 +95,84 @@ type (
 	}
 
 	SSO struct {
-		Crypto *internal.ConfigCrypto
-		Cookie *internal.ConfigCookie
+		Crypto   *internal.ConfigCrypto
+		Cookie   *internal.ConfigCookie
+		OAuth    *internal.ConfigOAuth
+		Mfa      *internal.ConfigMfa
+		Lockout  *internal.ConfigLockout
+		Password *internal.PasswordPolicy
+		Hasher   internal.PasswordHasher
+		Http     *internal.ConfigHttp
 	}
 )
 
-func (sso SSO) BuildJWTToken(id int64, roles []string, exp time.Time) (string, error) {
-	return internal.GenSignInJWT(id, roles, sso.Crypto.PrivateKey, exp.Unix())
+func (sso SSO) BuildJWTToken(id int64, roles []string, sid, audience, scope string, exp time.Time) (string, error) {
+	return internal.GenSignInJWT(id, roles, sid, audience, scope, sso.Crypto.KeyRing.Active(), exp.Unix())
+}
+
+func (sso SSO) BuildSessionToken(id int64, sid string, exp time.Time) (string, error) {
+	return internal.GenSessionJWT(id, sid, sso.Crypto.KeyRing.Active(), exp.Unix())
+}
+
+func (sso SSO) BuildIdToken(claims *internal.IdTokenClaims) (string, error) {
+	return internal.GenIdTokenJWT(claims, sso.Crypto.KeyRing.Active())
+}
+
+func (sso SSO) BuildLogoutToken(claims *internal.LogoutTokenClaims) (string, error) {
+	return internal.GenLogoutTokenJWT(claims, sso.Crypto.KeyRing.Active())
+}
+
+func (sso SSO) Issuer() string {
+	return sso.OAuth.Issuer
+}
+
+func (sso SSO) BuildMfaToken(id int64, exp time.Time) (string, error) {
+	return internal.GenVerificationJWT(strconv.FormatInt(id, 10), UserActionMfa, sso.Crypto.KeyRing.Active(), exp.Unix())
+}
+
+func (sso SSO) MfaIssuer() string {
+	return sso.Mfa.Issuer
+}
+
+func (sso SSO) MfaChallengeValidMinutes() int64 {
+	return sso.Mfa.ChallengeValidMinutes
+}
+
+func (sso SSO) MfaRecoveryCodes() int {
+	return sso.Mfa.RecoveryCodes
+}
+
+func (sso SSO) MfaRequired(roles []string) bool {
+	for _, role := range roles {
+		if ok, _ := internal.InArray(strings.TrimSpace(role), sso.Mfa.RequiredRoles); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (sso SSO) LockoutPolicy() *internal.ConfigLockout {
+	return sso.Lockout
+}
+
+func (sso SSO) PasswordPolicy() *internal.PasswordPolicy {
+	return sso.Password
+}
+
+func (sso SSO) PasswordHasher() internal.PasswordHasher {
+	return sso.Hasher
+}
+
+func (sso SSO) PublicUrl() string {
+	return sso.Http.PublicUrl
+}
+
+func (sso SSO) SealSecret(plain string) (string, error) {
+	return sso.Crypto.SecretBox.Seal(plain)
+}
+
+func (sso SSO) OpenSecret(sealed string) (string, error) {
+	return sso.Crypto.SecretBox.Open(sealed)
 }
 
 func (sso SSO) CTValidHours() int64 {
@@ -48,6 +187,18 @@ func (sso SSO) CookieDomain() string {
 	return sso.Cookie.Domain
 }
 
+func (sso SSO) CodeValidSeconds() int64 {
+	return sso.OAuth.CodeValidSeconds
+}
+
+func (sso SSO) AccessTokenValidMinutes() int64 {
+	return sso.OAuth.AccessTokenValidMinutes
+}
+
+func (sso SSO) RefreshTokenValidHours() int64 {
+	return sso.OAuth.RefreshTokenValidHours
+}
+
 func (sso SSO) BuildCookie(value string, exp time.Time, domain string) *fiber.Cookie {
 	c := &fiber.Cookie{
 		Name:     sso.Cookie.Name,
@@ -77,5 +228,14 @@ func (sso SSO) Logout(exp time.Time, domain string) *fiber.Cookie {
 }
 
 func SetupSSO(config *internal.Config) *SSO {
-	return &SSO{&config.Crypto, &config.Cookie}
+	return &SSO{
+		Crypto:   &config.Crypto,
+		Cookie:   &config.Cookie,
+		OAuth:    &config.OAuth,
+		Mfa:      &config.Mfa,
+		Lockout:  &config.Lockout,
+		Password: internal.NewPasswordPolicy(&config.Password),
+		Hasher:   config.Password.Hasher,
+		Http:     &config.Http,
+	}
 }
@@ -0,0 +1,25 @@
+package models
+
+import "context"
+
+type (
+	// TotpModel is the authenticator app of the user, the secret is stored sealed.
+	TotpModel struct {
+		Id          int64  `db:"id,primarykey,autoincrement"`
+		UserId      int64  `db:"user_id"`
+		Secret      string `db:"secret,size:255"`
+		Confirmed   bool   `db:"confirmed"`
+		LastCounter int64  `db:"last_counter"`
+		Created     int64  `db:"created_at"`
+	}
+
+	TotpManager interface {
+		// Save replaces the authenticator of the user.
+		Save(context.Context, *TotpModel) error
+		ByUser(context.Context, int64) (*TotpModel, error)
+		Confirm(context.Context, *TotpModel) error
+		// Use moves the last used time step forward, false is returned when the step was already used.
+		Use(context.Context, *TotpModel, int64) (bool, error)
+		DeleteByUser(context.Context, int64) error
+	}
+)
@@ -1,59 +1,73 @@
 package models
 
 import (
-	"crypto/rsa"
+	"context"
+	"errors"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/MiG-21/go-sso/internal"
-	"github.com/gofiber/fiber/v2"
 )
 
 const (
 	UserActionActivation      = "activation"
 	UserActionPasswordRecover = "password_recover"
+	UserActionPasswordExpired = "password_expired"
+	UserActionMfa             = "mfa"
+)
+
+var (
+	// ErrInvalidCredentials is returned by Authenticate for unknown email or wrong password, only these
+	// attempts count towards the lockout.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUserLocked is returned by Authenticate for the user who is not verified or is locked, whatever the
+	// password, so the password of the locked account cannot be guessed.
+	ErrUserLocked = errors.New("user is not verified or locked")
 )
 
 type (
 	UserModel struct {
-		Id        int64  `db:"id,primarykey,autoincrement"`
-		Name      string `db:"name,size:255"`
-		Email     string `db:"email,size:255"`
-		Password  string `db:"password,size:100"`
-		Gender    string `db:"gender,size:50"`
-		Data      string `db:"data,size:2048"`
-		Role      string `db:"role,size:100"`
-		Active    bool   `db:"active"`
-		Locked    bool   `db:"locked"`
-		LockedTo  int64  `db:"locked_to"`
-		Code      string `db:"verification_code,size:50"`
-		Created   int64  `db:"created_at"`
-		Updated   int64  `db:"updated_at"`
-		LastVisit int64  `db:"last_visit_at"`
+		Id         int64  `db:"id,primarykey,autoincrement"`
+		Name       string `db:"name,size:255"`
+		Email      string `db:"email,size:255"`
+		Password   string `db:"password,size:255"`
+		Gender     string `db:"gender,size:50"`
+		Data       string `db:"data,size:2048"`
+		Role       string `db:"role,size:100"`
+		Active     bool   `db:"active"`
+		Locked     bool   `db:"locked"`
+		LockedTo   int64  `db:"locked_to"`
+		Code       string `db:"verification_code,size:50"`
+		MfaEnabled bool   `db:"mfa_enabled"`
+		// PasswordChanged is zero for users created before it was tracked, Created is used instead.
+		PasswordChanged int64 `db:"password_changed_at"`
+		Created         int64 `db:"created_at"`
+		Updated         int64 `db:"updated_at"`
+		LastVisit       int64 `db:"last_visit_at"`
 	}
 
 	UserManager interface {
-		Authenticate(string, string) (*UserModel, error)
-		Create(*UserModel) error
-		Delete(*UserModel) error
-		Update(*UserModel) (int64, error)
-		Validate(*UserModel) error
-		ById(int64) (*UserModel, error)
-		ByEmail(string) (*UserModel, error)
-		ByCode(string) (*UserModel, error)
+		Authenticate(context.Context, string, string) (*UserModel, error)
+		Create(context.Context, *UserModel) error
+		Delete(context.Context, *UserModel) error
+		Update(context.Context, *UserModel) (int64, error)
+		ById(context.Context, int64) (*UserModel, error)
+		ByEmail(context.Context, string) (*UserModel, error)
+		ByCode(context.Context, string) (*UserModel, error)
 	}
 )
 
-func (u UserModel) GetActionUrl(ctx *fiber.Ctx, path, action string, p *rsa.PrivateKey) (*url.URL, error) {
-	vUrl := &url.URL{}
-	vUrl.Scheme = ctx.Protocol()
-	vUrl.Host = ctx.Hostname()
-	vUrl.Path = path
+// GetActionUrl returns the link of the action signed for the verification code of the user, base is the public
+// url of the sso.
+func (u UserModel) GetActionUrl(base *url.URL, path, action string, k *internal.SigningKey) (*url.URL, error) {
+	vUrl := *base
+	vUrl.Path = strings.TrimRight(base.Path, "/") + path
 	exp := time.Now().Add(time.Hour * time.Duration(24)).UTC()
-	token, err := internal.GenVerificationJWT(u.Code, action, p, exp.Unix())
+	token, err := internal.GenVerificationJWT(u.Code, action, k, exp.Unix())
 	if err != nil {
 		return nil, err
 	}
 	vUrl.RawQuery = "token=" + token
-	return vUrl, nil
+	return &vUrl, nil
 }
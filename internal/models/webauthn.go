@@ -0,0 +1,60 @@
+package models
+
+import "context"
+
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	// WebAuthnCeremonyLogin is the passwordless sign in, user verification is required
+	WebAuthnCeremonyLogin = "login"
+	// WebAuthnCeremonyMfa is the second factor after the password check
+	WebAuthnCeremonyMfa = "mfa"
+)
+
+type (
+	// WebAuthnCredentialModel is the passkey or security key registered by the user.
+	WebAuthnCredentialModel struct {
+		Id              int64  `db:"id,primarykey,autoincrement"`
+		UserId          int64  `db:"user_id"`
+		CredentialId    string `db:"credential_id,size:255"`
+		PublicKey       []byte `db:"public_key"`
+		AttestationType string `db:"attestation_type,size:50"`
+		AAGUID          []byte `db:"aaguid"`
+		SignCount       int64  `db:"sign_count"`
+		Name            string `db:"name,size:100"`
+		Created         int64  `db:"created_at"`
+		LastUsed        int64  `db:"last_used_at"`
+	}
+
+	// WebAuthnChallengeModel is the pending registration or login ceremony, Data keeps the ceremony session.
+	WebAuthnChallengeModel struct {
+		Id        int64  `db:"id,primarykey,autoincrement"`
+		Challenge string `db:"challenge,size:100"`
+		UserId    int64  `db:"user_id"`
+		Ceremony  string `db:"ceremony,size:20"`
+		Data      string `db:"data,size:4096"`
+		ExpiresAt int64  `db:"expires_at"`
+		Created   int64  `db:"created_at"`
+	}
+
+	WebAuthnCredentialManager interface {
+		Create(context.Context, *WebAuthnCredentialModel) error
+		ByUser(context.Context, int64) ([]*WebAuthnCredentialModel, error)
+		// Use stores the sign counter reported by the authenticator and the time of use.
+		Use(context.Context, *WebAuthnCredentialModel) error
+		// Delete removes the credential of the user.
+		Delete(context.Context, int64, int64) (int64, error)
+	}
+
+	WebAuthnChallengeManager interface {
+		Create(context.Context, *WebAuthnChallengeModel) error
+		ByChallenge(context.Context, string) (*WebAuthnChallengeModel, error)
+		// Consume deletes the challenge, false is returned when it has been already consumed.
+		Consume(context.Context, *WebAuthnChallengeModel) (bool, error)
+		// DeleteExpired removes the challenges expired before the given unix time.
+		DeleteExpired(context.Context, int64) (int64, error)
+	}
+)
+
+func (m WebAuthnChallengeModel) IsExpired(now int64) bool {
+	return m.ExpiresAt < now
+}
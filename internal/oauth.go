@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+	"strings"
+)
+
+const (
+	PKCEMethodS256 = "S256"
+
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+
+	ResponseTypeCode = "code"
+
+	ScopeOpenId  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// pkceVerifierRe is code_verifier ABNF from RFC 7636 section 4.1
+var pkceVerifierRe = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// PKCEChallenge returns S256 code_challenge for the given code_verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks code_verifier against the stored code_challenge, only S256 method is supported.
+func VerifyPKCE(verifier, challenge, method string) bool {
+	if method != PKCEMethodS256 || !pkceVerifierRe.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// HasScope reports whether space delimited scope list contains the scope.
+func HasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
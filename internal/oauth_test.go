@@ -0,0 +1,33 @@
+package internal_test
+
+import (
+	"github.com/MiG-21/go-sso/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PKCE", func() {
+	// RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	It("PKCEChallenge", func() {
+		Expect(internal.PKCEChallenge(verifier)).To(Equal(challenge))
+	})
+
+	It("VerifyPKCE", func() {
+		Expect(internal.VerifyPKCE(verifier, challenge, internal.PKCEMethodS256)).To(BeTrue())
+		Expect(internal.VerifyPKCE(verifier, challenge, "plain")).To(BeFalse())
+		Expect(internal.VerifyPKCE(verifier+"x", challenge, internal.PKCEMethodS256)).To(BeFalse())
+		Expect(internal.VerifyPKCE("short", internal.PKCEChallenge("short"), internal.PKCEMethodS256)).To(BeFalse())
+	})
+})
+
+var _ = Describe("Scope", func() {
+	It("HasScope", func() {
+		Expect(internal.HasScope("openid email", internal.ScopeOpenId)).To(BeTrue())
+		Expect(internal.HasScope("openid  email ", internal.ScopeEmail)).To(BeTrue())
+		Expect(internal.HasScope("openidx", internal.ScopeOpenId)).To(BeFalse())
+		Expect(internal.HasScope("", internal.ScopeOpenId)).To(BeFalse())
+	})
+})
@@ -0,0 +1,13 @@
+package passkey_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPasskey(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Passkey Suite")
+}
@@ -0,0 +1,310 @@
+package passkey
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/duo-labs/webauthn/protocol"
+	"github.com/duo-labs/webauthn/webauthn"
+)
+
+var (
+	ErrInvalidCredential = errors.New("passkey is invalid or the challenge has expired")
+	ErrNoCredentials     = errors.New("no passkey is registered")
+)
+
+type (
+	// Service runs WebAuthn registration and login ceremonies, pending challenges are kept in the challenge store.
+	Service struct {
+		web      *webauthn.WebAuthn
+		sso      models.SSOer
+		validFor time.Duration
+	}
+
+	// user adapts the user model and its credentials to webauthn.User.
+	user struct {
+		model       *models.UserModel
+		credentials []*models.WebAuthnCredentialModel
+	}
+)
+
+func NewService(config *internal.ConfigWebAuthn, sso models.SSOer) (*Service, error) {
+	web, err := webauthn.New(&webauthn.Config{
+		RPDisplayName:         config.RPDisplayName,
+		RPID:                  config.RPID,
+		RPOrigin:              config.RPOrigin,
+		AttestationPreference: protocol.PreferNoAttestation,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		web:      web,
+		sso:      sso,
+		validFor: time.Second * time.Duration(config.ChallengeValidSeconds),
+	}, nil
+}
+
+// BeginRegistration returns credential creation options for the browser, already registered
+// authenticators are excluded.
+func (s *Service) BeginRegistration(ctx context.Context, model *models.UserModel) (*protocol.CredentialCreation, error) {
+	u, err := s.user(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	options, session, err := s.web.BeginRegistration(u, webauthn.WithExclusions(u.descriptors()))
+	if err != nil {
+		return nil, err
+	}
+	if err = s.saveChallenge(ctx, session, model.Id, models.WebAuthnCeremonyRegistration); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// FinishRegistration verifies the attestation response and stores the new credential.
+func (s *Service) FinishRegistration(ctx context.Context, model *models.UserModel, name string, body []byte) (*models.WebAuthnCredentialModel, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	challenge, session, err := s.consumeChallenge(ctx, parsed.Response.CollectedClientData.Challenge, models.WebAuthnCeremonyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UserId != model.Id {
+		return nil, ErrInvalidCredential
+	}
+
+	u, err := s.user(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.web.CreateCredential(u, *session, parsed)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+
+	item := &models.WebAuthnCredentialModel{
+		UserId:          model.Id,
+		CredentialId:    base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		Name:            name,
+	}
+	if err = s.sso.WebAuthnCredentialManager().Create(ctx, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// BeginLogin returns credential request options for the login or mfa ceremony. Passwordless login requires
+// user verification, nil user lets the authenticator offer any of its discoverable credentials.
+func (s *Service) BeginLogin(ctx context.Context, model *models.UserModel, ceremony string) (*protocol.CredentialAssertion, error) {
+	verification := protocol.VerificationRequired
+	if ceremony == models.WebAuthnCeremonyMfa {
+		verification = protocol.VerificationDiscouraged
+	}
+
+	// options are built here since the library refuses users without credentials, which discoverable login needs
+	challenge, err := protocol.CreateChallenge()
+	if err != nil {
+		return nil, err
+	}
+	options := &protocol.CredentialAssertion{
+		Response: protocol.PublicKeyCredentialRequestOptions{
+			Challenge:        challenge,
+			Timeout:          s.web.Config.Timeout,
+			RelyingPartyID:   s.web.Config.RPID,
+			UserVerification: verification,
+		},
+	}
+	session := &webauthn.SessionData{
+		Challenge:        base64.RawURLEncoding.EncodeToString(challenge),
+		UserVerification: verification,
+	}
+
+	var userId int64
+	if model != nil {
+		u, err := s.user(ctx, model)
+		if err != nil {
+			return nil, err
+		}
+		options.Response.AllowedCredentials = u.descriptors()
+		if len(options.Response.AllowedCredentials) == 0 && ceremony == models.WebAuthnCeremonyMfa {
+			return nil, ErrNoCredentials
+		}
+		session.UserID = u.WebAuthnID()
+		session.AllowedCredentialIDs = options.Response.GetAllowedCredentialIDs()
+		userId = model.Id
+	}
+
+	if err = s.saveChallenge(ctx, session, userId, ceremony); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// FinishLogin verifies the assertion response of the ceremony and returns the user, non zero userId
+// restricts the accepted credentials to the user, which the second factor requires.
+func (s *Service) FinishLogin(ctx context.Context, body []byte, ceremony string, userId int64) (*models.UserModel, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	challenge, session, err := s.consumeChallenge(ctx, parsed.Response.CollectedClientData.Challenge, ceremony)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerId := challenge.UserId
+	if ownerId == 0 {
+		// discoverable credential, the user handle tells the owner
+		if ownerId, err = strconv.ParseInt(string(parsed.Response.UserHandle), 10, 64); err != nil {
+			return nil, ErrInvalidCredential
+		}
+	}
+	if userId != 0 && ownerId != userId {
+		return nil, ErrInvalidCredential
+	}
+	model, err := s.sso.UserManager().ById(ctx, ownerId)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, ErrInvalidCredential
+	}
+
+	u, err := s.user(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	session.UserID = u.WebAuthnID()
+	credential, err := s.web.ValidateLogin(u, *session, parsed)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	// the counter went backwards, the private key may have been cloned
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrInvalidCredential
+	}
+
+	item := u.credential(credential.ID)
+	item.SignCount = int64(credential.Authenticator.SignCount)
+	if err = s.sso.WebAuthnCredentialManager().Use(ctx, item); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+func (s *Service) saveChallenge(ctx context.Context, session *webauthn.SessionData, userId int64, ceremony string) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.sso.WebAuthnChallengeManager().Create(ctx, &models.WebAuthnChallengeModel{
+		Challenge: session.Challenge,
+		UserId:    userId,
+		Ceremony:  ceremony,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(s.validFor).Unix(),
+	})
+}
+
+// consumeChallenge returns the pending challenge of the ceremony, every challenge is accepted only once.
+func (s *Service) consumeChallenge(ctx context.Context, value, ceremony string) (*models.WebAuthnChallengeModel, *webauthn.SessionData, error) {
+	challenge, err := s.sso.WebAuthnChallengeManager().ByChallenge(ctx, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge == nil || challenge.Ceremony != ceremony || challenge.IsExpired(time.Now().Unix()) {
+		return nil, nil, ErrInvalidCredential
+	}
+	ok, err := s.sso.WebAuthnChallengeManager().Consume(ctx, challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, ErrInvalidCredential
+	}
+
+	session := &webauthn.SessionData{}
+	if err = json.Unmarshal([]byte(challenge.Data), session); err != nil {
+		return nil, nil, err
+	}
+	return challenge, session, nil
+}
+
+func (s *Service) user(ctx context.Context, model *models.UserModel) (*user, error) {
+	credentials, err := s.sso.WebAuthnCredentialManager().ByUser(ctx, model.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &user{model: model, credentials: credentials}, nil
+}
+
+func (u *user) WebAuthnID() []byte {
+	return []byte(strconv.FormatInt(u.model.Id, 10))
+}
+
+func (u *user) WebAuthnName() string {
+	return u.model.Email
+}
+
+func (u *user) WebAuthnDisplayName() string {
+	return u.model.Name
+}
+
+func (u *user) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *user) WebAuthnCredentials() []webauthn.Credential {
+	var credentials []webauthn.Credential
+	for _, item := range u.credentials {
+		id, err := base64.RawURLEncoding.DecodeString(item.CredentialId)
+		if err != nil {
+			continue
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       item.PublicKey,
+			AttestationType: item.AttestationType,
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    item.AAGUID,
+				SignCount: uint32(item.SignCount),
+			},
+		})
+	}
+	return credentials
+}
+
+func (u *user) descriptors() []protocol.CredentialDescriptor {
+	var descriptors []protocol.CredentialDescriptor
+	for _, credential := range u.WebAuthnCredentials() {
+		descriptors = append(descriptors, protocol.CredentialDescriptor{
+			Type:         protocol.PublicKeyCredentialType,
+			CredentialID: credential.ID,
+		})
+	}
+	return descriptors
+}
+
+func (u *user) credential(id []byte) *models.WebAuthnCredentialModel {
+	value := base64.RawURLEncoding.EncodeToString(id)
+	for _, item := range u.credentials {
+		if item.CredentialId == value {
+			return item
+		}
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package passkey_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/passkey"
+	"github.com/duo-labs/webauthn/protocol"
+	"github.com/fxamacker/cbor/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	rpId     = "localhost"
+	rpOrigin = "http://localhost:8080"
+)
+
+type (
+	fakeSSO struct {
+		models.SSOer
+		users       *fakeUsers
+		credentials *fakeCredentials
+		challenges  *fakeChallenges
+	}
+
+	fakeUsers struct {
+		models.UserManager
+		items map[int64]*models.UserModel
+	}
+
+	fakeCredentials struct {
+		items []*models.WebAuthnCredentialModel
+	}
+
+	fakeChallenges struct {
+		items map[string]*models.WebAuthnChallengeModel
+	}
+
+	// authenticator is a software authenticator creating ES256 credentials with "none" attestation.
+	authenticator struct {
+		key        *ecdsa.PrivateKey
+		id         []byte
+		userHandle []byte
+		counter    uint32
+	}
+)
+
+func (f *fakeSSO) UserManager() models.UserManager { return f.users }
+
+func (f *fakeSSO) WebAuthnCredentialManager() models.WebAuthnCredentialManager { return f.credentials }
+
+func (f *fakeSSO) WebAuthnChallengeManager() models.WebAuthnChallengeManager { return f.challenges }
+
+func (f *fakeUsers) ById(_ context.Context, id int64) (*models.UserModel, error) {
+	return f.items[id], nil
+}
+
+func (f *fakeCredentials) Create(_ context.Context, model *models.WebAuthnCredentialModel) error {
+	model.Id = int64(len(f.items) + 1)
+	f.items = append(f.items, model)
+	return nil
+}
+
+func (f *fakeCredentials) ByUser(_ context.Context, userId int64) ([]*models.WebAuthnCredentialModel, error) {
+	var items []*models.WebAuthnCredentialModel
+	for _, item := range f.items {
+		if item.UserId == userId {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	return items, nil
+}
+
+func (f *fakeCredentials) Use(_ context.Context, model *models.WebAuthnCredentialModel) error {
+	for _, item := range f.items {
+		if item.Id == model.Id {
+			item.SignCount = model.SignCount
+		}
+	}
+	return nil
+}
+
+func (f *fakeCredentials) Delete(context.Context, int64, int64) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeChallenges) Create(_ context.Context, model *models.WebAuthnChallengeModel) error {
+	f.items[model.Challenge] = model
+	return nil
+}
+
+func (f *fakeChallenges) ByChallenge(_ context.Context, challenge string) (*models.WebAuthnChallengeModel, error) {
+	return f.items[challenge], nil
+}
+
+func (f *fakeChallenges) Consume(_ context.Context, model *models.WebAuthnChallengeModel) (bool, error) {
+	if _, ok := f.items[model.Challenge]; !ok {
+		return false, nil
+	}
+	delete(f.items, model.Challenge)
+	return true, nil
+}
+
+func (f *fakeChallenges) DeleteExpired(context.Context, int64) (int64, error) {
+	return 0, nil
+}
+
+func newAuthenticator() *authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+	id := make([]byte, 32)
+	_, err = rand.Read(id)
+	Expect(err).To(BeNil())
+	return &authenticator{key: key, id: id}
+}
+
+func (a *authenticator) authData(attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	// user present and user verified
+	flags := byte(0x01 | 0x04)
+	if attested {
+		flags |= 0x40
+	}
+	data := append(rpIdHash[:], flags)
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, a.counter)
+	data = append(data, counter...)
+	if !attested {
+		return data
+	}
+
+	data = append(data, make([]byte, 16)...)
+	idLen := make([]byte, 2)
+	binary.BigEndian.PutUint16(idLen, uint16(len(a.id)))
+	data = append(data, idLen...)
+	data = append(data, a.id...)
+	coseKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,
+		3:  -7,
+		-1: 1,
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	Expect(err).To(BeNil())
+	return append(data, coseKey...)
+}
+
+func clientData(ceremony protocol.CeremonyType, challenge protocol.Challenge) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      string(ceremony),
+		"challenge": challenge.String(),
+		"origin":    rpOrigin,
+	})
+	Expect(err).To(BeNil())
+	return data
+}
+
+func (a *authenticator) create(options *protocol.CredentialCreation) []byte {
+	a.userHandle = options.Response.User.ID
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(true),
+	})
+	Expect(err).To(BeNil())
+	return a.response(map[string]string{
+		"clientDataJSON":    encode(clientData(protocol.CreateCeremony, options.Response.Challenge)),
+		"attestationObject": encode(attestation),
+	})
+}
+
+func (a *authenticator) get(options *protocol.CredentialAssertion) []byte {
+	a.counter++
+	authData := a.authData(false)
+	data := clientData(protocol.AssertCeremony, options.Response.Challenge)
+	hash := sha256.Sum256(data)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), hash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	Expect(err).To(BeNil())
+	return a.response(map[string]string{
+		"clientDataJSON":    encode(data),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *authenticator) response(response map[string]string) []byte {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       encode(a.id),
+		"rawId":    encode(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	Expect(err).To(BeNil())
+	return body
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+var _ = Describe("Service", func() {
+	var (
+		ctx     = context.Background()
+		service *passkey.Service
+		user    *models.UserModel
+		other   *models.UserModel
+		device  *authenticator
+	)
+
+	BeforeEach(func() {
+		user = &models.UserModel{Id: 1, Name: "User", Email: "user@example.com"}
+		other = &models.UserModel{Id: 2, Name: "Other", Email: "other@example.com"}
+		sso := &fakeSSO{
+			users:       &fakeUsers{items: map[int64]*models.UserModel{user.Id: user, other.Id: other}},
+			credentials: &fakeCredentials{},
+			challenges:  &fakeChallenges{items: map[string]*models.WebAuthnChallengeModel{}},
+		}
+		var err error
+		service, err = passkey.NewService(&internal.ConfigWebAuthn{
+			RPDisplayName:         "go-sso",
+			RPID:                  rpId,
+			RPOrigin:              rpOrigin,
+			ChallengeValidSeconds: 300,
+		}, sso)
+		Expect(err).To(BeNil())
+
+		device = newAuthenticator()
+		options, err := service.BeginRegistration(ctx, user)
+		Expect(err).To(BeNil())
+		Expect(options.Response.User.ID).To(Equal([]byte(strconv.FormatInt(user.Id, 10))))
+		credential, err := service.FinishRegistration(ctx, user, "laptop", device.create(options))
+		Expect(err).To(BeNil())
+		Expect(credential.CredentialId).To(Equal(encode(device.id)))
+	})
+
+	It("rejects registration of another user", func() {
+		options, err := service.BeginRegistration(ctx, user)
+		Expect(err).To(BeNil())
+		_, err = service.FinishRegistration(ctx, other, "laptop", newAuthenticator().create(options))
+		Expect(err).To(Equal(passkey.ErrInvalidCredential))
+	})
+
+	It("signs in passwordless with discoverable credential", func() {
+		options, err := service.BeginLogin(ctx, nil, models.WebAuthnCeremonyLogin)
+		Expect(err).To(BeNil())
+		Expect(options.Response.AllowedCredentials).To(BeEmpty())
+		Expect(options.Response.UserVerification).To(Equal(protocol.VerificationRequired))
+
+		signedIn, err := service.FinishLogin(ctx, device.get(options), models.WebAuthnCeremonyLogin, 0)
+		Expect(err).To(BeNil())
+		Expect(signedIn.Id).To(Equal(user.Id))
+	})
+
+	It("verifies the second factor of the user", func() {
+		options, err := service.BeginLogin(ctx, user, models.WebAuthnCeremonyMfa)
+		Expect(err).To(BeNil())
+		Expect(options.Response.AllowedCredentials).To(HaveLen(1))
+		signedIn, err := service.FinishLogin(ctx, device.get(options), models.WebAuthnCeremonyMfa, user.Id)
+		Expect(err).To(BeNil())
+		Expect(signedIn.Id).To(Equal(user.Id))
+
+		options, err = service.BeginLogin(ctx, user, models.WebAuthnCeremonyMfa)
+		Expect(err).To(BeNil())
+		_, err = service.FinishLogin(ctx, device.get(options), models.WebAuthnCeremonyMfa, other.Id)
+		Expect(err).To(Equal(passkey.ErrInvalidCredential))
+
+		_, err = service.BeginLogin(ctx, other, models.WebAuthnCeremonyMfa)
+		Expect(err).To(Equal(passkey.ErrNoCredentials))
+	})
+
+	It("rejects second factor challenge for passwordless login", func() {
+		options, err := service.BeginLogin(ctx, user, models.WebAuthnCeremonyMfa)
+		Expect(err).To(BeNil())
+		_, err = service.FinishLogin(ctx, device.get(options), models.WebAuthnCeremonyLogin, 0)
+		Expect(err).To(Equal(passkey.ErrInvalidCredential))
+	})
+
+	It("rejects replayed assertion", func() {
+		options, err := service.BeginLogin(ctx, nil, models.WebAuthnCeremonyLogin)
+		Expect(err).To(BeNil())
+		body := device.get(options)
+		_, err = service.FinishLogin(ctx, body, models.WebAuthnCeremonyLogin, 0)
+		Expect(err).To(BeNil())
+		_, err = service.FinishLogin(ctx, body, models.WebAuthnCeremonyLogin, 0)
+		Expect(err).To(Equal(passkey.ErrInvalidCredential))
+	})
+
+	It("rejects cloned authenticator", func() {
+		options, err := service.BeginLogin(ctx, nil, models.WebAuthnCeremonyLogin)
+		Expect(err).To(BeNil())
+		_, err = service.FinishLogin(ctx, device.get(options), models.WebAuthnCeremonyLogin, 0)
+		Expect(err).To(BeNil())
+
+		device.counter = 0
+		options, err = service.BeginLogin(ctx, nil, models.WebAuthnCeremonyLogin)
+		Expect(err).To(BeNil())
+		_, err = service.FinishLogin(ctx, device.get(options), models.WebAuthnCeremonyLogin, 0)
+		Expect(err).To(Equal(passkey.ErrInvalidCredential))
+	})
+})
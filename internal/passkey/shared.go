@@ -0,0 +1,30 @@
+package passkey
+
+import (
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"go.uber.org/dig"
+)
+
+type (
+	SetupResult struct {
+		dig.Out
+
+		PasskeyService *Service
+		Error          error `group:"errors"`
+	}
+)
+
+func SetupService(config *internal.Config, sso models.SSOer) SetupResult {
+	sr := SetupResult{}
+
+	service, err := NewService(&config.WebAuthn, sso)
+	if err != nil {
+		sr.Error = err
+		return sr
+	}
+
+	sr.PasskeyService = service
+
+	return sr
+}
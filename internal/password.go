@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	PasswordViolationMinLength = "min_length"
+	PasswordViolationMaxBytes  = "max_bytes"
+	PasswordViolationLower     = "lowercase"
+	PasswordViolationUpper     = "uppercase"
+	PasswordViolationDigit     = "digit"
+	PasswordViolationSymbol    = "symbol"
+	PasswordViolationPersonal  = "personal_info"
+	PasswordViolationWeak      = "min_entropy"
+	PasswordViolationBreached  = "breached"
+	PasswordViolationReused    = "reused"
+
+	// bcryptMaxBytes is the length bcrypt silently truncates passwords to
+	bcryptMaxBytes = 72
+)
+
+type (
+	// PasswordViolation is a failed rule of the policy, Param is the configured limit if the rule has one.
+	PasswordViolation struct {
+		Tag   string
+		Param string
+	}
+
+	PasswordPolicy struct {
+		config *ConfigPassword
+	}
+)
+
+func NewPasswordPolicy(config *ConfigPassword) *PasswordPolicy {
+	return &PasswordPolicy{config: config}
+}
+
+// HistorySize returns the number of previous passwords which cannot be reused.
+func (p *PasswordPolicy) HistorySize() int {
+	return p.config.HistorySize
+}
+
+// Expired reports whether the password changed at the given unix time is older than the maximum age.
+func (p *PasswordPolicy) Expired(changed int64, now time.Time) bool {
+	if p.config.MaxAgeDays <= 0 {
+		return false
+	}
+	return changed+p.config.MaxAgeDays*24*60*60 < now.Unix()
+}
+
+// Check returns the rules the password breaks, personal are the values the password must not contain,
+// such as the email and the name of the user. The error is returned only when the breach lookup fails
+// and the policy is not configured to fail open.
+func (p *PasswordPolicy) Check(password string, personal ...string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+	c := p.config
+
+	if len([]rune(password)) < c.MinLength {
+		violations = append(violations, PasswordViolation{PasswordViolationMinLength, strconv.Itoa(c.MinLength)})
+	}
+	maxBytes := c.MaxBytes
+	// bcrypt ignores everything past 72 bytes, argon2id has no such limit
+	if c.Hashing.Algorithm != HashAlgorithmArgon2id && (maxBytes <= 0 || maxBytes > bcryptMaxBytes) {
+		maxBytes = bcryptMaxBytes
+	}
+	if maxBytes > 0 && len(password) > maxBytes {
+		violations = append(violations, PasswordViolation{PasswordViolationMaxBytes, strconv.Itoa(maxBytes)})
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if c.RequireLower && !lower {
+		violations = append(violations, PasswordViolation{Tag: PasswordViolationLower})
+	}
+	if c.RequireUpper && !upper {
+		violations = append(violations, PasswordViolation{Tag: PasswordViolationUpper})
+	}
+	if c.RequireDigit && !digit {
+		violations = append(violations, PasswordViolation{Tag: PasswordViolationDigit})
+	}
+	if c.RequireSymbol && !symbol {
+		violations = append(violations, PasswordViolation{Tag: PasswordViolationSymbol})
+	}
+
+	if c.DisallowPersonal && containsPersonal(password, personal) {
+		violations = append(violations, PasswordViolation{Tag: PasswordViolationPersonal})
+	}
+
+	if c.MinEntropy > 0 && PasswordEntropy(password) < c.MinEntropy {
+		violations = append(violations, PasswordViolation{PasswordViolationWeak, strconv.FormatFloat(c.MinEntropy, 'f', -1, 64)})
+	}
+
+	if c.Breached != nil {
+		count, err := c.Breached.Count(password)
+		if err != nil && !c.Breach.FailOpen {
+			return nil, err
+		}
+		if err == nil && count > 0 && count >= c.Breach.MinCount {
+			violations = append(violations, PasswordViolation{Tag: PasswordViolationBreached})
+		}
+	}
+	return violations, nil
+}
+
+// PasswordEntropy estimates the strength of the password in bits from the character classes it uses, characters
+// repeating or continuing a sequence of the previous one, like "aaa" or "abc", are not counted.
+func PasswordEntropy(password string) float64 {
+	var pool float64
+	var lower, upper, digit, symbol, other bool
+	length := 0
+	var prev rune
+	for i, r := range password {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLower(r):
+			lower = true
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+		if i == 0 || (r != prev && r != prev+1 && r != prev-1) {
+			length++
+		}
+		prev = r
+	}
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(length) * math.Log2(pool)
+}
+
+func containsPersonal(password string, personal []string) bool {
+	password = strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		// the local part of the email is what people reuse
+		if i := strings.Index(value, "@"); i > 0 {
+			value = value[:i]
+		}
+		for _, part := range strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len(part) >= 3 && strings.Contains(password, part) {
+				return true
+			}
+		}
+	}
+	return false
+}
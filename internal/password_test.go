@@ -0,0 +1,65 @@
+package internal_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PasswordPolicy", func() {
+	policy := internal.NewPasswordPolicy(&internal.ConfigPassword{
+		MinLength:        10,
+		MaxBytes:         72,
+		RequireLower:     true,
+		RequireUpper:     true,
+		RequireDigit:     true,
+		DisallowPersonal: true,
+		MinEntropy:       50,
+	})
+
+	tags := func(violations []internal.PasswordViolation, err error) []string {
+		Expect(err).NotTo(HaveOccurred())
+		var out []string
+		for _, v := range violations {
+			out = append(out, v.Tag)
+		}
+		return out
+	}
+
+	It("accepts a strong password", func() {
+		Expect(tags(policy.Check("kT9vQz2mWpX4", "john.smith@example.com", "John Smith"))).To(BeEmpty())
+	})
+
+	It("reports every broken rule", func() {
+		Expect(tags(policy.Check("abc"))).To(ConsistOf(
+			internal.PasswordViolationMinLength,
+			internal.PasswordViolationUpper,
+			internal.PasswordViolationDigit,
+			internal.PasswordViolationWeak,
+		))
+		Expect(tags(policy.Check(strings.Repeat("kT9vQz2mWp", 8)))).To(ContainElement(internal.PasswordViolationMaxBytes))
+	})
+
+	It("rejects personal info", func() {
+		Expect(tags(policy.Check("Smith2024xQ!", "john.smith@example.com", "John Smith"))).
+			To(ContainElement(internal.PasswordViolationPersonal))
+	})
+
+	It("does not count repeats and sequences", func() {
+		Expect(internal.PasswordEntropy("aaaaaaaa")).To(BeNumerically("<", internal.PasswordEntropy("azbycxdw")))
+		Expect(internal.PasswordEntropy("abcdefgh")).To(Equal(internal.PasswordEntropy("a")))
+	})
+
+	It("expires old passwords only when the maximum age is set", func() {
+		now := time.Now()
+		old := now.Add(-31 * 24 * time.Hour).Unix()
+		Expect(policy.Expired(old, now)).To(BeFalse())
+
+		expiring := internal.NewPasswordPolicy(&internal.ConfigPassword{MaxAgeDays: 30})
+		Expect(expiring.Expired(old, now)).To(BeTrue())
+		Expect(expiring.Expired(now.Add(-29*24*time.Hour).Unix(), now)).To(BeFalse())
+	})
+})
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+type (
+	// TrustedProxies are the reverse proxies the forwarded headers are honored from, addresses or CIDR ranges.
+	TrustedProxies struct {
+		nets []*net.IPNet
+	}
+)
+
+func NewTrustedProxies(items []string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, errors.New("invalid trusted proxy address " + item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			t.nets = append(t.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		t.nets = append(t.nets, ipNet)
+	}
+	return t, nil
+}
+
+// Contains reports whether the address belongs to a trusted proxy.
+func (t *TrustedProxies) Contains(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range t.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ranges returns the trusted proxies as CIDR ranges, the web server checks the peer of X-Forwarded-Proto and
+// X-Forwarded-Host against them, so both see the same proxies.
+func (t *TrustedProxies) Ranges() []string {
+	ranges := make([]string, 0, len(t.nets))
+	for _, ipNet := range t.nets {
+		ranges = append(ranges, ipNet.String())
+	}
+	return ranges
+}
+
+// ClientIp returns the address of the client: the peer itself unless it is a trusted proxy, otherwise the right-most
+// X-Forwarded-For address not belonging to a trusted proxy. The addresses left of the first invalid one are ignored,
+// they are as good as forged.
+func (t *TrustedProxies) ClientIp(peer, forwardedFor string) string {
+	if !t.Contains(peer) || forwardedFor == "" {
+		return peer
+	}
+	client := peer
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		client = hop
+		if !t.Contains(hop) {
+			break
+		}
+	}
+	return client
+}
+
+// parsePublicUrl checks the public base url the links are built from, it has to be absolute and without query.
+func parsePublicUrl(value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return errors.New("public url has to be an absolute http(s) url without query, got " + value)
+	}
+	return nil
+}
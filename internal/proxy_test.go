@@ -0,0 +1,43 @@
+package internal_test
+
+import (
+	"github.com/MiG-21/go-sso/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TrustedProxies", func() {
+	proxies, err := internal.NewTrustedProxies([]string{"10.0.0.0/8", "192.168.1.10", "fd00::/8"})
+
+	It("parses addresses and ranges", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxies.Contains("10.1.2.3")).To(BeTrue())
+		Expect(proxies.Contains("192.168.1.10")).To(BeTrue())
+		Expect(proxies.Contains("192.168.1.11")).To(BeFalse())
+		Expect(proxies.Contains("fd00::1")).To(BeTrue())
+		Expect(proxies.Contains("garbage")).To(BeFalse())
+
+		_, err := internal.NewTrustedProxies([]string{"10.0.0.0/99"})
+		Expect(err).To(HaveOccurred())
+		_, err = internal.NewTrustedProxies([]string{"proxy.local"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lists the proxies as ranges", func() {
+		proxies, err := internal.NewTrustedProxies([]string{" 10.0.0.0/8", "192.168.1.10 ", "FD00::1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxies.Ranges()).To(Equal([]string{"10.0.0.0/8", "192.168.1.10/32", "fd00::1/128"}))
+	})
+
+	It("ignores forwarded addresses from untrusted peers", func() {
+		Expect(proxies.ClientIp("203.0.113.5", "198.51.100.1")).To(Equal("203.0.113.5"))
+	})
+
+	It("takes the right-most untrusted forwarded address", func() {
+		Expect(proxies.ClientIp("10.0.0.1", "198.51.100.1")).To(Equal("198.51.100.1"))
+		Expect(proxies.ClientIp("10.0.0.1", "1.2.3.4, 198.51.100.1, 192.168.1.10")).To(Equal("198.51.100.1"))
+		Expect(proxies.ClientIp("10.0.0.1", "10.0.0.2, 10.0.0.3")).To(Equal("10.0.0.2"))
+		Expect(proxies.ClientIp("10.0.0.1", "198.51.100.1, junk, 10.0.0.3")).To(Equal("10.0.0.3"))
+		Expect(proxies.ClientIp("10.0.0.1", "")).To(Equal("10.0.0.1"))
+	})
+})
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+)
+
+const (
+	ByIp     = internal.RateLimitByIp
+	ByEmail  = internal.RateLimitByEmail
+	ByClient = internal.RateLimitByClient
+)
+
+type (
+	// Storage keeps fixed window counters, a shared implementation lets several instances enforce the same limits.
+	Storage interface {
+		// Hit counts the request in the current window of the key, it returns the count and the window end.
+		Hit(key string, window time.Duration, now time.Time) (int64, time.Time, error)
+	}
+
+	Rule struct {
+		Limit  int64
+		Window time.Duration
+		By     []string
+	}
+
+	// Limiter applies the configured rules of the routes to the buckets kept in the storage.
+	Limiter struct {
+		storage Storage
+		rules   map[string]Rule
+	}
+)
+
+func NewLimiter(config *internal.ConfigRateLimit, storage Storage) *Limiter {
+	l := &Limiter{
+		storage: storage,
+		rules:   map[string]Rule{},
+	}
+	if !config.Enabled {
+		return l
+	}
+	for name, r := range config.Rules {
+		if r.Limit <= 0 || r.WindowSeconds <= 0 {
+			continue
+		}
+		by := r.By
+		if len(by) == 0 {
+			by = []string{ByIp}
+		}
+		l.rules[name] = Rule{
+			Limit:  r.Limit,
+			Window: time.Second * time.Duration(r.WindowSeconds),
+			By:     by,
+		}
+	}
+	return l
+}
+
+// Rule returns the rule of the route, false means the route is not limited.
+func (l *Limiter) Rule(route string) (Rule, bool) {
+	r, ok := l.rules[route]
+	return r, ok
+}
+
+// Allow counts the request of the route in the bucket, non zero duration tells how long the client has to wait.
+func (l *Limiter) Allow(route, by, value string) (time.Duration, error) {
+	r, ok := l.rules[route]
+	if !ok {
+		return 0, nil
+	}
+	now := time.Now()
+	key := route + ":" + by + ":" + strings.ToLower(value)
+	count, reset, err := l.storage.Hit(key, r.Window, now)
+	if err != nil {
+		return 0, err
+	}
+	if count <= r.Limit {
+		return 0, nil
+	}
+	wait := reset.Sub(now)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait, nil
+}
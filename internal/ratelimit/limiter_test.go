@@ -0,0 +1,68 @@
+package ratelimit_test
+
+import (
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/ratelimit"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiter", func() {
+	config := &internal.ConfigRateLimit{
+		Enabled: true,
+		Rules: map[string]internal.ConfigRateLimitRule{
+			"register": {Limit: 2, WindowSeconds: 60, By: []string{ratelimit.ByIp, ratelimit.ByEmail}},
+		},
+	}
+
+	It("limits every bucket separately", func() {
+		l := ratelimit.NewLimiter(config, ratelimit.NewMemoryStorage())
+		for i := 0; i < 2; i++ {
+			Expect(l.Allow("register", ratelimit.ByIp, "10.0.0.1")).To(BeZero())
+		}
+		wait, err := l.Allow("register", ratelimit.ByIp, "10.0.0.1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeNumerically(">", 0))
+		Expect(wait).To(BeNumerically("<=", time.Minute))
+
+		Expect(l.Allow("register", ratelimit.ByIp, "10.0.0.2")).To(BeZero())
+		Expect(l.Allow("register", ratelimit.ByEmail, "User@example.com")).To(BeZero())
+		Expect(l.Allow("register", ratelimit.ByEmail, "user@example.com")).To(BeZero())
+		Expect(l.Allow("register", ratelimit.ByEmail, "user@example.com")).To(BeNumerically(">", 0))
+	})
+
+	It("ignores routes without rules", func() {
+		l := ratelimit.NewLimiter(config, ratelimit.NewMemoryStorage())
+		_, ok := l.Rule("login")
+		Expect(ok).To(BeFalse())
+		Expect(l.Allow("login", ratelimit.ByIp, "10.0.0.1")).To(BeZero())
+	})
+
+	It("can be disabled", func() {
+		disabled := *config
+		disabled.Enabled = false
+		l := ratelimit.NewLimiter(&disabled, ratelimit.NewMemoryStorage())
+		_, ok := l.Rule("register")
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("MemoryStorage", func() {
+	It("starts a new window once the previous one ends", func() {
+		m := ratelimit.NewMemoryStorage()
+		now := time.Unix(1000, 0)
+		count, reset, err := m.Hit("key", time.Minute, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(int64(1)))
+		Expect(reset).To(Equal(now.Add(time.Minute)))
+
+		count, _, _ = m.Hit("key", time.Minute, now.Add(time.Second*59))
+		Expect(count).To(Equal(int64(2)))
+
+		count, reset, _ = m.Hit("key", time.Minute, now.Add(time.Minute))
+		Expect(count).To(Equal(int64(1)))
+		Expect(reset).To(Equal(now.Add(time.Minute * 2)))
+	})
+})
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// memorySweepInterval limits the removal of ended windows to one pass per interval
+const memorySweepInterval = time.Minute
+
+type (
+	// MemoryStorage keeps the counters in the process, limits are enforced per instance.
+	MemoryStorage struct {
+		mutex     sync.Mutex
+		counters  map[string]*counter
+		lastSweep time.Time
+	}
+
+	counter struct {
+		count int64
+		reset time.Time
+	}
+)
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{counters: map[string]*counter{}}
+}
+
+func (m *MemoryStorage) Hit(key string, window time.Duration, now time.Time) (int64, time.Time, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if now.Sub(m.lastSweep) > memorySweepInterval {
+		m.sweep(now)
+	}
+
+	c, ok := m.counters[key]
+	if !ok || !now.Before(c.reset) {
+		c = &counter{reset: now.Add(window)}
+		m.counters[key] = c
+	}
+	c.count++
+	return c.count, c.reset, nil
+}
+
+func (m *MemoryStorage) sweep(now time.Time) {
+	for key, c := range m.counters {
+		if !now.Before(c.reset) {
+			delete(m.counters, key)
+		}
+	}
+	m.lastSweep = now
+}
@@ -0,0 +1,21 @@
+package ratelimit
+
+import (
+	"github.com/MiG-21/go-sso/internal"
+	"go.uber.org/dig"
+)
+
+type (
+	SetupResult struct {
+		dig.Out
+
+		Limiter *Limiter
+		Error   error `group:"errors"`
+	}
+)
+
+func SetupLimiter(config *internal.Config) SetupResult {
+	return SetupResult{
+		Limiter: NewLimiter(&config.RateLimit, NewMemoryStorage()),
+	}
+}
@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"strings"
+)
+
+// RecoveryCodeLength is the number of characters of a recovery code without the separator
+const RecoveryCodeLength = 10
+
+// GenerateRecoveryCodes returns n random single-use codes formatted as xxxxx-xxxxx.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		// 7 bytes give 56 bits, which encode to 12 base32 characters
+		b, err := randomBytes(7)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))[:RecoveryCodeLength]
+		codes = append(codes, code[:RecoveryCodeLength/2]+"-"+code[RecoveryCodeLength/2:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode returns the stored form of the code, case, spaces and separators typed by the user are ignored.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return HashToken(code)
+}
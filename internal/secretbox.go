@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+)
+
+var (
+	ErrSecretKeyMissing = errors.New("secret key is not configured")
+	errSealedTooShort   = errors.New("sealed value is too short")
+)
+
+// SecretBox encrypts values stored at rest with AES-256-GCM, the nonce is prepended to the ciphertext.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox takes base64 encoded 32 byte key.
+func NewSecretBox(key string) (*SecretBox, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32 {
+		return nil, errors.New("secret key must be 32 bytes long")
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretBox{aead: aead}, nil
+}
+
+func (b *SecretBox) Seal(plain string) (string, error) {
+	if b == nil {
+		return "", ErrSecretKeyMissing
+	}
+	nonce, err := randomBytes(b.aead.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (b *SecretBox) Open(sealed string) (string, error) {
+	if b == nil {
+		return "", ErrSecretKeyMissing
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < b.aead.NonceSize() {
+		return "", errSealedTooShort
+	}
+	nonce, ciphertext := raw[:b.aead.NonceSize()], raw[b.aead.NonceSize():]
+	plain, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	TotpDigits = 6
+	TotpPeriod = 30
+	// TotpSkew is the number of periods the client clock may drift in either direction
+	TotpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTotpSecret returns base32 encoded 160 bit secret as recommended by RFC 4226.
+func GenerateTotpSecret() (string, error) {
+	b, err := randomBytes(20)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TotpCounter returns the RFC 6238 time step of t.
+func TotpCounter(t time.Time) int64 {
+	return t.Unix() / TotpPeriod
+}
+
+// TotpCode computes the RFC 4226 HOTP value of the base32 secret for the counter.
+func TotpCode(secret string, counter int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TotpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TotpDigits, value%mod), nil
+}
+
+// VerifyTotp checks the code against the time steps around t, the matched counter is returned,
+// so the caller could reject a code which has been already used.
+func VerifyTotp(secret, code string, t time.Time) (int64, bool) {
+	now := TotpCounter(t)
+	for counter := now - TotpSkew; counter <= now+TotpSkew; counter++ {
+		expected, err := TotpCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// TotpUri returns otpauth uri which authenticator apps accept, usually rendered as a QR code.
+func TotpUri(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(TotpDigits))
+	q.Set("period", fmt.Sprint(TotpPeriod))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
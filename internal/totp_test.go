@@ -0,0 +1,76 @@
+package internal_test
+
+import (
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TOTP", func() {
+	// RFC 6238 appendix B, sha1 seed "12345678901234567890", last 6 digits of the 8 digit values
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	It("TotpCode", func() {
+		Expect(internal.TotpCode(secret, internal.TotpCounter(time.Unix(59, 0)))).To(Equal("287082"))
+		Expect(internal.TotpCode(secret, internal.TotpCounter(time.Unix(1111111109, 0)))).To(Equal("081804"))
+		Expect(internal.TotpCode(secret, internal.TotpCounter(time.Unix(2000000000, 0)))).To(Equal("279037"))
+	})
+
+	It("VerifyTotp", func() {
+		now := time.Unix(1111111109, 0)
+		counter, ok := internal.VerifyTotp(secret, "081804", now)
+		Expect(ok).To(BeTrue())
+		Expect(counter).To(Equal(internal.TotpCounter(now)))
+
+		_, ok = internal.VerifyTotp(secret, "081804", now.Add(time.Second*internal.TotpPeriod))
+		Expect(ok).To(BeTrue())
+		_, ok = internal.VerifyTotp(secret, "081804", now.Add(time.Second*internal.TotpPeriod*3))
+		Expect(ok).To(BeFalse())
+		_, ok = internal.VerifyTotp(secret, "000000", now)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("TotpUri", func() {
+		uri := internal.TotpUri("go-sso", "user@example.com", secret)
+		Expect(uri).To(HavePrefix("otpauth://totp/go-sso:user@example.com?"))
+		Expect(uri).To(ContainSubstring("secret=" + secret))
+	})
+})
+
+var _ = Describe("Recovery codes", func() {
+	It("GenerateRecoveryCodes", func() {
+		codes, err := internal.GenerateRecoveryCodes(10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(codes).To(HaveLen(10))
+		for _, code := range codes {
+			Expect(code).To(MatchRegexp(`^[a-z2-7]{5}-[a-z2-7]{5}$`))
+		}
+	})
+
+	It("HashRecoveryCode", func() {
+		Expect(internal.HashRecoveryCode("abcde-fghij")).To(Equal(internal.HashRecoveryCode(" ABCDE FGHIJ")))
+		Expect(internal.HashRecoveryCode("abcde-fghij")).NotTo(Equal(internal.HashRecoveryCode("abcde-fghik")))
+	})
+})
+
+var _ = Describe("SecretBox", func() {
+	It("Seal and Open", func() {
+		box, err := internal.NewSecretBox("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+		Expect(err).To(BeNil())
+		sealed, err := box.Seal("secret")
+		Expect(err).To(BeNil())
+		Expect(sealed).NotTo(ContainSubstring("secret"))
+		Expect(box.Open(sealed)).To(Equal("secret"))
+
+		_, err = box.Open(sealed[:len(sealed)-2] + "AA")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("requires the key", func() {
+		var box *internal.SecretBox
+		_, err := box.Seal("secret")
+		Expect(err).To(Equal(internal.ErrSecretKeyMissing))
+	})
+})
@@ -0,0 +1,107 @@
+package web_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Audit log", func() {
+	var (
+		application *models.ApplicationModel
+		email       string
+		token       string
+	)
+
+	query := func(filter url.Values) types.AuditLogResponse {
+		resp := getJson("/v1/admin/audit?"+filter.Encode(), token)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		out := types.AuditLogResponse{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		return out
+	}
+
+	BeforeEach(func() {
+		application = newApplication()
+		email = uuid.NewString() + "@example.com"
+		register(application, email)
+		verify(email)
+		for i := 0; i < 3; i++ {
+			resp := postJson("/v1/auth_token", map[string]string{"email": email, "password": "wrong password", "code": application.Code}, "")
+			Expect(resp.StatusCode).To(Equal(fiber.StatusUnauthorized))
+		}
+		signIn(application, email, password)
+		token = adminToken()
+	})
+
+	AfterEach(resetIpFailures)
+
+	It("filters the records", func() {
+		out := query(url.Values{"subject": {email}, "outcome": {models.AuditOutcomeFailure}})
+		Expect(out.Total).To(BeEquivalentTo(3))
+		for _, item := range out.Items {
+			Expect(item.Action).To(Equal(models.AuditActionLoginFailed))
+			Expect(item.Application).To(Equal(application.Code))
+			Expect(item.Detail).To(Equal(models.ErrInvalidCredentials.Error()))
+		}
+
+		out = query(url.Values{"subject": {email}, "action": {models.AuditActionLogin}})
+		Expect(out.Total).To(BeEquivalentTo(1))
+		Expect(out.Items[0].Outcome).To(Equal(models.AuditOutcomeSuccess))
+		Expect(out.Items[0].ActorId).NotTo(BeZero())
+
+		Expect(query(url.Values{"subject": {email}, "application": {uuid.NewString()}}).Total).To(BeZero())
+		Expect(query(url.Values{"subject": {email}, "to": {"1"}}).Total).To(BeZero())
+	})
+
+	It("pages the records from the latest", func() {
+		filter := url.Values{"subject": {email}, "action": {models.AuditActionLoginFailed}, "per_page": {"2"}}
+		first := query(filter)
+		Expect(first.Total).To(BeEquivalentTo(3))
+		Expect(first.Page).To(Equal(1))
+		Expect(first.Items).To(HaveLen(2))
+		Expect(first.Items[0].Id).To(BeNumerically(">", first.Items[1].Id))
+
+		filter.Set("page", "2")
+		second := query(filter)
+		Expect(second.Items).To(HaveLen(1))
+		Expect(second.Items[0].Id).To(BeNumerically("<", first.Items[1].Id))
+
+		filter.Set("page", "3")
+		Expect(query(filter).Items).To(BeEmpty())
+	})
+
+	It("exports the records", func() {
+		resp := getJson("/v1/admin/audit/export?"+url.Values{"subject": {email}, "action": {models.AuditActionLoginFailed}}.Encode(), token)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		Expect(resp.Header.Get(fiber.HeaderContentType)).To(Equal("application/x-ndjson"))
+
+		var items []types.AuditEntryResponse
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			item := types.AuditEntryResponse{}
+			Expect(json.Unmarshal(scanner.Bytes(), &item)).To(Succeed())
+			items = append(items, item)
+		}
+		Expect(scanner.Err()).NotTo(HaveOccurred())
+		Expect(items).To(HaveLen(3))
+
+		// the export is recorded as well
+		Expect(query(url.Values{"action": {models.AuditActionAuditExport}}).Total).To(BeNumerically(">=", 1))
+	})
+
+	It("is open to the admin only", func() {
+		user := signIn(application, email, password)
+		Expect(getJson("/v1/admin/audit", user.Token).StatusCode).To(Equal(fiber.StatusUnauthorized))
+		Expect(getJson("/v1/admin/audit/export", user.Token).StatusCode).To(Equal(fiber.StatusUnauthorized))
+		Expect(getJson("/v1/admin/audit?outcome=unknown", token).StatusCode).To(Equal(fiber.StatusUnprocessableEntity))
+		Expect(getJson("/v1/admin/audit?per_page=501", token).StatusCode).To(Equal(fiber.StatusUnprocessableEntity))
+	})
+})
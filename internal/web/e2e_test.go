@@ -0,0 +1,301 @@
+package web_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// browser keeps the cookies between the requests like the user agent does
+type browser struct {
+	cookies map[string]*http.Cookie
+}
+
+func newBrowser() *browser {
+	return &browser{cookies: map[string]*http.Cookie{}}
+}
+
+func (b *browser) do(req *http.Request) *http.Response {
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+	resp, err := app.Test(req, -1)
+	Expect(err).NotTo(HaveOccurred())
+	for _, cookie := range resp.Cookies() {
+		// the browser is on the sso domain, the cookies of the application domains stay with the applications
+		if cookie.Domain != "" && cookie.Domain != config.Cookie.Domain {
+			continue
+		}
+		if cookie.Value == "" || (!cookie.Expires.IsZero() && cookie.Expires.Before(time.Now())) {
+			delete(b.cookies, cookie.Name)
+			continue
+		}
+		b.cookies[cookie.Name] = cookie
+	}
+	return resp
+}
+
+func (b *browser) get(target string) *http.Response {
+	return b.do(httptest.NewRequest(fiber.MethodGet, target, nil))
+}
+
+// submit posts the html form with the csrf token of the cookie, the form page has to be loaded first
+func (b *browser) submit(target string, form url.Values) *http.Response {
+	Expect(b.cookies).To(HaveKey(config.Cookie.CsrfName))
+	form.Set("csrf_token", b.cookies[config.Cookie.CsrfName].Value)
+	req := httptest.NewRequest(fiber.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	return b.do(req)
+}
+
+func postJson(target string, body interface{}, token string) *http.Response {
+	data, err := json.Marshal(body)
+	Expect(err).NotTo(HaveOccurred())
+	req := httptest.NewRequest(fiber.MethodPost, target, bytes.NewReader(data))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := app.Test(req, -1)
+	Expect(err).NotTo(HaveOccurred())
+	return resp
+}
+
+func postForm(target string, form url.Values) *http.Response {
+	req := httptest.NewRequest(fiber.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	resp, err := app.Test(req, -1)
+	Expect(err).NotTo(HaveOccurred())
+	return resp
+}
+
+func getJson(target string, token string) *http.Response {
+	req := httptest.NewRequest(fiber.MethodGet, target, nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := app.Test(req, -1)
+	Expect(err).NotTo(HaveOccurred())
+	return resp
+}
+
+func relative(link *url.URL) string {
+	return link.RequestURI()
+}
+
+const password = "Correct horse battery 42"
+
+func newApplication() *models.ApplicationModel {
+	application := &models.ApplicationModel{
+		Application:  "test",
+		Domain:       "app.example.com",
+		RedirectUrl:  "https://app.example.com/",
+		RedirectUris: "https://app.example.com/callback",
+		Code:         uuid.NewString(),
+	}
+	Expect(sso.ApplicationManager().Create(context.Background(), application)).To(Succeed())
+	return application
+}
+
+func register(application *models.ApplicationModel, email string) {
+	resp := postJson("/v1/user/register", map[string]interface{}{
+		"name":             "Test User",
+		"email":            email,
+		"password":         password,
+		"confirm_password": password,
+		"gender":           "f",
+		"agreement":        true,
+		"code":             application.Code,
+	}, "")
+	Expect(resp.StatusCode).To(Equal(fiber.StatusCreated))
+}
+
+func verify(email string) {
+	Eventually(mails.link(email)).ShouldNot(BeNil())
+	resp := newBrowser().get(relative(mails.link(email)()))
+	Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+	Expect(resp.Header.Get(fiber.HeaderLocation)).To(Equal("/verified"))
+}
+
+// login submits the login form of the application
+func login(b *browser, application *models.ApplicationModel, email, password string) *http.Response {
+	Expect(b.get("/login?code=" + application.Code).StatusCode).To(Equal(fiber.StatusOK))
+	return b.submit("/login", url.Values{
+		"email":    {email},
+		"password": {password},
+		"code":     {application.Code},
+	})
+}
+
+// signIn gets the tokens of the user from the api
+func signIn(application *models.ApplicationModel, email, password string) types.UserTokenResponse {
+	resp := postJson("/v1/auth_token", map[string]string{"email": email, "password": password, "code": application.Code}, "")
+	Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+	out := types.UserTokenResponse{}
+	Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+	return out
+}
+
+// applicationCookie returns the access token cookie the response sets for the application
+func applicationCookie(resp *http.Response, application *models.ApplicationModel) *http.Cookie {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Domain == application.Domain && strings.HasPrefix(cookie.Name, sso.CookieName()) {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// resetIpFailures forgets the failed sign in attempts, every request of the app test comes from the same address
+func resetIpFailures() {
+	Expect(sso.LoginFailureManager().Reset(context.Background(), models.LoginFailureScopeIp, "0.0.0.0")).To(Succeed())
+}
+
+// adminToken returns the token of a new admin whose session was confirmed by the second factor
+func adminToken() string {
+	ctx := context.Background()
+	admin := &models.UserModel{Name: "Admin", Email: uuid.NewString() + "@example.com", Role: "admin", Active: true}
+	Expect(sso.UserManager().Create(ctx, admin)).To(Succeed())
+	session := &models.SessionModel{Sid: uuid.NewString(), UserId: admin.Id, Mfa: true, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	Expect(sso.SessionManager().Create(ctx, session)).To(Succeed())
+	application := newApplication()
+	Expect(sso.SessionClientManager().Add(ctx, &models.SessionClientModel{Sid: session.Sid, ClientId: application.Code})).To(Succeed())
+	token, err := sso.BuildJWTToken(admin.Id, []string{admin.Role}, session.Sid, application.Code, "", time.Unix(session.ExpiresAt, 0))
+	Expect(err).NotTo(HaveOccurred())
+	return token
+}
+
+var _ = Describe("End to end", func() {
+	var (
+		application *models.ApplicationModel
+		email       string
+	)
+
+	BeforeEach(func() {
+		application = newApplication()
+		email = uuid.NewString() + "@example.com"
+	})
+
+	It("registers and verifies the user", func() {
+		register(application, email)
+
+		// the unverified user is refused like the wrong password
+		resp := postJson("/v1/auth_token", map[string]string{"email": email, "password": password, "code": application.Code}, "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusUnauthorized))
+
+		verify(email)
+		user, err := sso.UserManager().ByEmail(context.Background(), email)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(user.Active).To(BeTrue())
+		Expect(user.Code).To(BeEmpty())
+	})
+
+	It("rejects the second registration of the email", func() {
+		register(application, email)
+		resp := postJson("/v1/user/register", map[string]interface{}{
+			"name":             "Other User",
+			"email":            email,
+			"password":         password,
+			"confirm_password": password,
+			"gender":           "m",
+			"agreement":        true,
+		}, "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusUnprocessableEntity))
+	})
+
+	It("signs in with the api and reads the user", func() {
+		register(application, email)
+		verify(email)
+
+		resp := postJson("/v1/auth_token", map[string]string{"email": email, "password": "wrong password", "code": application.Code}, "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusUnauthorized))
+
+		resp = postJson("/v1/auth_token", map[string]string{"email": email, "password": password, "code": application.Code}, "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		out := types.UserTokenResponse{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		Expect(out.Token).NotTo(BeEmpty())
+		Expect(out.RefreshToken).NotTo(BeEmpty())
+
+		resp = postJson("/v1/user/me", nil, out.Token)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		body, _ := ioutil.ReadAll(resp.Body)
+		Expect(string(body)).To(ContainSubstring(email))
+	})
+
+	It("signs in and out with the cookie", func() {
+		register(application, email)
+		verify(email)
+		b := newBrowser()
+
+		resp := login(b, application, email, "wrong password")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		Expect(b.cookies).NotTo(HaveKey(sso.CookieName()))
+
+		resp = login(b, application, email, password)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+		Expect(resp.Header.Get(fiber.HeaderLocation)).To(Equal(application.RedirectUrl))
+		Expect(b.cookies).To(HaveKey(sso.CookieName()))
+		Expect(postJson("/v1/user/me", nil, b.cookies[sso.CookieName()].Value).StatusCode).To(Equal(fiber.StatusUnauthorized))
+		Expect(applicationCookie(resp, application)).NotTo(BeNil())
+		token := applicationCookie(resp, application).Value
+		Expect(postJson("/v1/user/me", nil, token).StatusCode).To(Equal(fiber.StatusOK))
+
+		// the signed in user is sent straight back to the application
+		resp = b.get("/login?code=" + application.Code)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+
+		resp = b.get("/logout?code=" + application.Code)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+		Expect(resp.Header.Get(fiber.HeaderLocation)).To(Equal("/login?code=" + url.QueryEscape(application.Code)))
+		Expect(b.cookies).NotTo(HaveKey(sso.CookieName()))
+
+		// the token is still unexpired, but its session is gone
+		Expect(postJson("/v1/user/me", nil, token).StatusCode).To(Equal(fiber.StatusUnauthorized))
+	})
+
+	It("recovers the password", func() {
+		register(application, email)
+		verify(email)
+		b := newBrowser()
+
+		Expect(b.get("/password/recover?code=" + application.Code).StatusCode).To(Equal(fiber.StatusOK))
+		resp := b.submit("/password/recover", url.Values{"email": {email}, "code": {application.Code}})
+		Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+		Expect(resp.Header.Get(fiber.HeaderLocation)).To(Equal("/password/recover/send"))
+
+		// the verification link of the registration is replaced by the recovery one
+		Eventually(func() string {
+			link := mails.link(email)()
+			return link.Path
+		}).Should(Equal("/password/change"))
+
+		resp = b.get(relative(mails.link(email)()))
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		user, err := sso.UserManager().ByEmail(context.Background(), email)
+		Expect(err).NotTo(HaveOccurred())
+
+		const changed = "Another horse battery 17"
+		resp = b.submit("/password/change", url.Values{
+			"password":         {changed},
+			"confirm_password": {changed},
+			"code":             {user.Code},
+		})
+		Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+		Expect(resp.Header.Get(fiber.HeaderLocation)).To(Equal("/login"))
+
+		Expect(login(newBrowser(), application, email, password).StatusCode).To(Equal(fiber.StatusOK))
+		Expect(login(newBrowser(), application, email, changed).StatusCode).To(Equal(fiber.StatusFound))
+	})
+})
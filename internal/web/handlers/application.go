@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"strings"
 	"time"
 
 	"github.com/MiG-21/go-sso/internal"
@@ -39,21 +40,38 @@ func CreateApplicationHandler(s models.SSOer, validator *internal.ServiceValidat
 			return HttpError(ctx, fiber.StatusInternalServerError, errors)
 		}
 		application := &models.ApplicationModel{
-			Application: params.Application,
-			Domain:      params.Domain,
-			RedirectUrl: params.RedirectUrl,
-			Created:     time.Now().Unix(),
-			Code:        rand.String(),
+			Application:            params.Application,
+			Domain:                 params.Domain,
+			RedirectUrl:            params.RedirectUrl,
+			RedirectUris:           strings.Join(params.RedirectUris, " "),
+			PostLogoutRedirectUris: strings.Join(params.PostLogoutRedirectUris, " "),
+			PublicUrl:              strings.TrimRight(params.PublicUrl, "/"),
+			FrontchannelLogoutUrl:  params.FrontchannelLogoutUrl,
+			BackchannelLogoutUrl:   params.BackchannelLogoutUrl,
+			Created:                time.Now().Unix(),
+			Code:                   rand.String(),
 		}
-		if err = s.ApplicationManager().Create(application); err != nil {
+		if err = s.ApplicationManager().Create(ctx.UserContext(), application); err != nil {
 			return HttpError(ctx, fiber.StatusInternalServerError, err)
 		}
 
+		audit(ctx, s, &models.AuditModel{
+			Action:      models.AuditActionApplicationCreate,
+			Outcome:     models.AuditOutcomeSuccess,
+			Application: application.Code,
+			Detail:      application.Application,
+		})
+
 		out := types.ApplicationCreateResponse{
-			Application: application.Application,
-			Domain:      application.Domain,
-			RedirectUrl: application.RedirectUrl,
-			Code:        application.Code,
+			Application:            application.Application,
+			Domain:                 application.Domain,
+			RedirectUrl:            application.RedirectUrl,
+			RedirectUris:           strings.Fields(application.RedirectUris),
+			PostLogoutRedirectUris: application.PostLogoutRedirectUriList(),
+			PublicUrl:              application.PublicUrl,
+			FrontchannelLogoutUrl:  application.FrontchannelLogoutUrl,
+			BackchannelLogoutUrl:   application.BackchannelLogoutUrl,
+			Code:                   application.Code,
 		}
 		return ctx.Status(fiber.StatusCreated).JSON(out)
 	}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	auditDefaultPerPage = 50
+	auditExportBatch    = 500
+)
+
+// AdminAuditHandler godoc
+// @Summary audit log
+// @Description security relevant actions, newest first, the filters are combined
+// @Id admin-audit
+// @Tags admin
+// @Param Authorization header string true "bearer token"
+// @Param params query types.AuditQueryRequest false "filters"
+// @Produce json
+// @Success 200 {object} types.AuditLogResponse
+// @Failure 422 {object} fiber.Error
+// @Failure 500 {object} fiber.Error
+// @Router /admin/audit [get]
+func AdminAuditHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.AuditQueryRequest{}
+		if err := ctx.QueryParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		filter := auditFilter(params)
+		page, perPage := params.Page, params.PerPage
+		if page == 0 {
+			page = 1
+		}
+		if perPage == 0 {
+			perPage = auditDefaultPerPage
+		}
+		filter.Offset = (page - 1) * perPage
+		filter.Limit = perPage
+
+		total, err := s.AuditManager().Count(ctx.UserContext(), filter)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		items, err := s.AuditManager().Find(ctx.UserContext(), filter)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		out := types.AuditLogResponse{
+			Items:   make([]types.AuditEntryResponse, 0, len(items)),
+			Total:   total,
+			Page:    page,
+			PerPage: perPage,
+		}
+		for _, item := range items {
+			out.Items = append(out.Items, auditEntryResponse(item))
+		}
+		return ctx.Status(fiber.StatusOK).JSON(out)
+	}
+}
+
+// AdminAuditExportHandler godoc
+// @Summary export audit log
+// @Description every matching record as a JSON object per line, newest first, paging params are ignored
+// @Id admin-audit-export
+// @Tags admin
+// @Param Authorization header string true "bearer token"
+// @Param params query types.AuditQueryRequest false "filters"
+// @Produce application/x-ndjson
+// @Success 200 {object} types.AuditEntryResponse
+// @Failure 422 {object} fiber.Error
+// @Router /admin/audit/export [get]
+func AdminAuditExportHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.AuditQueryRequest{}
+		if err := ctx.QueryParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		filter := auditFilter(params)
+		filter.Limit = auditExportBatch
+
+		audit(ctx, s, &models.AuditModel{
+			Action:  models.AuditActionAuditExport,
+			Outcome: models.AuditOutcomeSuccess,
+			Detail:  string(ctx.Request().URI().QueryString()),
+		})
+
+		// the body is written after the handler returns, the request ctx must not be used in the writer, its user
+		// context is cancelled by the request timeout by then
+		logger := GetCtxLogger(ctx)
+		storage := context.Background()
+		ctx.Set(fiber.HeaderContentType, "application/x-ndjson")
+		ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="audit.jsonl"`)
+		ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			encoder := json.NewEncoder(w)
+			for {
+				items, err := s.AuditManager().Find(storage, filter)
+				if err != nil {
+					if logger != nil {
+						logger.Error().Err(err).Msg("audit export failed")
+					}
+					return
+				}
+				for _, item := range items {
+					if err = encoder.Encode(auditEntryResponse(item)); err != nil {
+						return
+					}
+				}
+				if err = w.Flush(); err != nil || len(items) < filter.Limit {
+					return
+				}
+				filter.BeforeId = items[len(items)-1].Id
+			}
+		})
+		return nil
+	}
+}
+
+// audit records the action along with the client ip, user agent, request id and the authenticated user as the actor
+// unless set. A failed write is logged, it never fails the request.
+func audit(ctx *fiber.Ctx, s models.SSOer, item *models.AuditModel) {
+	if item.ActorId == 0 {
+		if claims := CtxClaims(ctx); claims != nil {
+			item.ActorId = claims.Id
+		}
+	}
+	item.Ip = clientIp(ctx)
+	item.UserAgent = truncate(ctx.Get(fiber.HeaderUserAgent), 255)
+	item.RequestId, _ = ctx.Locals("requestid").(string)
+	item.Subject = truncate(item.Subject, 255)
+	item.Detail = truncate(item.Detail, 1024)
+	if err := s.AuditManager().Add(ctx.UserContext(), item); err != nil {
+		if logger := GetCtxLogger(ctx); logger != nil {
+			logger.Error().Err(err).Str("action", item.Action).Msg("audit record failed")
+		}
+	}
+}
+
+// auditFailure records the failed action, err is the reason.
+func auditFailure(ctx *fiber.Ctx, s models.SSOer, item *models.AuditModel, err error) {
+	item.Outcome = models.AuditOutcomeFailure
+	if err != nil {
+		item.Detail = err.Error()
+	}
+	audit(ctx, s, item)
+}
+
+func auditFilter(params *types.AuditQueryRequest) *models.AuditFilter {
+	return &models.AuditFilter{
+		Action:      params.Action,
+		Outcome:     params.Outcome,
+		ActorId:     params.ActorId,
+		TargetId:    params.TargetId,
+		Subject:     params.Subject,
+		Application: params.Application,
+		Ip:          params.Ip,
+		From:        params.From,
+		To:          params.To,
+	}
+}
+
+func auditEntryResponse(item *models.AuditModel) types.AuditEntryResponse {
+	return types.AuditEntryResponse{
+		Id:          item.Id,
+		Action:      item.Action,
+		Outcome:     item.Outcome,
+		ActorId:     item.ActorId,
+		TargetId:    item.TargetId,
+		Subject:     item.Subject,
+		Application: item.Application,
+		Ip:          item.Ip,
+		UserAgent:   item.UserAgent,
+		RequestId:   item.RequestId,
+		Detail:      item.Detail,
+		Created:     item.Created,
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/web/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	csrfFormField = "csrf_token"
+	csrfHeader    = "X-Csrf-Token"
+	errCsrf       = "invalid csrf token, reload the page and try again"
+)
+
+// Csrf protects the html forms with double-submit tokens: the token is kept in a __Host- prefixed cookie, which
+// no other host can set, and has to be sent back in the csrf_token field or the X-Csrf-Token header by every unsafe
+// request. The token of the request is stored in the ctx locals for the form views.
+func Csrf(config *internal.Config) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		token := ctx.Cookies(config.Cookie.CsrfName)
+
+		switch ctx.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+		default:
+			sent := ctx.FormValue(csrfFormField)
+			if sent == "" {
+				sent = ctx.Get(csrfHeader)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(sent)) != 1 {
+				if strings.Contains(ctx.Get(fiber.HeaderAccept), fiber.MIMETextHTML) {
+					data := views.ErrorViewData(fiber.StatusForbidden, errCsrf)
+					return ctx.Status(fiber.StatusForbidden).Render("error", data, "layout")
+				}
+				return fiber.NewError(fiber.StatusForbidden, errCsrf)
+			}
+		}
+
+		if token == "" {
+			var err error
+			if token, err = internal.RandomString(32); err != nil {
+				return HttpError(ctx, fiber.StatusInternalServerError, err)
+			}
+			ctx.Cookie(&fiber.Cookie{
+				Name:     config.Cookie.CsrfName,
+				Value:    token,
+				Path:     "/",
+				Secure:   true,
+				HTTPOnly: true,
+				SameSite: fiber.CookieSameSiteLaxMode,
+			})
+		}
+		ctx.Locals(views.CsrfLocalsKey, token)
+		return ctx.Next()
+	}
+}
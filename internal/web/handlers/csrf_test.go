@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/web/handlers"
+	"github.com/MiG-21/go-sso/internal/web/views"
+	"github.com/gofiber/fiber/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Csrf", func() {
+	config := &internal.Config{Cookie: internal.ConfigCookie{CsrfName: "__Host-SSO_CSRF"}}
+	csrfApp := fiber.New(fiber.Config{DisableStartupMessage: true})
+	csrfApp.Use(handlers.Csrf(config))
+	csrfApp.Get("/form", func(ctx *fiber.Ctx) error {
+		return ctx.SendString(views.CsrfToken(ctx))
+	})
+	csrfApp.Post("/form", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusNoContent)
+	})
+
+	issue := func() (*http.Cookie, string) {
+		resp, err := csrfApp.Test(httptest.NewRequest("GET", "/form", nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Cookies()).To(HaveLen(1))
+		body, _ := ioutil.ReadAll(resp.Body)
+		Expect(string(body)).To(Equal(resp.Cookies()[0].Value))
+		return resp.Cookies()[0], string(body)
+	}
+
+	submit := func(cookie *http.Cookie, token string) int {
+		form := url.Values{"csrf_token": {token}}
+		req := httptest.NewRequest("POST", "/form", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", fiber.MIMEApplicationForm)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp, err := csrfApp.Test(req)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode
+	}
+
+	It("issues the token on the form page", func() {
+		cookie, token := issue()
+		Expect(token).NotTo(BeEmpty())
+		Expect(cookie.Name).To(Equal("__Host-SSO_CSRF"))
+		Expect(cookie.HttpOnly).To(BeTrue())
+		Expect(cookie.SameSite).To(Equal(http.SameSiteLaxMode))
+		// the browser keeps the __Host- cookie only when it is secure, for the path / and without the domain
+		Expect(cookie.Secure).To(BeTrue())
+		Expect(cookie.Path).To(Equal("/"))
+		Expect(cookie.Domain).To(BeEmpty())
+	})
+
+	It("accepts the form with the token of the cookie", func() {
+		cookie, token := issue()
+		Expect(submit(cookie, token)).To(Equal(fiber.StatusNoContent))
+	})
+
+	It("accepts the token in the header", func() {
+		cookie, token := issue()
+		req := httptest.NewRequest("POST", "/form", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+		req.Header.Set("X-Csrf-Token", token)
+		req.AddCookie(cookie)
+		resp, err := csrfApp.Test(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(fiber.StatusNoContent))
+	})
+
+	It("rejects missing and forged tokens", func() {
+		cookie, token := issue()
+		Expect(submit(cookie, "")).To(Equal(fiber.StatusForbidden))
+		Expect(submit(cookie, token+"x")).To(Equal(fiber.StatusForbidden))
+		Expect(submit(nil, token)).To(Equal(fiber.StatusForbidden))
+		// the cookie without the prefix could come from a sibling subdomain
+		Expect(submit(&http.Cookie{Name: "SSO_CSRF", Value: token}, token)).To(Equal(fiber.StatusForbidden))
+	})
+})
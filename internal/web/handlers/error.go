@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/views"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 )
@@ -25,12 +28,37 @@ func HttpError(ctx *fiber.Ctx, status int, data interface{}) error {
 	}
 	switch data.(type) {
 	case error:
+		if code := storageStatus(data.(error)); code != 0 {
+			status = code
+		}
 		return fiber.NewError(status, data.(error).Error())
 	default:
 		return ctx.Status(status).JSON(data)
 	}
 }
 
+// errorPage renders the error page for err, storage timeouts and outages are answered with their own status.
+func errorPage(ctx *fiber.Ctx, status int, err error) error {
+	if code := storageStatus(err); code != 0 {
+		data := views.ErrorViewData(code, err.Error())
+		return ctx.Status(code).Render("error", data, "layout")
+	}
+	data := views.ErrorViewData(status, err.Error())
+	return ctx.Render("error", data, "layout")
+}
+
+// storageStatus returns the status of the storage error, zero for any other error.
+func storageStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrTimeout):
+		return fiber.StatusGatewayTimeout
+	case errors.Is(err, models.ErrUnavailable):
+		return fiber.StatusServiceUnavailable
+	default:
+		return 0
+	}
+}
+
 func HandleValidation(errs error) []*ValidationError {
 	var errors []*ValidationError
 	if errs != nil {
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/event"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errTooManyAttempts = errors.New("too many failed attempts, try again later")
+)
+
+// AdminUserUnlockHandler godoc
+// @Summary unlock user
+// @Description removes the lock of the user along with the failed sign in counter
+// @Id admin-user-unlock
+// @Tags admin
+// @Param Authorization header string true "bearer token"
+// @Param id path int true "user id"
+// @Success 204
+// @Failure 400 {object} fiber.Error
+// @Failure 404 {object} fiber.Error
+// @Failure 500 {object} fiber.Error
+// @Router /admin/user/{id}/unlock [post]
+func AdminUserUnlockHandler(s models.SSOer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+		user, err := s.UserManager().ById(ctx.UserContext(), int64(id))
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+
+		user.Locked = false
+		user.LockedTo = 0
+		if _, err = s.UserManager().Update(ctx.UserContext(), user); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if err = loginSucceeded(ctx.UserContext(), s, user); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionUserUnlock,
+			Outcome:  models.AuditOutcomeSuccess,
+			TargetId: user.Id,
+			Subject:  user.Email,
+		})
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// authenticate checks the password of the user signing in to the application, failed attempts are counted per
+// account and per client ip. The account counter of users with the second factor is reset only once the second
+// factor is verified. The locked or unverified account is answered like the wrong password, so callers can not
+// tell the state of the account, the reason is kept in the audit log.
+func authenticate(ctx *fiber.Ctx, s models.SSOer, eventService *event.Service, clientId, email, password string) (*models.UserModel, error) {
+	failure := &models.AuditModel{Action: models.AuditActionLoginFailed, Subject: email, Application: clientId}
+	blocked, err := ipBlocked(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		auditFailure(ctx, s, failure, errTooManyAttempts)
+		return nil, errTooManyAttempts
+	}
+
+	user, err := s.UserManager().Authenticate(ctx.UserContext(), email, password)
+	if err == models.ErrInvalidCredentials || err == models.ErrUserLocked {
+		owner, lookupErr := s.UserManager().ByEmail(ctx.UserContext(), email)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		if owner != nil {
+			failure.TargetId = owner.Id
+		}
+		auditFailure(ctx, s, failure, err)
+		if lookupErr = loginFailed(ctx, s, eventService, owner); lookupErr != nil {
+			return nil, lookupErr
+		}
+		return nil, models.ErrInvalidCredentials
+	}
+	if err != nil {
+		auditFailure(ctx, s, failure, err)
+		return nil, err
+	}
+	if !user.MfaEnabled {
+		if err = loginSucceeded(ctx.UserContext(), s, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// ipBlocked reports whether the client ip made too many failed attempts.
+func ipBlocked(ctx *fiber.Ctx, s models.SSOer) (bool, error) {
+	item, err := s.LoginFailureManager().ByKey(ctx.UserContext(), models.LoginFailureScopeIp, clientIp(ctx))
+	if err != nil {
+		return false, err
+	}
+	return item != nil && item.BlockedTo > time.Now().Unix(), nil
+}
+
+// loginFailed counts the failed attempt of the client ip and of the user, if known. Reaching the limit blocks
+// the ip or locks the account for twice as long as its previous lockout, the user is notified by email. Every
+// counter is updated in its own transaction, the counting statement holds the row until the block or the lock is
+// saved, so concurrent failures are neither lost nor counted twice.
+func loginFailed(ctx *fiber.Ctx, s models.SSOer, eventService *event.Service, user *models.UserModel) error {
+	policy := s.LockoutPolicy()
+	now := time.Now().Unix()
+	since := now - policy.WindowMinutes*60
+
+	err := s.Transaction(ctx.UserContext(), func(tx context.Context) error {
+		ip, err := s.LoginFailureManager().Count(tx, models.LoginFailureScopeIp, clientIp(ctx), since)
+		if err != nil || ip.Failures < policy.IpMaxAttempts {
+			return err
+		}
+		ip.Failures = 0
+		ip.BlockedTo = now + policy.LockMinutes*60
+		return s.LoginFailureManager().Save(tx, ip)
+	})
+	if err != nil {
+		return err
+	}
+
+	// attempts against the locked account do not extend the lock
+	if user == nil || !user.Active || user.Locked || user.LockedTo > now {
+		return nil
+	}
+	locked := false
+	err = s.Transaction(ctx.UserContext(), func(tx context.Context) error {
+		account, err := s.LoginFailureManager().Count(tx, models.LoginFailureScopeUser, strconv.FormatInt(user.Id, 10), since)
+		if err != nil || account.Failures < policy.MaxAttempts {
+			return err
+		}
+		lockMinutes := policy.LockMinutes << account.Lockouts
+		if lockMinutes > policy.MaxLockMinutes || lockMinutes <= 0 {
+			lockMinutes = policy.MaxLockMinutes
+		}
+		account.Failures = 0
+		account.Lockouts++
+		user.LockedTo = now + lockMinutes*60
+		if _, err = s.UserManager().Update(tx, user); err != nil {
+			return err
+		}
+		locked = true
+		return s.LoginFailureManager().Save(tx, account)
+	})
+	if err != nil || !locked {
+		return err
+	}
+
+	audit(ctx, s, &models.AuditModel{
+		Action:   models.AuditActionUserLocked,
+		Outcome:  models.AuditOutcomeSuccess,
+		TargetId: user.Id,
+		Subject:  user.Email,
+		Detail:   "locked to " + time.Unix(user.LockedTo, 0).UTC().Format(time.RFC3339),
+	})
+
+	// emit event
+	eventService.Emit(&event.UserLocked{
+		UserName:  user.Name,
+		UserEmail: user.Email,
+		Ip:        clientIp(ctx),
+		LockedTo:  user.LockedTo,
+	})
+	return nil
+}
+
+// loginSucceeded resets the failed attempts of the user.
+func loginSucceeded(ctx context.Context, s models.SSOer, user *models.UserModel) error {
+	return s.LoginFailureManager().Reset(ctx, models.LoginFailureScopeUser, strconv.FormatInt(user.Id, 10))
+}
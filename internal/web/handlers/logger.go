@@ -47,7 +47,7 @@ func Logger(logger *zerolog.Logger) fiber.Handler {
 			Dur("time", time.Since(startTime)).
 			Bytes("method", ctx.Context().Method()).
 			Bytes("path", path).
-			Str("addr", ctx.Context().RemoteAddr().String()).
+			Str("addr", clientIp(ctx)).
 			Send()
 
 		return nil
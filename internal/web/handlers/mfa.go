@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/event"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/MiG-21/go-sso/internal/web/views"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errMfaInvalid = errors.New("authentication code is invalid or expired")
+)
+
+// TotpEnrollHandler godoc
+// @Summary enroll totp
+// @Description generates authenticator app secret, two-factor authentication is enabled once the secret is confirmed
+// @Id totp-enroll
+// @Tags mfa
+// @Param Authorization header string true "bearer token"
+// @Produce json
+// @Success 200 {object} types.TotpEnrollResponse
+// @Failure 404 {object} fiber.Error
+// @Failure 409 {object} fiber.Error
+// @Failure 500 {object} fiber.Error
+// @Router /user/mfa/totp/enroll [post]
+func TotpEnrollHandler(s models.SSOer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		user, err := s.UserManager().ById(ctx.UserContext(), CtxClaims(ctx).Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+		totp, err := s.TotpManager().ByUser(ctx.UserContext(), user.Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if totp != nil && totp.Confirmed {
+			return fiber.NewError(fiber.StatusConflict, "authenticator app is already enabled")
+		}
+
+		secret, err := internal.GenerateTotpSecret()
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		sealed, err := s.SealSecret(secret)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if err = s.TotpManager().Save(ctx.UserContext(), &models.TotpModel{UserId: user.Id, Secret: sealed}); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionTotpEnroll,
+			Outcome:  models.AuditOutcomeSuccess,
+			TargetId: user.Id,
+			Subject:  user.Email,
+		})
+
+		ctx.Set("Cache-Control", "no-store")
+		out := types.TotpEnrollResponse{
+			Secret:     secret,
+			OtpauthUri: internal.TotpUri(s.MfaIssuer(), user.Email, secret),
+		}
+		return ctx.Status(fiber.StatusOK).JSON(out)
+	}
+}
+
+// TotpConfirmHandler godoc
+// @Summary confirm totp
+// @Description confirms enrolled authenticator app with its current code and enables two-factor authentication,
+// @Description recovery codes are returned when two-factor authentication was not enabled before
+// @Id totp-confirm
+// @Tags mfa
+// @Param Authorization header string true "bearer token"
+// @Param params body types.OtpRequest true "request body"
+// @Accept json
+// @Produce json
+// @Success 200 {object} types.RecoveryCodesResponse
+// @Success 204
+// @Failure 400 {object} fiber.Error
+// @Failure 404 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /user/mfa/totp/confirm [post]
+func TotpConfirmHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.OtpRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		user, err := s.UserManager().ById(ctx.UserContext(), CtxClaims(ctx).Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+		totp, err := s.TotpManager().ByUser(ctx.UserContext(), user.Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if totp == nil || totp.Confirmed {
+			return fiber.NewError(fiber.StatusNotFound, "no pending authenticator enrollment")
+		}
+
+		if err = verifyTotp(ctx.UserContext(), s, totp, params.Otp); err == errMfaInvalid {
+			auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionTotpConfirm, TargetId: user.Id, Subject: user.Email}, err)
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		} else if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if err = s.TotpManager().Confirm(ctx.UserContext(), totp); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		codes, err := syncMfaEnabled(ctx.UserContext(), s, user)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionTotpConfirm,
+			Outcome:  models.AuditOutcomeSuccess,
+			TargetId: user.Id,
+			Subject:  user.Email,
+		})
+		if codes == nil {
+			return ctx.SendStatus(fiber.StatusNoContent)
+		}
+		ctx.Set("Cache-Control", "no-store")
+		return ctx.Status(fiber.StatusOK).JSON(types.RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// TotpDisableHandler godoc
+// @Summary disable totp
+// @Description removes authenticator app, two-factor authentication stays enabled while passkeys are registered
+// @Id totp-disable
+// @Tags mfa
+// @Param Authorization header string true "bearer token"
+// @Param params body types.OtpRequest true "request body"
+// @Accept json
+// @Produce json
+// @Success 204
+// @Failure 400 {object} fiber.Error
+// @Failure 404 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /user/mfa/totp/disable [post]
+func TotpDisableHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.OtpRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		user, err := s.UserManager().ById(ctx.UserContext(), CtxClaims(ctx).Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+		totp, err := s.TotpManager().ByUser(ctx.UserContext(), user.Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if totp == nil || !totp.Confirmed {
+			return fiber.NewError(fiber.StatusNotFound, "two-factor authentication is not enabled")
+		}
+
+		if err = verifyTotp(ctx.UserContext(), s, totp, params.Otp); err == errMfaInvalid {
+			auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionTotpDisable, TargetId: user.Id, Subject: user.Email}, err)
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		} else if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if err = s.TotpManager().DeleteByUser(ctx.UserContext(), user.Id); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if _, err = syncMfaEnabled(ctx.UserContext(), s, user); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionTotpDisable,
+			Outcome:  models.AuditOutcomeSuccess,
+			TargetId: user.Id,
+			Subject:  user.Email,
+		})
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// RecoveryCodesHandler godoc
+// @Summary regenerate recovery codes
+// @Description replaces the recovery codes of the current user, the session has to be signed in with the second factor
+// @Id recovery-codes
+// @Tags mfa
+// @Param Authorization header string true "bearer token"
+// @Produce json
+// @Success 200 {object} types.RecoveryCodesResponse
+// @Failure 400 {object} fiber.Error
+// @Failure 403 {object} fiber.Error
+// @Failure 404 {object} fiber.Error
+// @Router /user/mfa/recovery_codes [post]
+func RecoveryCodesHandler(s models.SSOer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		claims := CtxClaims(ctx)
+		user, err := s.UserManager().ById(ctx.UserContext(), claims.Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+		if !user.MfaEnabled {
+			return fiber.NewError(fiber.StatusBadRequest, "two-factor authentication is not enabled")
+		}
+		session, err := checkSession(ctx.UserContext(), s, claims.SessionId)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if !session.Mfa {
+			return fiber.NewError(fiber.StatusForbidden, "sign in with the second factor to regenerate recovery codes")
+		}
+
+		codes, err := issueRecoveryCodes(ctx.UserContext(), s, user)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionRecoveryCodes,
+			Outcome:  models.AuditOutcomeSuccess,
+			TargetId: user.Id,
+			Subject:  user.Email,
+		})
+		ctx.Set("Cache-Control", "no-store")
+		return ctx.Status(fiber.StatusOK).JSON(types.RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// AuthTokenMfaHandler godoc
+// @Summary auth token second factor
+// @Description exchanges mfa token returned by auth token and the authenticator app code or a recovery code for the tokens
+// @Id auth-token-mfa
+// @Tags sso
+// @Param params body types.MfaLoginRequest true "request body"
+// @Accept json
+// @Produce json
+// @Success 200 {object} types.UserTokenResponse
+// @Failure 400 {object} fiber.Error
+// @Failure 401 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /auth_token/mfa [post]
+func AuthTokenMfaHandler(config *internal.Config, s models.SSOer, validator *internal.ServiceValidator, eventService *event.Service) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		ctx.Set("Content-Type", "application/json")
+		params := &types.MfaLoginRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), params.Code)
+		if err != nil || app == nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		user, err := verifyMfa(ctx, config, s, eventService, params.MfaToken, params.Otp, params.RecoveryCode)
+		if err == errMfaInvalid {
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		} else if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		return userTokenResponse(ctx, s, user, app, true)
+	}
+}
+
+// AuthCookieMfaHandler completes the login form sign in with the authenticator app code or a recovery code.
+func AuthCookieMfaHandler(config *internal.Config, s models.SSOer, validator *internal.ServiceValidator, eventService *event.Service) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.MfaLoginRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			data := views.LoginMfaFormViewData(ctx, params.Code, params.RedirectRequest, params.MfaToken, ValidationErrorsToErrors(validationErrors)...)
+			return ctx.Render("mfa_form", data, "layout")
+		}
+
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), params.Code)
+		if err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+		if app == nil {
+			data := views.ErrorViewData(fiber.StatusBadRequest, "unknown application")
+			return ctx.Render("error", data, "layout")
+		}
+
+		user, err := verifyMfa(ctx, config, s, eventService, params.MfaToken, params.Otp, params.RecoveryCode)
+		if err == errMfaInvalid {
+			data := views.LoginMfaFormViewData(ctx, params.Code, params.RedirectRequest, params.MfaToken, err)
+			return ctx.Render("mfa_form", data, "layout")
+		} else if err != nil {
+			return errorPage(ctx, fiber.StatusInternalServerError, err)
+		}
+		if passwordExpired(s, user) {
+			return expiredPasswordRedirect(ctx, config, s, user)
+		}
+		return cookieLogin(ctx, s, user, app, params.RedirectRequest, true)
+	}
+}
+
+// AuthorizeMfaHandler completes the oauth authorization sign in with the authenticator app code or a recovery code.
+func AuthorizeMfaHandler(config *internal.Config, s models.SSOer, validator *internal.ServiceValidator, eventService *event.Service) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.AuthorizeMfaRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+
+		if _, err := authorizeClient(ctx.UserContext(), s, &params.AuthorizeRequest); err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(&params.AuthorizeRequest))
+		if validationErrors != nil {
+			return authorizeErrorRedirect(ctx, &params.AuthorizeRequest, authorizeErrorCode(validationErrors), validationErrors[0].Error())
+		}
+
+		validationErrors = HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			data := views.AuthorizeMfaFormViewData(ctx, &params.AuthorizeRequest, params.MfaToken, ValidationErrorsToErrors(validationErrors)...)
+			return ctx.Render("mfa_form", data, "layout")
+		}
+
+		user, err := verifyMfa(ctx, config, s, eventService, params.MfaToken, params.Otp, params.RecoveryCode)
+		if err == errMfaInvalid {
+			data := views.AuthorizeMfaFormViewData(ctx, &params.AuthorizeRequest, params.MfaToken, err)
+			return ctx.Render("mfa_form", data, "layout")
+		} else if err != nil {
+			return authorizeErrorRedirect(ctx, &params.AuthorizeRequest, OAuthErrServerError, "")
+		}
+		if passwordExpired(s, user) {
+			return expiredPasswordRedirect(ctx, config, s, user)
+		}
+		return authorizeLogin(ctx, s, &params.AuthorizeRequest, user, true)
+	}
+}
+
+// mfaChallenge signs the token proving the password was checked, it returns the token and its lifetime in seconds.
+func mfaChallenge(s models.SSOer, user *models.UserModel) (string, int64, error) {
+	validFor := time.Minute * time.Duration(s.MfaChallengeValidMinutes())
+	token, err := s.BuildMfaToken(user.Id, time.Now().Add(validFor).UTC())
+	if err != nil {
+		return "", 0, err
+	}
+	return token, int64(validFor.Seconds()), nil
+}
+
+// verifyMfa checks the mfa token and the authenticator app code or the recovery code, the user is returned
+// when both are valid.
+func verifyMfa(ctx *fiber.Ctx, config *internal.Config, s models.SSOer, eventService *event.Service, mfaToken, otp, recoveryCode string) (*models.UserModel, error) {
+	user, err := parseMfaToken(ctx.UserContext(), config, s, mfaToken)
+	if err == errMfaInvalid {
+		auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionMfaFailed}, errors.New("invalid mfa token"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if recoveryCode != "" {
+		err = useRecoveryCode(ctx, s, eventService, user, recoveryCode)
+	} else {
+		var totp *models.TotpModel
+		if totp, err = s.TotpManager().ByUser(ctx.UserContext(), user.Id); err != nil {
+			return nil, err
+		}
+		if totp == nil || !totp.Confirmed {
+			return nil, errMfaInvalid
+		}
+		err = verifyTotp(ctx.UserContext(), s, totp, otp)
+	}
+	// wrong codes count towards the lockout like wrong passwords, the lock invalidates the mfa token
+	if err == errMfaInvalid {
+		auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionMfaFailed, TargetId: user.Id, Subject: user.Email}, err)
+		if failErr := loginFailed(ctx, s, eventService, user); failErr != nil {
+			return nil, failErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = loginSucceeded(ctx.UserContext(), s, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// parseMfaToken returns the user the mfa token was issued to, if the user is still allowed to sign in.
+func parseMfaToken(ctx context.Context, config *internal.Config, s models.SSOer, mfaToken string) (*models.UserModel, error) {
+	parsedToken, err := jwt.ParseWithClaims(mfaToken, &internal.VerificationClaims{}, config.Crypto.KeyRing.Keyfunc)
+	if err != nil {
+		return nil, errMfaInvalid
+	}
+	claims, ok := parsedToken.Claims.(*internal.VerificationClaims)
+	if !ok || !parsedToken.Valid || claims.Action != models.UserActionMfa {
+		return nil, errMfaInvalid
+	}
+	id, err := strconv.ParseInt(claims.Id, 10, 64)
+	if err != nil {
+		return nil, errMfaInvalid
+	}
+
+	user, err := s.UserManager().ById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.Active || user.Locked || user.LockedTo > time.Now().Unix() || !user.MfaEnabled {
+		return nil, errMfaInvalid
+	}
+	return user, nil
+}
+
+// syncMfaEnabled keeps the second login step enabled while the user has an authenticator app or a passkey.
+// Recovery codes are issued and returned when the second step gets enabled and removed when it gets disabled.
+func syncMfaEnabled(ctx context.Context, s models.SSOer, user *models.UserModel) (codes []string, err error) {
+	err = s.Transaction(ctx, func(ctx context.Context) error {
+		totp, err := s.TotpManager().ByUser(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+		credentials, err := s.WebAuthnCredentialManager().ByUser(ctx, user.Id)
+		if err != nil {
+			return err
+		}
+		enabled := (totp != nil && totp.Confirmed) || len(credentials) > 0
+		if enabled == user.MfaEnabled {
+			return nil
+		}
+		user.MfaEnabled = enabled
+		if _, err = s.UserManager().Update(ctx, user); err != nil {
+			return err
+		}
+		if !enabled {
+			return s.RecoveryCodeManager().DeleteByUser(ctx, user.Id)
+		}
+		codes, err = issueRecoveryCodes(ctx, s, user)
+		return err
+	})
+	return codes, err
+}
+
+// issueRecoveryCodes replaces the recovery codes of the user, plain codes are returned only here.
+func issueRecoveryCodes(ctx context.Context, s models.SSOer, user *models.UserModel) ([]string, error) {
+	codes, err := internal.GenerateRecoveryCodes(s.MfaRecoveryCodes())
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*models.RecoveryCodeModel, 0, len(codes))
+	for _, code := range codes {
+		items = append(items, &models.RecoveryCodeModel{CodeHash: internal.HashRecoveryCode(code)})
+	}
+	if err = s.RecoveryCodeManager().Replace(ctx, user.Id, items); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useRecoveryCode spends the recovery code of the user and warns the user by email.
+func useRecoveryCode(ctx *fiber.Ctx, s models.SSOer, eventService *event.Service, user *models.UserModel, code string) error {
+	ok, err := s.RecoveryCodeManager().Use(ctx.UserContext(), user.Id, internal.HashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errMfaInvalid
+	}
+	remaining, err := s.RecoveryCodeManager().Remaining(ctx.UserContext(), user.Id)
+	if err != nil {
+		return err
+	}
+
+	audit(ctx, s, &models.AuditModel{
+		Action:   models.AuditActionRecoveryCodeUsed,
+		Outcome:  models.AuditOutcomeSuccess,
+		TargetId: user.Id,
+		Subject:  user.Email,
+		Detail:   strconv.FormatInt(remaining, 10) + " remaining",
+	})
+
+	// emit event
+	eventService.Emit(&event.RecoveryCodeUsed{
+		UserName:  user.Name,
+		UserEmail: user.Email,
+		Ip:        clientIp(ctx),
+		UserAgent: truncate(ctx.Get(fiber.HeaderUserAgent), 255),
+		Remaining: remaining,
+	})
+	return nil
+}
+
+// verifyTotp checks the code of the authenticator app, every code is accepted only once.
+func verifyTotp(ctx context.Context, s models.SSOer, totp *models.TotpModel, otp string) error {
+	secret, err := s.OpenSecret(totp.Secret)
+	if err != nil {
+		return err
+	}
+	counter, ok := internal.VerifyTotp(secret, otp, time.Now())
+	if !ok {
+		return errMfaInvalid
+	}
+	ok, err = s.TotpManager().Use(ctx, totp, counter)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errMfaInvalid
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,6 +15,11 @@ const (
 	ctxUserIdKey = "__ctx__user__id__key__"
 )
 
+var (
+	errInvalidToken = errors.New("invalid token")
+	errTokenUse     = errors.New("token is not meant for this use")
+)
+
 func CtxClaims(ctx *fiber.Ctx) *internal.SignInClaims {
 	l := ctx.Locals(ctxUserIdKey)
 	if l != nil {
@@ -21,32 +28,77 @@ func CtxClaims(ctx *fiber.Ctx) *internal.SignInClaims {
 	return nil
 }
 
-func Authenticate(config *internal.Config, roles ...string) fiber.Handler {
+// BearerToken returns the token from Authorization header, prefix is optional.
+func BearerToken(ctx *fiber.Ctx) string {
+	tokenString := ctx.Get("Authorization")
+	if strings.HasPrefix(tokenString, prefix) {
+		tokenString = strings.TrimPrefix(tokenString, prefix)
+	}
+	return tokenString
+}
+
+// ParseSignInToken verifies the access token signature and expiration and returns its claims, the other tokens
+// signed by the key ring, like id_tokens, are refused.
+func ParseSignInToken(config *internal.Config, tokenString string) (*internal.SignInClaims, error) {
+	return parseSignInToken(config, tokenString, internal.TokenUseAccess)
+}
+
+// ParseSessionToken verifies the token of the sso cookie and returns its claims.
+func ParseSessionToken(config *internal.Config, tokenString string) (*internal.SignInClaims, error) {
+	return parseSignInToken(config, tokenString, internal.TokenUseSession)
+}
+
+func parseSignInToken(config *internal.Config, tokenString, use string) (*internal.SignInClaims, error) {
+	parsedToken, err := jwt.ParseWithClaims(tokenString, &internal.SignInClaims{}, config.Crypto.KeyRing.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := parsedToken.Claims.(*internal.SignInClaims)
+	if !ok || !parsedToken.Valid {
+		return nil, errInvalidToken
+	}
+	if claims.TokenUse != use || claims.Id == 0 || claims.SessionId == "" {
+		return nil, errTokenUse
+	}
+	return claims, nil
+}
+
+// Authenticate verifies bearer token, the server side session the token is bound to and the application the token
+// is issued for, routes restricted to roles which require two-factor authentication accept only sessions confirmed
+// by the second factor.
+func Authenticate(config *internal.Config, s models.SSOer, roles ...string) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		tokenString := ctx.Get("Authorization")
+		tokenString := BearerToken(ctx)
 		if tokenString == "" {
 			return fiber.NewError(fiber.StatusBadRequest, "token required")
 		}
-		if strings.HasPrefix(tokenString, prefix) {
-			tokenString = strings.TrimPrefix(tokenString, prefix)
+		claims, err := ParseSignInToken(config, tokenString)
+		if err == errInvalidToken {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
 		}
-		parsedToken, err := jwt.ParseWithClaims(tokenString, &internal.SignInClaims{}, func(token *jwt.Token) (interface{}, error) {
-			// since we only use the one private key to sign the tokens,
-			// we also only use its public counterpart to verify
-			return config.Crypto.PublicKey, nil
-		})
 		if err != nil {
 			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
 		}
-		if claims, ok := parsedToken.Claims.(*internal.SignInClaims); ok && parsedToken.Valid {
-			if claims.IsAuthorized(roles...) {
-				ctx.Locals(ctxUserIdKey, claims)
-			} else {
-				return fiber.NewError(fiber.StatusUnauthorized, "you are unauthorized to perform this action")
-			}
-		} else {
-			return fiber.NewError(fiber.StatusBadRequest, "invalid token")
+		session, err := checkSession(ctx.UserContext(), s, claims.SessionId)
+		if err == nil {
+			err = checkAudience(ctx.UserContext(), s, claims)
+		}
+		if err == errSessionRevoked || err == errAudience {
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		} else if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		denied := &models.AuditModel{Action: models.AuditActionAuthorizationDenied, ActorId: claims.Id, Subject: ctx.Path()}
+		if !claims.IsAuthorized(roles...) {
+			auditFailure(ctx, s, denied, errors.New("missing role"))
+			return fiber.NewError(fiber.StatusUnauthorized, "you are unauthorized to perform this action")
+		}
+		// privileged roles have to sign in with the second factor to use role restricted routes
+		if len(roles) > 0 && s.MfaRequired(claims.Roles) && !session.Mfa {
+			auditFailure(ctx, s, denied, errors.New("second factor required"))
+			return fiber.NewError(fiber.StatusForbidden, "two-factor authentication is required to perform this action")
 		}
+		ctx.Locals(ctxUserIdKey, claims)
 		return ctx.Next()
 	}
 }
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/event"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/MiG-21/go-sso/internal/web/views"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	OAuthErrInvalidRequest          = "invalid_request"
+	OAuthErrInvalidClient           = "invalid_client"
+	OAuthErrInvalidGrant            = "invalid_grant"
+	OAuthErrUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthErrUnsupportedResponseType = "unsupported_response_type"
+	OAuthErrServerError             = "server_error"
+	OAuthErrTemporarilyUnavailable  = "temporarily_unavailable"
+)
+
+func OAuthError(ctx *fiber.Ctx, status int, code, description string) error {
+	ctx.Set("Cache-Control", "no-store")
+	ctx.Set("Pragma", "no-cache")
+	out := types.OAuthErrorResponse{
+		Error:            code,
+		ErrorDescription: description,
+	}
+	return ctx.Status(status).JSON(out)
+}
+
+// oauthServerError answers the unexpected error, a storage timeout or outage tells the client to retry later.
+func oauthServerError(ctx *fiber.Ctx, err error) error {
+	if code := storageStatus(err); code != 0 {
+		return OAuthError(ctx, code, OAuthErrTemporarilyUnavailable, err.Error())
+	}
+	return OAuthError(ctx, fiber.StatusInternalServerError, OAuthErrServerError, err.Error())
+}
+
+// AuthorizeFormHandler renders login form for the oauth authorization code flow, an active sso session
+// is reused unless prompt=login is requested.
+func AuthorizeFormHandler(config *internal.Config, s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.AuthorizeRequest{}
+		if err := ctx.QueryParser(params); err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+
+		if _, err := authorizeClient(ctx.UserContext(), s, params); err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return authorizeErrorRedirect(ctx, params, authorizeErrorCode(validationErrors), validationErrors[0].Error())
+		}
+
+		if params.Prompt != PromptLogin {
+			session, user, err := currentSession(ctx, config, s)
+			if err != nil {
+				return authorizeErrorRedirect(ctx, params, OAuthErrServerError, "")
+			}
+			if session != nil {
+				return issueAuthorizationCode(ctx, s, params, user, session)
+			}
+		}
+
+		data := views.AuthorizeFormViewData(ctx, params)
+		return ctx.Render("authorize_form", data, "layout")
+	}
+}
+
+// AuthorizeHandler authenticates the user and redirects back to the client with the authorization code, users with
+// an expired password are sent to change it instead.
+func AuthorizeHandler(config *internal.Config, s models.SSOer, validator *internal.ServiceValidator, eventService *event.Service) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.AuthorizeLoginRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+
+		if _, err := authorizeClient(ctx.UserContext(), s, &params.AuthorizeRequest); err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(&params.AuthorizeRequest))
+		if validationErrors != nil {
+			return authorizeErrorRedirect(ctx, &params.AuthorizeRequest, authorizeErrorCode(validationErrors), validationErrors[0].Error())
+		}
+
+		validationErrors = HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			data := views.AuthorizeFormViewData(ctx, &params.AuthorizeRequest, ValidationErrorsToErrors(validationErrors)...)
+			return ctx.Render("authorize_form", data, "layout")
+		}
+
+		item, err := authenticate(ctx, s, eventService, params.ClientId, params.Email, params.Password)
+		if err == errTooManyAttempts {
+			data := views.AuthorizeFormViewData(ctx, &params.AuthorizeRequest, err)
+			return ctx.Render("authorize_form", data, "layout")
+		}
+		if err != nil || item == nil {
+			data := views.AuthorizeFormViewData(ctx, &params.AuthorizeRequest, errors.New("email or password is incorrect"))
+			return ctx.Render("authorize_form", data, "layout")
+		}
+		if item.MfaEnabled {
+			mfaToken, _, err := mfaChallenge(s, item)
+			if err != nil {
+				return authorizeErrorRedirect(ctx, &params.AuthorizeRequest, OAuthErrServerError, "")
+			}
+			data := views.AuthorizeMfaFormViewData(ctx, &params.AuthorizeRequest, mfaToken)
+			return ctx.Render("mfa_form", data, "layout")
+		}
+		if passwordExpired(s, item) {
+			return expiredPasswordRedirect(ctx, config, s, item)
+		}
+
+		return authorizeLogin(ctx, s, &params.AuthorizeRequest, item, false)
+	}
+}
+
+// authorizeLogin starts the sso session of the authenticated user and issues the authorization code.
+func authorizeLogin(ctx *fiber.Ctx, s models.SSOer, params *types.AuthorizeRequest, user *models.UserModel, mfa bool) error {
+	session, err := startSession(ctx, s, user, params.ClientId, time.Hour*time.Duration(s.RefreshTokenValidHours()), mfa)
+	if err != nil {
+		return authorizeErrorRedirect(ctx, params, OAuthErrServerError, "")
+	}
+	if err = setSessionCookie(ctx, s, user, session); err != nil {
+		return authorizeErrorRedirect(ctx, params, OAuthErrServerError, "")
+	}
+
+	return issueAuthorizationCode(ctx, s, params, user, session)
+}
+
+// TokenHandler godoc
+// @Summary oauth token
+// @Description exchanges oauth grant for an access token
+// @Id oauth-token
+// @Tags oauth
+// @Param params body types.TokenRequest true "request body"
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Success 200 {object} types.TokenResponse
+// @Failure 400 {object} types.OAuthErrorResponse
+// @Failure 401 {object} types.OAuthErrorResponse
+// @Router /oauth/token [post]
+func TokenHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.TokenRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidRequest, err.Error())
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidRequest, validationErrors[0].Error())
+		}
+
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), params.ClientId)
+		if err != nil {
+			return oauthServerError(ctx, err)
+		}
+		if app == nil {
+			return OAuthError(ctx, fiber.StatusUnauthorized, OAuthErrInvalidClient, "unknown client")
+		}
+
+		switch params.GrantType {
+		case internal.GrantTypeAuthorizationCode:
+			return authorizationCodeGrant(ctx, s, app, params)
+		case internal.GrantTypeRefreshToken:
+			return refreshTokenGrant(ctx, s, app, params)
+		default:
+			return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrUnsupportedGrantType, "")
+		}
+	}
+}
+
+func authorizationCodeGrant(ctx *fiber.Ctx, s models.SSOer, app *models.ApplicationModel, params *types.TokenRequest) error {
+	if params.Code == "" || params.RedirectUri == "" || params.CodeVerifier == "" {
+		return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidRequest, "code, redirect_uri and code_verifier are required")
+	}
+
+	code, err := s.AuthorizationCodeManager().ByCode(ctx.UserContext(), internal.HashToken(params.Code))
+	if err != nil {
+		return oauthServerError(ctx, err)
+	}
+	if code == nil || code.Used || code.IsExpired(time.Now().Unix()) {
+		return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidGrant, "authorization code is invalid or expired")
+	}
+	if code.ClientId != app.Code || code.RedirectUri != params.RedirectUri {
+		return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidGrant, "authorization code was issued to another client")
+	}
+	if !internal.VerifyPKCE(params.CodeVerifier, code.CodeChallenge, code.CodeChallengeMethod) {
+		auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionToken, TargetId: code.UserId, Application: app.Code}, errors.New("code_verifier does not match"))
+		return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidGrant, "code_verifier does not match")
+	}
+
+	// the code is single use, concurrent exchange attempts lose here
+	ok, err := s.AuthorizationCodeManager().Consume(ctx.UserContext(), code)
+	if err != nil {
+		return oauthServerError(ctx, err)
+	}
+	if !ok {
+		return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidGrant, "authorization code is invalid or expired")
+	}
+
+	user, err := s.UserManager().ById(ctx.UserContext(), code.UserId)
+	if err != nil {
+		return oauthServerError(ctx, err)
+	}
+	if user == nil || !user.Active {
+		return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidGrant, "user is not available")
+	}
+
+	if _, err = checkSession(ctx.UserContext(), s, code.SessionId); err != nil {
+		return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidGrant, err.Error())
+	}
+
+	accessToken, expiresIn, err := buildAccessToken(s, user, code.SessionId, app.Code, code.Scope)
+	if err != nil {
+		return oauthServerError(ctx, err)
+	}
+	refreshToken, err := issueRefreshToken(ctx.UserContext(), s, user, app.Code, code.Scope, code.SessionId, nil)
+	if err != nil {
+		return oauthServerError(ctx, err)
+	}
+
+	out := types.TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresIn,
+		RefreshToken: refreshToken,
+		Scope:        code.Scope,
+	}
+
+	if internal.HasScope(code.Scope, internal.ScopeOpenId) {
+		now := time.Now()
+		claims := &internal.IdTokenClaims{
+			Nonce:     code.Nonce,
+			AuthTime:  code.AuthTime,
+			SessionId: code.SessionId,
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    OpenIdIssuer(ctx, s),
+				Subject:   OpenIdSubject(user),
+				Audience:  app.Code,
+				IssuedAt:  now.Unix(),
+				ExpiresAt: now.Add(time.Duration(expiresIn) * time.Second).Unix(),
+			},
+		}
+		if internal.HasScope(code.Scope, internal.ScopeEmail) {
+			claims.Email = user.Email
+			claims.EmailVerified = user.Active
+		}
+		if internal.HasScope(code.Scope, internal.ScopeProfile) {
+			claims.Name = user.Name
+		}
+		if out.IdToken, err = s.BuildIdToken(claims); err != nil {
+			return oauthServerError(ctx, err)
+		}
+	}
+
+	audit(ctx, s, &models.AuditModel{
+		Action:      models.AuditActionToken,
+		Outcome:     models.AuditOutcomeSuccess,
+		TargetId:    user.Id,
+		Subject:     user.Email,
+		Application: app.Code,
+		Detail:      internal.GrantTypeAuthorizationCode,
+	})
+
+	ctx.Set("Cache-Control", "no-store")
+	ctx.Set("Pragma", "no-cache")
+	return ctx.Status(fiber.StatusOK).JSON(out)
+}
+
+func issueAuthorizationCode(ctx *fiber.Ctx, s models.SSOer, params *types.AuthorizeRequest, user *models.UserModel, session *models.SessionModel) error {
+	value, err := internal.RandomString(32)
+	if err != nil {
+		return authorizeErrorRedirect(ctx, params, OAuthErrServerError, "")
+	}
+	if err = joinSession(ctx.UserContext(), s, session, params.ClientId); err != nil {
+		return authorizeErrorRedirect(ctx, params, OAuthErrServerError, "")
+	}
+	code := &models.AuthorizationCodeModel{
+		Code:                internal.HashToken(value),
+		ClientId:            params.ClientId,
+		UserId:              user.Id,
+		SessionId:           session.Sid,
+		RedirectUri:         params.RedirectUri,
+		Scope:               params.Scope,
+		CodeChallenge:       params.CodeChallenge,
+		CodeChallengeMethod: params.CodeChallengeMethod,
+		Nonce:               params.Nonce,
+		AuthTime:            session.Created,
+		ExpiresAt:           time.Now().Add(time.Second * time.Duration(s.CodeValidSeconds())).Unix(),
+	}
+	if err = s.AuthorizationCodeManager().Create(ctx.UserContext(), code); err != nil {
+		return authorizeErrorRedirect(ctx, params, OAuthErrServerError, "")
+	}
+
+	q := url.Values{}
+	q.Set("code", value)
+	return authorizeRedirect(ctx, params, q)
+}
+
+// authorizeClient checks client_id and redirect_uri, errors must never be redirected to the client.
+func authorizeClient(ctx context.Context, s models.SSOer, params *types.AuthorizeRequest) (*models.ApplicationModel, error) {
+	if params.ClientId == "" {
+		return nil, errors.New("client_id is required")
+	}
+	app, err := s.ApplicationManager().ByCode(ctx, params.ClientId)
+	if err != nil {
+		return nil, err
+	}
+	if app == nil {
+		return nil, errors.New("unknown client")
+	}
+	if !app.AllowsRedirectUri(params.RedirectUri) {
+		return nil, errors.New("redirect_uri is not registered for the client")
+	}
+	return app, nil
+}
+
+func authorizeErrorCode(validationErrors []*ValidationError) string {
+	for _, e := range validationErrors {
+		if strings.HasSuffix(e.Field, ".ResponseType") {
+			return OAuthErrUnsupportedResponseType
+		}
+	}
+	return OAuthErrInvalidRequest
+}
+
+func authorizeErrorRedirect(ctx *fiber.Ctx, params *types.AuthorizeRequest, code, description string) error {
+	q := url.Values{}
+	q.Set("error", code)
+	if description != "" {
+		q.Set("error_description", description)
+	}
+	return authorizeRedirect(ctx, params, q)
+}
+
+func authorizeRedirect(ctx *fiber.Ctx, params *types.AuthorizeRequest, q url.Values) error {
+	if params.State != "" {
+		q.Set("state", params.State)
+	}
+	location, err := url.Parse(params.RedirectUri)
+	if err != nil {
+		return errorPage(ctx, fiber.StatusBadRequest, err)
+	}
+	query := location.Query()
+	for k, v := range q {
+		query[k] = v
+	}
+	location.RawQuery = query.Encode()
+	return ctx.Redirect(location.String(), fiber.StatusFound)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+// OpenIdConfigurationHandler godoc
+// @Summary openid connect discovery
+// @Description openid connect discovery document
+// @Id openid-configuration
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} types.OpenIdConfiguration
+// @Router /.well-known/openid-configuration [get]
+func OpenIdConfigurationHandler(s models.SSOer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		issuer := OpenIdIssuer(ctx, s)
+		out := types.OpenIdConfiguration{
+			Issuer:                             issuer,
+			AuthorizationEndpoint:              issuer + "/oauth/authorize",
+			TokenEndpoint:                      issuer + "/oauth/token",
+			UserInfoEndpoint:                   issuer + "/userinfo",
+			JwksUri:                            issuer + "/.well-known/jwks.json",
+			ScopesSupported:                    []string{internal.ScopeOpenId, internal.ScopeProfile, internal.ScopeEmail},
+			ResponseTypesSupported:             []string{internal.ResponseTypeCode},
+			GrantTypesSupported:                []string{internal.GrantTypeAuthorizationCode, internal.GrantTypeRefreshToken},
+			SubjectTypesSupported:              []string{"public"},
+			IdTokenSigningAlgValuesSupported:   []string{"RS256"},
+			TokenEndpointAuthMethodsSupported:  []string{"none"},
+			CodeChallengeMethodsSupported:      []string{internal.PKCEMethodS256},
+			ClaimsSupported:                    []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "sid", "name", "gender", "email", "email_verified", "updated_at"},
+			FrontchannelLogoutSupported:        true,
+			FrontchannelLogoutSessionSupported: true,
+			BackchannelLogoutSupported:         true,
+			BackchannelLogoutSessionSupported:  true,
+		}
+		return ctx.Status(fiber.StatusOK).JSON(out)
+	}
+}
+
+// JWKSHandler godoc
+// @Summary json web key set
+// @Description public keys used to verify issued tokens, selected by kid header
+// @Id jwks
+// @Tags oidc
+// @Produce json
+// @Success 200 {object} types.JSONWebKeySet
+// @Router /.well-known/jwks.json [get]
+func JWKSHandler(config *internal.Config) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		out := types.JSONWebKeySet{Keys: []types.JSONWebKey{}}
+		for _, key := range config.Crypto.KeyRing.Keys() {
+			out.Keys = append(out.Keys, types.JSONWebKey{
+				Kty: "RSA",
+				Use: "sig",
+				Kid: key.Id,
+				N:   internal.KeyModulus(key.PublicKey),
+				E:   internal.KeyExponent(key.PublicKey),
+			})
+		}
+		ctx.Set("Cache-Control", "public, max-age=300")
+		return ctx.Status(fiber.StatusOK).JSON(out)
+	}
+}
+
+// OpenIdUserInfoHandler godoc
+// @Summary openid connect userinfo
+// @Description claims about the authenticated user
+// @Id openid-userinfo
+// @Tags oidc
+// @Param Authorization header string true "bearer token"
+// @Produce json
+// @Success 200 {object} types.OpenIdUserInfoResponse
+// @Failure 401 {object} types.OAuthErrorResponse
+// @Failure 403 {object} types.OAuthErrorResponse
+// @Router /userinfo [get]
+func OpenIdUserInfoHandler(config *internal.Config, s models.SSOer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		tokenString := BearerToken(ctx)
+		if tokenString == "" {
+			ctx.Set("WWW-Authenticate", `Bearer`)
+			return OAuthError(ctx, fiber.StatusUnauthorized, OAuthErrInvalidRequest, "token required")
+		}
+		claims, err := ParseSignInToken(config, tokenString)
+		if err == nil {
+			_, err = checkSession(ctx.UserContext(), s, claims.SessionId)
+		}
+		if err == nil {
+			err = checkAudience(ctx.UserContext(), s, claims)
+		}
+		if err != nil {
+			ctx.Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			return OAuthError(ctx, fiber.StatusUnauthorized, "invalid_token", err.Error())
+		}
+		if !internal.HasScope(claims.Scope, internal.ScopeOpenId) {
+			ctx.Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			return OAuthError(ctx, fiber.StatusForbidden, "insufficient_scope", "openid scope is required")
+		}
+
+		user, err := s.UserManager().ById(ctx.UserContext(), claims.Id)
+		if err != nil {
+			return oauthServerError(ctx, err)
+		}
+		if user == nil {
+			ctx.Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			return OAuthError(ctx, fiber.StatusUnauthorized, "invalid_token", "user not found")
+		}
+
+		// the claims are limited to the scope granted to the application
+		ctx.Set("Cache-Control", "no-store")
+		out := types.OpenIdUserInfoResponse{
+			Sub: OpenIdSubject(user),
+		}
+		if internal.HasScope(claims.Scope, internal.ScopeProfile) {
+			out.Name = user.Name
+			out.Gender = user.Gender
+			out.UpdatedAt = user.Updated
+		}
+		if internal.HasScope(claims.Scope, internal.ScopeEmail) {
+			out.Email = user.Email
+			out.EmailVerified = &user.Active
+		}
+		return ctx.Status(fiber.StatusOK).JSON(out)
+	}
+}
+
+// OpenIdIssuer returns configured issuer or falls back to the public url and then to the request base url.
+func OpenIdIssuer(ctx *fiber.Ctx, s models.SSOer) string {
+	if issuer := s.Issuer(); issuer != "" {
+		return strings.TrimRight(issuer, "/")
+	}
+	if base := s.PublicUrl(); base != "" {
+		return base
+	}
+	return ctx.BaseURL()
+}
+
+func OpenIdSubject(user *models.UserModel) string {
+	return strconv.FormatInt(user.Id, 10)
+}
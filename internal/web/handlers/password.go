@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// checkPassword applies the password policy, violations are returned as validation errors of the field so they
+// are reported along with the request validation. The email and the name of the user go to personal.
+func checkPassword(s models.SSOer, field, password string, personal ...string) ([]*ValidationError, error) {
+	violations, err := s.PasswordPolicy().Check(password, personal...)
+	if err != nil {
+		return nil, err
+	}
+	var errs []*ValidationError
+	for _, v := range violations {
+		errs = append(errs, &ValidationError{
+			Field: field,
+			Tag:   v.Tag,
+			Value: v.Param,
+		})
+	}
+	return errs, nil
+}
+
+// passwordReused reports whether the password is the current or one of the remembered previous passwords of the user.
+func passwordReused(ctx context.Context, s models.SSOer, user *models.UserModel, password string) (bool, error) {
+	size := s.PasswordPolicy().HistorySize()
+	if size <= 0 {
+		return false, nil
+	}
+	hashes := []string{user.Password}
+	items, err := s.PasswordHistoryManager().Recent(ctx, user.Id, size)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		hashes = append(hashes, item.Password)
+	}
+	for _, hash := range hashes {
+		// hashes of unknown format cannot match
+		if ok, _ := s.PasswordHasher().Verify(hash, password); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// rememberPassword adds the replaced password hash of the user to the history and drops the oldest ones.
+func rememberPassword(ctx context.Context, s models.SSOer, userId int64, hash string) error {
+	size := s.PasswordPolicy().HistorySize()
+	if size <= 0 || hash == "" {
+		return nil
+	}
+	if err := s.PasswordHistoryManager().Add(ctx, &models.PasswordHistoryModel{UserId: userId, Password: hash}); err != nil {
+		return err
+	}
+	return s.PasswordHistoryManager().Prune(ctx, userId, size)
+}
+
+// passwordExpired reports whether the password of the user is older than the maximum age of the policy.
+func passwordExpired(s models.SSOer, user *models.UserModel) bool {
+	changed := user.PasswordChanged
+	if changed == 0 {
+		changed = user.Created
+	}
+	return s.PasswordPolicy().Expired(changed, time.Now())
+}
+
+// expiredPasswordRedirect sends the user to the change password form instead of signing in, the form is protected
+// by the same one-time code as the password recovery.
+func expiredPasswordRedirect(ctx *fiber.Ctx, config *internal.Config, s models.SSOer, user *models.UserModel) error {
+	rand, err := uuid.NewRandom()
+	if err != nil {
+		return errorPage(ctx, fiber.StatusInternalServerError, err)
+	}
+	user.Code = rand.String()
+	if _, err = s.UserManager().Update(ctx.UserContext(), user); err != nil {
+		return errorPage(ctx, fiber.StatusInternalServerError, err)
+	}
+
+	audit(ctx, s, &models.AuditModel{
+		Action:   models.AuditActionPasswordExpired,
+		Outcome:  models.AuditOutcomeSuccess,
+		TargetId: user.Id,
+		Subject:  user.Email,
+	})
+
+	// the redirect stays on the host the user signs in at
+	vUrl, err := user.GetActionUrl(&url.URL{}, "/password/change", models.UserActionPasswordExpired, config.Crypto.KeyRing.Active())
+	if err != nil {
+		return errorPage(ctx, fiber.StatusInternalServerError, err)
+	}
+	return ctx.Redirect(vUrl.RequestURI(), fiber.StatusFound)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/url"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+const clientIpLocalsKey = "client_ip"
+
+// ClientIp resolves the address of the client behind the trusted proxies once per request, see clientIp.
+func ClientIp(proxies *internal.TrustedProxies) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		peer := ctx.Context().RemoteIP().String()
+		ctx.Locals(clientIpLocalsKey, proxies.ClientIp(peer, ctx.Get(fiber.HeaderXForwardedFor)))
+		return ctx.Next()
+	}
+}
+
+// clientIp returns the real client address, it is the one logged, rate limited and stored with sessions.
+func clientIp(ctx *fiber.Ctx) string {
+	if ip, ok := ctx.Locals(clientIpLocalsKey).(string); ok {
+		return ip
+	}
+	return ctx.IP()
+}
+
+// publicUrl returns the base of the links sent to the user, the public url of the application with the code or
+// the global one. The request host is used only when neither is configured, forwarded hosts are honored from trusted
+// proxies only.
+func publicUrl(ctx *fiber.Ctx, s models.SSOer, code string) (*url.URL, error) {
+	base := s.PublicUrl()
+	if code != "" {
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), code)
+		if err != nil {
+			return nil, err
+		}
+		if app != nil && app.PublicUrl != "" {
+			base = app.PublicUrl
+		}
+	}
+	if base == "" {
+		return &url.URL{Scheme: ctx.Protocol(), Host: ctx.Hostname()}, nil
+	}
+	return url.Parse(base)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/MiG-21/go-sso/internal/ratelimit"
+	"github.com/MiG-21/go-sso/internal/web/views"
+	"github.com/gofiber/fiber/v2"
+)
+
+const errRateLimited = "too many requests, try again later"
+
+// rateLimitFields are the request fields the buckets are keyed by, code is the application code of the login
+// routes while the token endpoint identifies the application by client_id.
+type rateLimitFields struct {
+	Email    string `json:"email" form:"email" query:"email"`
+	Code     string `json:"code" form:"code" query:"code"`
+	ClientId string `json:"client_id" form:"client_id" query:"client_id"`
+}
+
+// RateLimit counts the request in the buckets of the route rule and responds with 429 once any of them is full.
+// Browser requests get the error page, other clients the plain error, both with the Retry-After header.
+func RateLimit(limiter *ratelimit.Limiter, route string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		rule, ok := limiter.Rule(route)
+		if !ok {
+			return ctx.Next()
+		}
+
+		fields := rateLimitRequestFields(ctx)
+		for _, by := range rule.By {
+			var value string
+			switch by {
+			case ratelimit.ByIp:
+				value = clientIp(ctx)
+			case ratelimit.ByEmail:
+				value = strings.TrimSpace(fields.Email)
+			case ratelimit.ByClient:
+				value = fields.ClientId
+				if value == "" {
+					value = fields.Code
+				}
+			}
+			if value == "" {
+				continue
+			}
+
+			wait, err := limiter.Allow(route, by, value)
+			if err != nil {
+				return HttpError(ctx, fiber.StatusInternalServerError, err)
+			}
+			if wait > 0 {
+				ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				if strings.Contains(ctx.Get(fiber.HeaderAccept), fiber.MIMETextHTML) {
+					data := views.ErrorViewData(fiber.StatusTooManyRequests, errRateLimited)
+					return ctx.Status(fiber.StatusTooManyRequests).Render("error", data, "layout")
+				}
+				return fiber.NewError(fiber.StatusTooManyRequests, errRateLimited)
+			}
+		}
+		return ctx.Next()
+	}
+}
+
+func rateLimitRequestFields(ctx *fiber.Ctx) *rateLimitFields {
+	fields := &rateLimitFields{}
+	_ = ctx.QueryParser(fields)
+	if ctx.Method() != fiber.MethodGet && len(ctx.Body()) > 0 {
+		_ = ctx.BodyParser(fields)
+	}
+	return fields
+}
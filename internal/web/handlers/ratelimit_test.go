@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/ratelimit"
+	"github.com/MiG-21/go-sso/internal/web/handlers"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/template/html"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimit", func() {
+	var limitApp *fiber.App
+
+	BeforeEach(func() {
+		limiter := ratelimit.NewLimiter(&internal.ConfigRateLimit{
+			Enabled: true,
+			Rules: map[string]internal.ConfigRateLimitRule{
+				"login": {Limit: 2, WindowSeconds: 60, By: []string{ratelimit.ByIp, ratelimit.ByEmail}},
+			},
+		}, ratelimit.NewMemoryStorage())
+		limitApp = fiber.New(fiber.Config{
+			Views:                 html.New("../../../web/template/sso/", ".html"),
+			DisableStartupMessage: true,
+		})
+		limitApp.Post("/login", handlers.RateLimit(limiter, "login"), func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(fiber.StatusNoContent)
+		})
+		limitApp.Post("/other", handlers.RateLimit(limiter, "other"), func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(fiber.StatusNoContent)
+		})
+	})
+
+	post := func(target, email, accept string) *http.Response {
+		req := httptest.NewRequest(fiber.MethodPost, target, strings.NewReader(`{"email":"`+email+`"}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		if accept != "" {
+			req.Header.Set(fiber.HeaderAccept, accept)
+		}
+		resp, err := limitApp.Test(req)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+
+	It("answers the api client with 429 and Retry-After", func() {
+		Expect(post("/login", "user@example.com", "").StatusCode).To(Equal(fiber.StatusNoContent))
+		Expect(post("/login", "user@example.com", "").StatusCode).To(Equal(fiber.StatusNoContent))
+
+		resp := post("/login", "user@example.com", fiber.MIMEApplicationJSON)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusTooManyRequests))
+		Expect(resp.Header.Get(fiber.HeaderRetryAfter)).To(MatchRegexp(`^[1-9][0-9]*$`))
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("too many requests"))
+		Expect(resp.Header.Get(fiber.HeaderContentType)).NotTo(ContainSubstring(fiber.MIMETextHTML))
+	})
+
+	It("shows the error page to the browser with 429 and Retry-After", func() {
+		post("/login", "user@example.com", "")
+		post("/login", "user@example.com", "")
+
+		resp := post("/login", "user@example.com", "text/html,application/xhtml+xml")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusTooManyRequests))
+		Expect(resp.Header.Get(fiber.HeaderRetryAfter)).To(MatchRegexp(`^[1-9][0-9]*$`))
+		Expect(resp.Header.Get(fiber.HeaderContentType)).To(ContainSubstring(fiber.MIMETextHTML))
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("too many requests, try again later"))
+	})
+
+	It("leaves the route without a rule unlimited", func() {
+		for i := 0; i < 5; i++ {
+			Expect(post("/other", "user@example.com", "").StatusCode).To(Equal(fiber.StatusNoContent))
+		}
+	})
+})
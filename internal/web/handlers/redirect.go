@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+)
+
+var (
+	errRedirectUri           = errors.New("redirect_uri is not registered for the application")
+	errPostLogoutRedirectUri = errors.New("redirect_uri is not registered as post logout redirect uri of the application")
+)
+
+// loginRedirectUrl returns the page the signed in user is sent to, the requested redirect uri has to be registered
+// for the application, the default redirect url of the application is used otherwise.
+func loginRedirectUrl(app *models.ApplicationModel, redirect types.RedirectRequest) (string, error) {
+	uri := app.RedirectUrl
+	if redirect.RedirectUri != "" {
+		if !app.AllowsRedirectUri(redirect.RedirectUri) {
+			return "", errRedirectUri
+		}
+		uri = redirect.RedirectUri
+	}
+	return withState(uri, redirect.State)
+}
+
+// logoutRedirectUrl returns the page the user is sent to after the logout, the login form of the application
+// unless a registered post logout redirect uri is requested.
+func logoutRedirectUrl(app *models.ApplicationModel, redirect types.RedirectRequest) (string, error) {
+	if redirect.RedirectUri == "" {
+		return "/login?code=" + url.QueryEscape(app.Code), nil
+	}
+	if !app.AllowsPostLogoutRedirectUri(redirect.RedirectUri) {
+		return "", errPostLogoutRedirectUri
+	}
+	return withState(redirect.RedirectUri, redirect.State)
+}
+
+func withState(uri, state string) (string, error) {
+	if state == "" {
+		return uri, nil
+	}
+	location, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	query := location.Query()
+	query.Set("state", state)
+	location.RawQuery = query.Encode()
+	return location.String(), nil
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// rotatedTokens replace the consumed refresh token
+type rotatedTokens struct {
+	scope        string
+	accessToken  string
+	expiresIn    int64
+	refreshToken string
+}
+
+var (
+	errRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	errRefreshTokenReused  = errors.New("refresh token has been already used, all tokens of the session are revoked")
+)
+
+// RefreshTokenHandler godoc
+// @Summary refresh token
+// @Description rotates refresh token and issues a new access token
+// @Id refresh-token
+// @Tags sso
+// @Param params body types.RefreshTokenRequest true "request body"
+// @Accept json
+// @Produce json
+// @Success 200 {object} types.UserTokenResponse
+// @Failure 400 {object} fiber.Error
+// @Failure 401 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /refresh_token [post]
+func RefreshTokenHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		ctx.Set("Content-Type", "application/json")
+		params := &types.RefreshTokenRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		tokens, err := rotateRefreshToken(ctx.UserContext(), s, params.Code, params.RefreshToken)
+		switch err {
+		case nil:
+		case errRefreshTokenInvalid, errRefreshTokenReused:
+			auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionToken, Application: params.Code}, err)
+			return HttpError(ctx, fiber.StatusUnauthorized, err)
+		default:
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		out := types.UserTokenResponse{
+			Token:        tokens.accessToken,
+			RefreshToken: tokens.refreshToken,
+			ExpiresIn:    tokens.expiresIn,
+		}
+		return ctx.Status(fiber.StatusOK).JSON(out)
+	}
+}
+
+func refreshTokenGrant(ctx *fiber.Ctx, s models.SSOer, app *models.ApplicationModel, params *types.TokenRequest) error {
+	if params.RefreshToken == "" {
+		return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidRequest, "refresh_token is required")
+	}
+
+	tokens, err := rotateRefreshToken(ctx.UserContext(), s, app.Code, params.RefreshToken)
+	switch err {
+	case nil:
+	case errRefreshTokenInvalid, errRefreshTokenReused:
+		auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionToken, Application: app.Code}, err)
+		return OAuthError(ctx, fiber.StatusBadRequest, OAuthErrInvalidGrant, err.Error())
+	default:
+		return oauthServerError(ctx, err)
+	}
+
+	ctx.Set("Cache-Control", "no-store")
+	ctx.Set("Pragma", "no-cache")
+	out := types.TokenResponse{
+		AccessToken:  tokens.accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    tokens.expiresIn,
+		RefreshToken: tokens.refreshToken,
+		Scope:        tokens.scope,
+	}
+	return ctx.Status(fiber.StatusOK).JSON(out)
+}
+
+// buildAccessToken signs short-lived access token of the application with the granted scope, it returns the token
+// and its lifetime in seconds.
+func buildAccessToken(s models.SSOer, user *models.UserModel, sid, clientId, scope string) (string, int64, error) {
+	validFor := time.Minute * time.Duration(s.AccessTokenValidMinutes())
+	exp := time.Now().Add(validFor).UTC()
+	token, err := s.BuildJWTToken(user.Id, strings.Split(user.Role, ","), sid, clientId, scope, exp)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, int64(validFor.Seconds()), nil
+}
+
+// issueRefreshToken stores a new refresh token, the token continues the family of the parent when given.
+func issueRefreshToken(ctx context.Context, s models.SSOer, user *models.UserModel, clientId, scope, sid string, parent *models.RefreshTokenModel) (string, error) {
+	value, err := internal.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	token := &models.RefreshTokenModel{
+		Token:     internal.HashToken(value),
+		ClientId:  clientId,
+		UserId:    user.Id,
+		SessionId: sid,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(time.Hour * time.Duration(s.RefreshTokenValidHours())).Unix(),
+	}
+	if parent != nil {
+		token.FamilyId = parent.FamilyId
+		token.ParentId = parent.Id
+	} else {
+		family, err := uuid.NewRandom()
+		if err != nil {
+			return "", err
+		}
+		token.FamilyId = family.String()
+	}
+	if err = s.RefreshTokenManager().Create(ctx, token); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// rotateRefreshToken consumes the presented refresh token and stores its replacement in one transaction, so the
+// client keeps its token when the replacement cannot be issued. Presenting already used token means it has leaked,
+// so the whole family gets revoked. The tokens of the account locked for a while are refused but left usable once
+// the lock is over.
+func rotateRefreshToken(ctx context.Context, s models.SSOer, clientId, value string) (*rotatedTokens, error) {
+	var (
+		out     *rotatedTokens
+		failure error
+	)
+	err := s.Transaction(ctx, func(tx context.Context) error {
+		token, err := s.RefreshTokenManager().ByToken(tx, internal.HashToken(value))
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		if token == nil || token.Revoked || token.ClientId != clientId || token.IsExpired(now) {
+			failure = errRefreshTokenInvalid
+			return nil
+		}
+		user, err := s.UserManager().ById(tx, token.UserId)
+		if err != nil {
+			return err
+		}
+		if user != nil && user.LockedTo > now {
+			failure = errRefreshTokenInvalid
+			return nil
+		}
+
+		ok, err := s.RefreshTokenManager().Consume(tx, token)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			failure = errRefreshTokenReused
+			_, err = s.RefreshTokenManager().RevokeFamily(tx, token.FamilyId)
+			return err
+		}
+
+		session, err := checkSession(tx, s, token.SessionId)
+		if err != nil && err != errSessionRevoked {
+			return err
+		}
+		if session == nil || user == nil || !user.Active || user.Locked {
+			failure = errRefreshTokenInvalid
+			_, err = s.RefreshTokenManager().RevokeFamily(tx, token.FamilyId)
+			return err
+		}
+
+		// the session lives as long as its refresh tokens are used
+		session.ExpiresAt = time.Now().Add(time.Hour * time.Duration(s.RefreshTokenValidHours())).Unix()
+		if err = s.SessionManager().Touch(tx, session); err != nil {
+			return err
+		}
+
+		out = &rotatedTokens{scope: token.Scope}
+		if out.accessToken, out.expiresIn, err = buildAccessToken(s, user, token.SessionId, token.ClientId, token.Scope); err != nil {
+			return err
+		}
+		out.refreshToken, err = issueRefreshToken(tx, s, user, token.ClientId, token.Scope, token.SessionId, token)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	return out, nil
+}
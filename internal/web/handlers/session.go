@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/event"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// sessionTouchInterval limits last_seen_at updates to one per interval
+	sessionTouchInterval = 60
+
+	// PromptLogin forces re-authentication even if the browser has an active session
+	PromptLogin = "login"
+)
+
+var (
+	errSessionRevoked = errors.New("session is revoked or expired")
+	errAudience       = errors.New("token is not issued for an application of the session")
+)
+
+// UserSessionsHandler godoc
+// @Summary user sessions
+// @Description active sessions of the current user
+// @Id user-sessions
+// @Tags user
+// @Param Authorization header string true "bearer token"
+// @Produce json
+// @Success 200 {array} types.SessionResponse
+// @Failure 500 {object} fiber.Error
+// @Router /user/sessions [get]
+func UserSessionsHandler(s models.SSOer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		claims := CtxClaims(ctx)
+		return sessionsResponse(ctx, s, claims.Id, claims.SessionId)
+	}
+}
+
+// UserSessionRevokeHandler godoc
+// @Summary revoke user session
+// @Description revokes one of the current user sessions
+// @Id user-session-revoke
+// @Tags user
+// @Param Authorization header string true "bearer token"
+// @Param params body types.SessionRevokeRequest true "request body"
+// @Accept json
+// @Produce json
+// @Success 204
+// @Failure 404 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /user/sessions/revoke [post]
+func UserSessionRevokeHandler(s models.SSOer, validator *internal.ServiceValidator, eventService *event.Service) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.SessionRevokeRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		session, err := s.SessionManager().BySid(ctx.UserContext(), params.Sid)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if session == nil || session.UserId != CtxClaims(ctx).Id {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+		if _, err = endSession(ctx, s, eventService, session); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:      models.AuditActionSessionRevoke,
+			Outcome:     models.AuditOutcomeSuccess,
+			TargetId:    session.UserId,
+			Application: session.ClientId,
+			Detail:      session.Sid,
+		})
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// UserSessionsRevokeAllHandler godoc
+// @Summary log out everywhere
+// @Description revokes every session of the current user
+// @Id user-sessions-revoke-all
+// @Tags user
+// @Param Authorization header string true "bearer token"
+// @Success 204
+// @Failure 500 {object} fiber.Error
+// @Router /user/sessions/revoke_all [post]
+func UserSessionsRevokeAllHandler(s models.SSOer, eventService *event.Service) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		userId := CtxClaims(ctx).Id
+		if err := endUserSessions(ctx, s, eventService, userId); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionSessionsRevokeAll,
+			Outcome:  models.AuditOutcomeSuccess,
+			TargetId: userId,
+		})
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// AdminUserSessionsHandler godoc
+// @Summary user sessions
+// @Description active sessions of the user
+// @Id admin-user-sessions
+// @Tags admin
+// @Param Authorization header string true "bearer token"
+// @Param id path int true "user id"
+// @Produce json
+// @Success 200 {array} types.SessionResponse
+// @Failure 400 {object} fiber.Error
+// @Failure 500 {object} fiber.Error
+// @Router /admin/user/{id}/sessions [get]
+func AdminUserSessionsHandler(s models.SSOer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+		return sessionsResponse(ctx, s, int64(id), "")
+	}
+}
+
+// AdminUserSessionsRevokeAllHandler godoc
+// @Summary revoke user sessions
+// @Description revokes every session of the user
+// @Id admin-user-sessions-revoke-all
+// @Tags admin
+// @Param Authorization header string true "bearer token"
+// @Param id path int true "user id"
+// @Success 204
+// @Failure 400 {object} fiber.Error
+// @Failure 500 {object} fiber.Error
+// @Router /admin/user/{id}/sessions/revoke_all [post]
+func AdminUserSessionsRevokeAllHandler(s models.SSOer, eventService *event.Service) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		id, err := ctx.ParamsInt("id")
+		if err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+		if err = endUserSessions(ctx, s, eventService, int64(id)); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionSessionsRevokeAll,
+			Outcome:  models.AuditOutcomeSuccess,
+			TargetId: int64(id),
+		})
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// AdminSessionRevokeHandler godoc
+// @Summary revoke session
+// @Description revokes the session
+// @Id admin-session-revoke
+// @Tags admin
+// @Param Authorization header string true "bearer token"
+// @Param params body types.SessionRevokeRequest true "request body"
+// @Accept json
+// @Success 204
+// @Failure 404 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /admin/session/revoke [post]
+func AdminSessionRevokeHandler(s models.SSOer, validator *internal.ServiceValidator, eventService *event.Service) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		params := &types.SessionRevokeRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		session, err := s.SessionManager().BySid(ctx.UserContext(), params.Sid)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if session == nil || session.Revoked {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+		if _, err = endSession(ctx, s, eventService, session); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:      models.AuditActionSessionRevoke,
+			Outcome:     models.AuditOutcomeSuccess,
+			TargetId:    session.UserId,
+			Application: session.ClientId,
+			Detail:      session.Sid,
+		})
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+func sessionsResponse(ctx *fiber.Ctx, s models.SSOer, userId int64, currentSid string) error {
+	sessions, err := s.SessionManager().ByUser(ctx.UserContext(), userId)
+	if err != nil {
+		return HttpError(ctx, fiber.StatusInternalServerError, err)
+	}
+	out := make([]types.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		out = append(out, types.SessionResponse{
+			Sid:       session.Sid,
+			ClientId:  session.ClientId,
+			Ip:        session.Ip,
+			UserAgent: session.UserAgent,
+			Created:   session.Created,
+			LastSeen:  session.LastSeen,
+			ExpiresAt: session.ExpiresAt,
+			Current:   session.Sid == currentSid,
+		})
+	}
+	return ctx.Status(fiber.StatusOK).JSON(out)
+}
+
+// startSession records the login of the user to the application, mfa tells the second factor was verified.
+func startSession(ctx *fiber.Ctx, s models.SSOer, user *models.UserModel, clientId string, validFor time.Duration, mfa bool) (*models.SessionModel, error) {
+	sid, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	session := &models.SessionModel{
+		Sid:       sid.String(),
+		UserId:    user.Id,
+		ClientId:  clientId,
+		Ip:        clientIp(ctx),
+		UserAgent: truncate(ctx.Get(fiber.HeaderUserAgent), 255),
+		Mfa:       mfa,
+		ExpiresAt: time.Now().Add(validFor).Unix(),
+	}
+	if err = s.SessionManager().Create(ctx.UserContext(), session); err != nil {
+		return nil, err
+	}
+	if err = joinSession(ctx.UserContext(), s, session, clientId); err != nil {
+		return nil, err
+	}
+
+	item := &models.AuditModel{
+		Action:      models.AuditActionLogin,
+		Outcome:     models.AuditOutcomeSuccess,
+		ActorId:     user.Id,
+		TargetId:    user.Id,
+		Subject:     user.Email,
+		Application: clientId,
+	}
+	if mfa {
+		item.Detail = "mfa"
+	}
+	audit(ctx, s, item)
+	return session, nil
+}
+
+// joinSession records the application participation in the session, so it gets notified on logout.
+func joinSession(ctx context.Context, s models.SSOer, session *models.SessionModel, clientId string) error {
+	return s.SessionClientManager().Add(ctx, &models.SessionClientModel{
+		Sid:      session.Sid,
+		ClientId: clientId,
+	})
+}
+
+// endSession revokes the session and notifies its applications via back-channel,
+// front-channel logout urls the browser has to load are returned.
+func endSession(ctx *fiber.Ctx, s models.SSOer, eventService *event.Service, session *models.SessionModel) ([]string, error) {
+	if _, err := s.SessionManager().Revoke(ctx.UserContext(), session.Sid); err != nil {
+		return nil, err
+	}
+	clients, err := s.SessionClientManager().BySid(ctx.UserContext(), session.Sid)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := OpenIdIssuer(ctx, s)
+	logout := &event.SessionLogout{
+		Issuer:  issuer,
+		Subject: strconv.FormatInt(session.UserId, 10),
+		Sid:     session.Sid,
+	}
+	var frontchannelUrls []string
+	for _, client := range clients {
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), client.ClientId)
+		if err != nil {
+			return nil, err
+		}
+		if app == nil {
+			continue
+		}
+		if app.BackchannelLogoutUrl != "" {
+			logout.Clients = append(logout.Clients, event.SessionLogoutClient{
+				ClientId:             app.Code,
+				BackchannelLogoutUrl: app.BackchannelLogoutUrl,
+			})
+		}
+		if app.FrontchannelLogoutUrl != "" {
+			location, err := url.Parse(app.FrontchannelLogoutUrl)
+			if err != nil {
+				continue
+			}
+			q := location.Query()
+			q.Set("iss", issuer)
+			q.Set("sid", session.Sid)
+			location.RawQuery = q.Encode()
+			frontchannelUrls = append(frontchannelUrls, location.String())
+		}
+	}
+	if len(logout.Clients) > 0 {
+		eventService.Emit(logout)
+	}
+	return frontchannelUrls, nil
+}
+
+// endUserSessions ends every active session of the user.
+func endUserSessions(ctx *fiber.Ctx, s models.SSOer, eventService *event.Service, userId int64) error {
+	sessions, err := s.SessionManager().ByUser(ctx.UserContext(), userId)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if _, err = endSession(ctx, s, eventService, session); err != nil {
+			return err
+		}
+	}
+	_, err = s.SessionManager().RevokeByUser(ctx.UserContext(), userId)
+	return err
+}
+
+// checkSession returns the session if it is still active, last seen time is updated at most once per interval.
+func checkSession(ctx context.Context, s models.SSOer, sid string) (*models.SessionModel, error) {
+	if sid == "" {
+		return nil, errSessionRevoked
+	}
+	session, err := s.SessionManager().BySid(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if session == nil || !session.IsActive(now) {
+		return nil, errSessionRevoked
+	}
+	if now-session.LastSeen > sessionTouchInterval {
+		if err = s.SessionManager().Touch(ctx, session); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// checkAudience verifies the application the access token is issued for has joined the session of the token.
+func checkAudience(ctx context.Context, s models.SSOer, claims *internal.SignInClaims) error {
+	if claims.Audience == "" {
+		return errAudience
+	}
+	clients, err := s.SessionClientManager().BySid(ctx, claims.SessionId)
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if client.ClientId == claims.Audience {
+			return nil
+		}
+	}
+	return errAudience
+}
+
+// currentSession returns the active session of the sso cookie along with its user, nils are returned when
+// the browser has no cookie or the session is no longer usable. The session is not reused either when it lacks
+// the second factor the user or the role of the user requires, or when the password of the user has expired,
+// the user has to go through the form then.
+func currentSession(ctx *fiber.Ctx, config *internal.Config, s models.SSOer) (*models.SessionModel, *models.UserModel, error) {
+	tokenString := ctx.Cookies(s.CookieName())
+	if tokenString == "" {
+		return nil, nil, nil
+	}
+	claims, err := ParseSessionToken(config, tokenString)
+	if err != nil {
+		return nil, nil, nil
+	}
+	session, err := checkSession(ctx.UserContext(), s, claims.SessionId)
+	if err == errSessionRevoked {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := s.UserManager().ById(ctx.UserContext(), session.UserId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || !user.Active || user.Locked || user.LockedTo > time.Now().Unix() {
+		return nil, nil, nil
+	}
+	if (user.MfaEnabled || s.MfaRequired(strings.Split(user.Role, ","))) && !session.Mfa {
+		return nil, nil, nil
+	}
+	if passwordExpired(s, user) {
+		return nil, nil, nil
+	}
+	return session, user, nil
+}
+
+// setSessionCookie sets the token of the session as the sso cookie, the token is only good for the next login.
+func setSessionCookie(ctx *fiber.Ctx, s models.SSOer, user *models.UserModel, session *models.SessionModel) error {
+	exp := time.Unix(session.ExpiresAt, 0).UTC()
+	token, err := s.BuildSessionToken(user.Id, session.Sid, exp)
+	if err != nil {
+		return err
+	}
+	addCookie(ctx, s.BuildCookie(token, exp, s.CookieDomain()))
+	return nil
+}
+
+// setApplicationCookie sets the access token of the application bound to the session on the application domain.
+func setApplicationCookie(ctx *fiber.Ctx, s models.SSOer, user *models.UserModel, session *models.SessionModel, app *models.ApplicationModel) error {
+	exp := time.Unix(session.ExpiresAt, 0).UTC()
+	token, err := s.BuildJWTToken(user.Id, strings.Split(user.Role, ","), session.Sid, app.Code, "", exp)
+	if err != nil {
+		return err
+	}
+	cookie := s.BuildCookie(token, exp, app.Domain)
+	cookie.Name = applicationCookieName(s, app)
+	addCookie(ctx, cookie)
+	return nil
+}
+
+// applicationCookieName returns the name of the access token cookie of the application, the application sharing the
+// sso domain gets the name suffixed with its code next to the sso cookie.
+func applicationCookieName(s models.SSOer, app *models.ApplicationModel) string {
+	if app.Domain == s.CookieDomain() {
+		return s.CookieName() + "_" + app.Code
+	}
+	return s.CookieName()
+}
+
+// addCookie sets the cookie along with the one of the same name set for another domain, ctx.Cookie would replace it.
+func addCookie(ctx *fiber.Ctx, cookie *fiber.Cookie) {
+	previous := string(ctx.Response().Header.PeekCookie(cookie.Name))
+	ctx.Cookie(cookie)
+	if previous != "" {
+		ctx.Response().Header.Add(fiber.HeaderSetCookie, previous)
+	}
+}
+
+// setSessionCookies sets app scoped token cookie on the application domain and the session cookie of the sso on
+// the sso domain, so the next login of any application could reuse the session. The session cookie is never
+// accepted as the token of an application.
+func setSessionCookies(ctx *fiber.Ctx, s models.SSOer, user *models.UserModel, session *models.SessionModel, app *models.ApplicationModel) error {
+	if err := joinSession(ctx.UserContext(), s, session, app.Code); err != nil {
+		return err
+	}
+	if err := setApplicationCookie(ctx, s, user, session, app); err != nil {
+		return err
+	}
+	return setSessionCookie(ctx, s, user, session)
+}
+
+// truncate cuts the value to at most n bytes at the rune boundary, so the stored text stays valid utf-8.
+func truncate(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n]
+}
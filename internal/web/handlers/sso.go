@@ -1,8 +1,8 @@
 package handlers
 
 import (
+	"context"
 	"errors"
-	"strings"
 	"time"
 
 	"github.com/MiG-21/go-sso/internal"
@@ -24,11 +24,13 @@ import (
 // @Accept json
 // @Produce json
 // @Success 200 {object} types.UserTokenResponse
+// @Success 202 {object} types.MfaChallengeResponse
 // @Failure 400 {object} fiber.Error
 // @Failure 401 {object} fiber.Error
 // @Failure 422 {object} fiber.Error
+// @Failure 429 {object} fiber.Error
 // @Router /auth_token [post]
-func AuthTokenHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+func AuthTokenHandler(s models.SSOer, validator *internal.ServiceValidator, eventService *event.Service) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		ctx.Set("Content-Type", "application/json")
 		params := &types.AuthRequest{}
@@ -41,67 +43,139 @@ func AuthTokenHandler(s models.SSOer, validator *internal.ServiceValidator) func
 			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
 		}
 
-		if app, err := s.ApplicationManager().ByCode(params.Code); err != nil || app == nil {
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), params.Code)
+		if err != nil || app == nil {
 			return HttpError(ctx, fiber.StatusBadRequest, err)
 		}
 
-		item, err := s.UserManager().Authenticate(params.Email, params.Password)
-		if err != nil {
+		item, err := authenticate(ctx, s, eventService, params.Code, params.Email, params.Password)
+		if err == models.ErrInvalidCredentials {
+			return HttpError(ctx, fiber.StatusUnauthorized, err)
+		} else if err == errTooManyAttempts {
+			return fiber.NewError(fiber.StatusTooManyRequests, err.Error())
+		} else if err != nil {
 			return HttpError(ctx, fiber.StatusBadRequest, err)
 		}
 		if item == nil {
 			return HttpError(ctx, fiber.StatusUnauthorized, err)
 		}
-		exp := time.Now().Add(time.Hour * time.Duration(s.CTValidHours())).UTC()
-		token, _ := s.BuildJWTToken(item.Id, strings.Split(item.Role, ","), exp)
-		out := types.UserTokenResponse{Token: token}
-		return ctx.Status(fiber.StatusOK).JSON(out)
+		if item.MfaEnabled {
+			mfaToken, expiresIn, err := mfaChallenge(s, item)
+			if err != nil {
+				return HttpError(ctx, fiber.StatusInternalServerError, err)
+			}
+			out := types.MfaChallengeResponse{
+				MfaRequired: true,
+				MfaToken:    mfaToken,
+				ExpiresIn:   expiresIn,
+			}
+			return ctx.Status(fiber.StatusAccepted).JSON(out)
+		}
+		return userTokenResponse(ctx, s, item, app, false)
 	}
 }
 
-func AuthCookieHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+// userTokenResponse starts the session of the user and responds with the access and refresh tokens.
+func userTokenResponse(ctx *fiber.Ctx, s models.SSOer, user *models.UserModel, app *models.ApplicationModel, mfa bool) error {
+	session, err := startSession(ctx, s, user, app.Code, time.Hour*time.Duration(s.RefreshTokenValidHours()), mfa)
+	if err != nil {
+		return HttpError(ctx, fiber.StatusInternalServerError, err)
+	}
+	token, expiresIn, err := buildAccessToken(s, user, session.Sid, app.Code, "")
+	if err != nil {
+		return HttpError(ctx, fiber.StatusInternalServerError, err)
+	}
+	refreshToken, err := issueRefreshToken(ctx.UserContext(), s, user, app.Code, "", session.Sid, nil)
+	if err != nil {
+		return HttpError(ctx, fiber.StatusInternalServerError, err)
+	}
+	out := types.UserTokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    expiresIn,
+	}
+	return ctx.Status(fiber.StatusOK).JSON(out)
+}
+
+// AuthCookieHandler signs the user in with the password, users with an expired password are sent to change it
+// instead of getting the cookie.
+func AuthCookieHandler(config *internal.Config, s models.SSOer, validator *internal.ServiceValidator, eventService *event.Service) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		params := &types.AuthRequest{}
 		if err := ctx.BodyParser(params); err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 
 		validationErrors := HandleValidation(validator.Validate(params))
 		if validationErrors != nil {
-			data := views.LoginFormViewData(params.Code, ValidationErrorsToErrors(validationErrors)...)
+			data := views.LoginFormViewData(ctx, params.Code, params.RedirectRequest, ValidationErrorsToErrors(validationErrors)...)
 			return ctx.Render("login_form", data, "layout")
 		}
 
-		app, err := s.ApplicationManager().ByCode(params.Code)
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), params.Code)
 		if err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
-		item, err := s.UserManager().Authenticate(params.Email, params.Password)
-		if err != nil {
-			data := views.ErrorViewData(fiber.StatusUnauthorized, err.Error())
+		if app == nil {
+			data := views.ErrorViewData(fiber.StatusBadRequest, "unknown application")
 			return ctx.Render("error", data, "layout")
 		}
+		if _, err = loginRedirectUrl(app, params.RedirectRequest); err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+		item, err := authenticate(ctx, s, eventService, params.Code, params.Email, params.Password)
+		if err == models.ErrInvalidCredentials {
+			data := views.LoginFormViewData(ctx, params.Code, params.RedirectRequest, errors.New("email or password is incorrect"))
+			return ctx.Render("login_form", data, "layout")
+		} else if err == errTooManyAttempts {
+			return errorPage(ctx, fiber.StatusTooManyRequests, err)
+		} else if err != nil {
+			return errorPage(ctx, fiber.StatusUnauthorized, err)
+		}
 		if item == nil {
-			data := views.LoginFormViewData(params.Code, errors.New("email or password is incorrect"))
+			data := views.LoginFormViewData(ctx, params.Code, params.RedirectRequest, errors.New("email or password is incorrect"))
 			return ctx.Render("login_form", data, "layout")
 		}
-		exp := time.Now().Add(time.Hour * time.Duration(s.CTValidHours())).UTC()
-		token, _ := s.BuildJWTToken(item.Id, strings.Split(item.Role, ","), exp)
-		cookie := s.BuildCookie(token, exp, app.Domain)
-		ctx.Cookie(cookie)
+		if item.MfaEnabled {
+			mfaToken, _, err := mfaChallenge(s, item)
+			if err != nil {
+				return errorPage(ctx, fiber.StatusInternalServerError, err)
+			}
+			data := views.LoginMfaFormViewData(ctx, app.Code, params.RedirectRequest, mfaToken)
+			return ctx.Render("mfa_form", data, "layout")
+		}
+		if passwordExpired(s, item) {
+			return expiredPasswordRedirect(ctx, config, s, item)
+		}
+		return cookieLogin(ctx, s, item, app, params.RedirectRequest, false)
+	}
+}
 
-		return ctx.Redirect(app.RedirectUrl, fiber.StatusFound)
+// cookieLogin starts the session of the user, sets the session cookies and redirects to the application.
+func cookieLogin(ctx *fiber.Ctx, s models.SSOer, user *models.UserModel, app *models.ApplicationModel, redirect types.RedirectRequest, mfa bool) error {
+	redirectUrl, err := loginRedirectUrl(app, redirect)
+	if err != nil {
+		return errorPage(ctx, fiber.StatusBadRequest, err)
+	}
+	session, err := startSession(ctx, s, user, app.Code, time.Hour*time.Duration(s.CTValidHours()), mfa)
+	if err != nil {
+		return errorPage(ctx, fiber.StatusInternalServerError, err)
 	}
+	if err = setSessionCookies(ctx, s, user, session, app); err != nil {
+		return errorPage(ctx, fiber.StatusInternalServerError, err)
+	}
+
+	return ctx.Redirect(redirectUrl, fiber.StatusFound)
 }
 
-func LoginFormHandler(validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+// LoginFormHandler renders login form, if the browser already has an active sso session the form is skipped
+// and the user is redirected to the application with a fresh app scoped token, prompt=login forces the form.
+// The user returns to redirect_uri when it is registered for the application.
+func LoginFormHandler(config *internal.Config, s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		params := &types.LoginLogoutRequest{}
 		if err := ctx.QueryParser(params); err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 
 		validationErrors := HandleValidation(validator.Validate(params))
@@ -110,17 +184,45 @@ func LoginFormHandler(validator *internal.ServiceValidator) func(ctx *fiber.Ctx)
 			return ctx.Render("error", data, "layout")
 		}
 
-		data := views.LoginFormViewData(params.Code)
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), params.Code)
+		if err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+		if app == nil {
+			data := views.ErrorViewData(fiber.StatusBadRequest, "unknown application")
+			return ctx.Render("error", data, "layout")
+		}
+		redirectUrl, err := loginRedirectUrl(app, params.RedirectRequest)
+		if err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+
+		if params.Prompt != PromptLogin {
+			session, user, err := currentSession(ctx, config, s)
+			if err != nil {
+				return errorPage(ctx, fiber.StatusInternalServerError, err)
+			}
+			if session != nil {
+				if err = setSessionCookies(ctx, s, user, session, app); err != nil {
+					return errorPage(ctx, fiber.StatusInternalServerError, err)
+				}
+				return ctx.Redirect(redirectUrl, fiber.StatusFound)
+			}
+		}
+
+		data := views.LoginFormViewData(ctx, params.Code, params.RedirectRequest)
 		return ctx.Render("login_form", data, "layout")
 	}
 }
 
-func LogoutHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+// LogoutHandler ends the sso session, applications participated in it are notified via back-channel
+// and front-channel logout, then the user is redirected to the login form or to the requested redirect_uri
+// registered as post logout redirect uri of the application.
+func LogoutHandler(config *internal.Config, s models.SSOer, validator *internal.ServiceValidator, eventService *event.Service) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		params := &types.LoginLogoutRequest{}
 		if err := ctx.QueryParser(params); err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 
 		validationErrors := HandleValidation(validator.Validate(params))
@@ -128,15 +230,50 @@ func LogoutHandler(s models.SSOer, validator *internal.ServiceValidator) func(ct
 			data := views.ErrorViewData(fiber.StatusUnprocessableEntity, validationErrors[0].Error())
 			return ctx.Render("error", data, "layout")
 		}
-		app, err := s.ApplicationManager().ByCode(params.Code)
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), params.Code)
 		if err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+		if app == nil {
+			data := views.ErrorViewData(fiber.StatusBadRequest, "unknown application")
 			return ctx.Render("error", data, "layout")
 		}
+		redirectUrl, err := logoutRedirectUrl(app, params.RedirectRequest)
+		if err != nil {
+			return errorPage(ctx, fiber.StatusBadRequest, err)
+		}
+
+		// the token itself stays valid until exp, so the session it is bound to has to be revoked
+		var frontchannelUrls []string
+		if claims, err := ParseSessionToken(config, ctx.Cookies(s.CookieName())); err == nil {
+			session, err := s.SessionManager().BySid(ctx.UserContext(), claims.SessionId)
+			if err == nil && session != nil && !session.Revoked {
+				frontchannelUrls, err = endSession(ctx, s, eventService, session)
+			}
+			if err != nil {
+				return errorPage(ctx, fiber.StatusInternalServerError, err)
+			}
+			audit(ctx, s, &models.AuditModel{
+				Action:      models.AuditActionLogout,
+				Outcome:     models.AuditOutcomeSuccess,
+				ActorId:     claims.Id,
+				TargetId:    claims.Id,
+				Application: app.Code,
+				Detail:      claims.SessionId,
+			})
+		}
+
 		exp := time.Now().Add(time.Hour * time.Duration(-1))
 		cookie := s.Logout(exp, app.Domain)
-		ctx.Cookie(cookie)
-		return ctx.Redirect("/login", fiber.StatusFound)
+		cookie.Name = applicationCookieName(s, app)
+		addCookie(ctx, cookie)
+		addCookie(ctx, s.Logout(exp, s.CookieDomain()))
+
+		if len(frontchannelUrls) == 0 {
+			return ctx.Redirect(redirectUrl, fiber.StatusFound)
+		}
+		data := views.LogoutViewData(frontchannelUrls, redirectUrl)
+		return ctx.Render("logout", data, "layout")
 	}
 }
 
@@ -144,8 +281,7 @@ func VerificationHandler(config *internal.Config, s models.SSOer, validator *int
 	return func(ctx *fiber.Ctx) error {
 		params := &types.UserVerificationRequest{}
 		if err := ctx.QueryParser(params); err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 
 		validationErrors := HandleValidation(validator.Validate(params))
@@ -154,14 +290,9 @@ func VerificationHandler(config *internal.Config, s models.SSOer, validator *int
 			return ctx.Render("error", data, "layout")
 		}
 
-		parsedToken, err := jwt.ParseWithClaims(params.Token, &internal.VerificationClaims{}, func(token *jwt.Token) (interface{}, error) {
-			// since we only use the one private key to sign the tokens,
-			// we also only use its public counterpart to verify
-			return config.Crypto.PublicKey, nil
-		})
+		parsedToken, err := jwt.ParseWithClaims(params.Token, &internal.VerificationClaims{}, config.Crypto.KeyRing.Keyfunc)
 		if err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 
 		claims, ok := parsedToken.Claims.(*internal.VerificationClaims)
@@ -170,10 +301,9 @@ func VerificationHandler(config *internal.Config, s models.SSOer, validator *int
 			return ctx.Render("error", data, "layout")
 		}
 
-		user, err := s.UserManager().ByCode(claims.Id)
+		user, err := s.UserManager().ByCode(ctx.UserContext(), claims.Id)
 		if err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 		if user == nil {
 			data := views.ErrorViewData(fiber.StatusBadRequest, "invalid verification token")
@@ -182,12 +312,23 @@ func VerificationHandler(config *internal.Config, s models.SSOer, validator *int
 
 		user.Code = ""
 		user.Active = true
-		rows, err := s.UserManager().Update(user)
-		if err != nil || rows == 0 {
+		rows, err := s.UserManager().Update(ctx.UserContext(), user)
+		if err != nil {
+			return errorPage(ctx, fiber.StatusInternalServerError, err)
+		}
+		if rows == 0 {
 			data := views.ErrorViewData(fiber.StatusBadRequest, "failed to activate user")
 			return ctx.Render("error", data, "layout")
 		}
 
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionVerification,
+			Outcome:  models.AuditOutcomeSuccess,
+			ActorId:  user.Id,
+			TargetId: user.Id,
+			Subject:  user.Email,
+		})
+
 		return ctx.Redirect("/verified", fiber.StatusFound)
 	}
 }
@@ -205,7 +346,7 @@ func VerifiedHandler() func(ctx *fiber.Ctx) error {
 
 func PasswordRecoverFormHandler() func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
-		return ctx.Render("password_recover_form", nil, "layout")
+		return ctx.Render("password_recover_form", views.PasswordRecoverEmailFormViewData(ctx, ctx.Query("code")), "layout")
 	}
 }
 
@@ -213,8 +354,7 @@ func PasswordRecoverHandler(config *internal.Config, s models.SSOer, validator *
 	return func(ctx *fiber.Ctx) error {
 		params := &types.PasswordRecoverRequest{}
 		if err := ctx.BodyParser(params); err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 
 		validationErrors := HandleValidation(validator.Validate(params))
@@ -222,33 +362,46 @@ func PasswordRecoverHandler(config *internal.Config, s models.SSOer, validator *
 			data := views.ErrorViewData(fiber.StatusUnprocessableEntity, validationErrors[0].Error())
 			return ctx.Render("error", data, "layout")
 		}
-		user, err := s.UserManager().ByEmail(params.Email)
+		// the email is sent only once the new code is committed
+		var user *models.UserModel
+		err := s.Transaction(ctx.UserContext(), func(tx context.Context) (err error) {
+			if user, err = s.UserManager().ByEmail(tx, params.Email); err != nil || user == nil {
+				return err
+			}
+			rand, err := uuid.NewRandom()
+			if err != nil {
+				return err
+			}
+			user.Code = rand.String()
+			_, err = s.UserManager().Update(tx, user)
+			return err
+		})
 		if err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 		if user == nil {
+			auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionPasswordRecover, Subject: params.Email}, errors.New("unknown email"))
 			data := views.ErrorViewData(fiber.StatusBadRequest, "invalid verification token")
 			return ctx.Render("error", data, "layout")
 		}
 
-		rand, err := uuid.NewRandom()
-		if err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
-		}
-		user.Code = rand.String()
-		_, err = s.UserManager().Update(user)
+		base, err := publicUrl(ctx, s, params.Code)
 		if err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
 		}
-
-		vUrl, err := user.GetActionUrl(ctx, "/password/change", models.UserActionPasswordRecover, config.Crypto.PrivateKey)
+		vUrl, err := user.GetActionUrl(base, "/password/change", models.UserActionPasswordRecover, config.Crypto.KeyRing.Active())
 		if err != nil {
 			return HttpError(ctx, fiber.StatusInternalServerError, err)
 		}
 
+		audit(ctx, s, &models.AuditModel{
+			Action:      models.AuditActionPasswordRecover,
+			Outcome:     models.AuditOutcomeSuccess,
+			TargetId:    user.Id,
+			Subject:     user.Email,
+			Application: params.Code,
+		})
+
 		// emit event
 		eventService.Emit(&event.UserPasswordRecover{
 			UserName:        user.Name,
@@ -275,8 +428,7 @@ func PasswordChangeFormHandler(config *internal.Config, validator *internal.Serv
 	return func(ctx *fiber.Ctx) error {
 		params := &types.UserVerificationRequest{}
 		if err := ctx.QueryParser(params); err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 
 		validationErrors := HandleValidation(validator.Validate(params))
@@ -285,58 +437,102 @@ func PasswordChangeFormHandler(config *internal.Config, validator *internal.Serv
 			return ctx.Render("error", data, "layout")
 		}
 
-		parsedToken, err := jwt.ParseWithClaims(params.Token, &internal.VerificationClaims{}, func(token *jwt.Token) (interface{}, error) {
-			// since we only use the one private key to sign the tokens,
-			// we also only use its public counterpart to verify
-			return config.Crypto.PublicKey, nil
-		})
+		parsedToken, err := jwt.ParseWithClaims(params.Token, &internal.VerificationClaims{}, config.Crypto.KeyRing.Keyfunc)
 		if err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 
 		claims, ok := parsedToken.Claims.(*internal.VerificationClaims)
-		if !ok || !parsedToken.Valid || claims.Action != models.UserActionPasswordRecover {
+		if !ok || !parsedToken.Valid {
+			data := views.ErrorViewData(fiber.StatusBadRequest, "invalid verification token")
+			return ctx.Render("error", data, "layout")
+		}
+		switch claims.Action {
+		case models.UserActionPasswordRecover:
+			data := views.PasswordRecoverFormViewData(ctx, claims.Id)
+			return ctx.Render("password_change_form", data, "layout")
+		case models.UserActionPasswordExpired:
+			data := views.PasswordRecoverFormViewData(ctx, claims.Id, errors.New("your password has expired, please choose a new one"))
+			return ctx.Render("password_change_form", data, "layout")
+		default:
 			data := views.ErrorViewData(fiber.StatusBadRequest, "invalid verification token")
 			return ctx.Render("error", data, "layout")
 		}
-		data := views.PasswordRecoverFormViewData(claims.Id)
-		return ctx.Render("password_change_form", data, "layout")
 	}
 }
 
+// PasswordChangeHandler sets the recovered or expired password, the user is not signed in, so the second factor is
+// still required at the next login. The current and the remembered previous passwords cannot be reused.
 func PasswordChangeHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		params := &types.PasswordChangeRequest{}
 		if err := ctx.BodyParser(params); err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 
 		validationErrors := HandleValidation(validator.Validate(params))
 		if validationErrors != nil {
-			data := views.PasswordRecoverFormViewData(params.Code, ValidationErrorsToErrors(validationErrors)...)
+			data := views.PasswordRecoverFormViewData(ctx, params.Code, ValidationErrorsToErrors(validationErrors)...)
 			return ctx.Render("password_change_form", data, "layout")
 		}
 
-		user, err := s.UserManager().ByCode(params.Code)
+		user, err := s.UserManager().ByCode(ctx.UserContext(), params.Code)
 		if err != nil {
-			data := views.ErrorViewData(fiber.StatusBadRequest, err.Error())
-			return ctx.Render("error", data, "layout")
+			return errorPage(ctx, fiber.StatusBadRequest, err)
 		}
 		if user == nil {
 			data := views.ErrorViewData(fiber.StatusBadRequest, "invalid verification token")
 			return ctx.Render("error", data, "layout")
 		}
+		validationErrors, err = checkPassword(s, "PasswordChangeRequest.Password", params.Password, user.Email, user.Name)
+		if err != nil {
+			return errorPage(ctx, fiber.StatusInternalServerError, err)
+		}
+		if validationErrors != nil {
+			data := views.PasswordRecoverFormViewData(ctx, params.Code, ValidationErrorsToErrors(validationErrors)...)
+			return ctx.Render("password_change_form", data, "layout")
+		}
+		reused, err := passwordReused(ctx.UserContext(), s, user, params.Password)
+		if err != nil {
+			return errorPage(ctx, fiber.StatusInternalServerError, err)
+		}
+		if reused {
+			validationErrors = []*ValidationError{{Field: "PasswordChangeRequest.Password", Tag: internal.PasswordViolationReused}}
+			data := views.PasswordRecoverFormViewData(ctx, params.Code, ValidationErrorsToErrors(validationErrors)...)
+			return ctx.Render("password_change_form", data, "layout")
+		}
+
+		hash, err := s.PasswordHasher().Hash(params.Password)
+		if err != nil {
+			return errorPage(ctx, fiber.StatusInternalServerError, err)
+		}
 
+		previous := user.Password
 		user.Code = ""
-		user.Password = internal.GetPasswordHash([]byte(params.Password))
-		rows, err := s.UserManager().Update(user)
-		if err != nil || rows == 0 {
+		user.Password = hash
+		user.PasswordChanged = time.Now().Unix()
+		var rows int64
+		err = s.Transaction(ctx.UserContext(), func(tx context.Context) (err error) {
+			if rows, err = s.UserManager().Update(tx, user); err != nil || rows == 0 {
+				return err
+			}
+			return rememberPassword(tx, s, user.Id, previous)
+		})
+		if err != nil {
+			return errorPage(ctx, fiber.StatusInternalServerError, err)
+		}
+		if rows == 0 {
 			data := views.ErrorViewData(fiber.StatusBadRequest, "failed to change password")
 			return ctx.Render("error", data, "layout")
 		}
 
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionPasswordChange,
+			Outcome:  models.AuditOutcomeSuccess,
+			ActorId:  user.Id,
+			TargetId: user.Id,
+			Subject:  user.Email,
+		})
 		return ctx.Redirect("/login", fiber.StatusFound)
 	}
 }
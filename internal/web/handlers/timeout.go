@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestTimeout bounds the storage access of the request, the handlers pass ctx.UserContext() to the managers
+// so the queries are canceled once the deadline passes or the request ends, zero disables the deadline.
+func RequestTimeout(timeout time.Duration) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if timeout <= 0 {
+			return ctx.Next()
+		}
+		c, cancel := context.WithTimeout(ctx.UserContext(), timeout)
+		defer cancel()
+		ctx.SetUserContext(c)
+		return ctx.Next()
+	}
+}
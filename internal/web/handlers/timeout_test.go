@@ -0,0 +1,105 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/handlers"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/template/html"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type (
+	// stalledApplications answers like the storage which does not respond before the deadline of the request,
+	// or fails with err right away when it is set
+	stalledApplications struct {
+		models.ApplicationManager
+		err error
+	}
+
+	stalledStorage struct {
+		models.SSOer
+		applications *stalledApplications
+	}
+)
+
+func (m *stalledApplications) ByCode(ctx context.Context, _ string) (*models.ApplicationModel, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	<-ctx.Done()
+	return nil, fmt.Errorf("%w: %v", models.ErrTimeout, ctx.Err())
+}
+
+func (s *stalledStorage) ApplicationManager() models.ApplicationManager {
+	return s.applications
+}
+
+var _ = Describe("RequestTimeout", func() {
+	var (
+		storage    *stalledStorage
+		timeoutApp *fiber.App
+	)
+
+	BeforeEach(func() {
+		storage = &stalledStorage{applications: &stalledApplications{}}
+		validator := internal.SetupValidator()
+		timeoutApp = fiber.New(fiber.Config{
+			Views:                 html.New("../../../web/template/sso/", ".html"),
+			DisableStartupMessage: true,
+		})
+		timeoutApp.Use(handlers.RequestTimeout(50 * time.Millisecond))
+		timeoutApp.Get("/login", handlers.LoginFormHandler(&internal.Config{}, storage, validator))
+		timeoutApp.Post("/oauth/token", handlers.TokenHandler(storage, validator))
+	})
+
+	token := func() *http.Response {
+		form := url.Values{"grant_type": {internal.GrantTypeAuthorizationCode}, "client_id": {"app"}}
+		req := httptest.NewRequest(fiber.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		resp, err := timeoutApp.Test(req, -1)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+
+	login := func() *http.Response {
+		resp, err := timeoutApp.Test(httptest.NewRequest(fiber.MethodGet, "/login?code=app", nil), -1)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+
+	It("answers 504 once the storage misses the deadline of the request", func() {
+		started := time.Now()
+		resp := token()
+		Expect(time.Since(started)).To(BeNumerically("<", time.Second))
+		Expect(resp.StatusCode).To(Equal(fiber.StatusGatewayTimeout))
+		out := types.OAuthErrorResponse{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		Expect(out.Error).To(Equal(handlers.OAuthErrTemporarilyUnavailable))
+
+		Expect(login().StatusCode).To(Equal(fiber.StatusGatewayTimeout))
+	})
+
+	It("answers 503 when the storage is unavailable", func() {
+		storage.applications.err = fmt.Errorf("%w: %v", models.ErrUnavailable, "connection refused")
+
+		resp := token()
+		Expect(resp.StatusCode).To(Equal(fiber.StatusServiceUnavailable))
+		out := types.OAuthErrorResponse{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		Expect(out.Error).To(Equal(handlers.OAuthErrTemporarilyUnavailable))
+
+		Expect(login().StatusCode).To(Equal(fiber.StatusServiceUnavailable))
+	})
+})
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"errors"
+	"time"
+
 	"github.com/MiG-21/go-sso/internal"
 	"github.com/MiG-21/go-sso/internal/event"
 	"github.com/MiG-21/go-sso/internal/models"
@@ -9,6 +12,10 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	errEmailTaken = errors.New("email already taken")
+)
+
 // UserInfoHandler godoc
 // @Summary user info
 // @Description user info
@@ -26,7 +33,7 @@ func UserInfoHandler(s models.SSOer) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		ctx.Set("Content-Type", "application/json")
 		claims := CtxClaims(ctx)
-		user, err := s.UserManager().ById(claims.Id)
+		user, err := s.UserManager().ById(ctx.UserContext(), claims.Id)
 		if err != nil {
 			return HttpError(ctx, fiber.StatusInternalServerError, err)
 		}
@@ -34,16 +41,17 @@ func UserInfoHandler(s models.SSOer) func(ctx *fiber.Ctx) error {
 			return fiber.NewError(fiber.StatusNotFound)
 		}
 		out := types.UserInfoResponse{
-			Id:       user.Id,
-			Name:     user.Name,
-			Email:    user.Email,
-			Gender:   user.Gender,
-			Data:     user.Data,
-			Created:  user.Created,
-			Updated:  user.Updated,
-			Active:   user.Active,
-			Locked:   user.Locked,
-			LockedTo: user.LockedTo,
+			Id:         user.Id,
+			Name:       user.Name,
+			Email:      user.Email,
+			Gender:     user.Gender,
+			Data:       user.Data,
+			Created:    user.Created,
+			Updated:    user.Updated,
+			Active:     user.Active,
+			Locked:     user.Locked,
+			LockedTo:   user.LockedTo,
+			MfaEnabled: user.MfaEnabled,
 		}
 		return ctx.Status(fiber.StatusOK).JSON(out)
 	}
@@ -68,31 +76,54 @@ func CreateUserHandler(config *internal.Config, s models.SSOer, validator *inter
 			return HttpError(ctx, fiber.StatusBadRequest, err)
 		}
 
-		errors := HandleValidation(validator.Validate(params))
-		if errors != nil {
-			return HttpError(ctx, fiber.StatusUnprocessableEntity, errors)
+		validationErrors := HandleValidation(validator.Validate(params))
+		passwordErrors, err := checkPassword(s, "UserCreateRequest.Password", params.Password, params.Email, params.Name)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		validationErrors = append(validationErrors, passwordErrors...)
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
 		}
 		rand, err := uuid.NewRandom()
 		if err != nil {
-			return HttpError(ctx, fiber.StatusInternalServerError, errors)
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
 		}
-		user := &models.UserModel{
-			Name:     params.Name,
-			Email:    params.Email,
-			Password: internal.GetPasswordHash([]byte(params.Password)),
-			Gender:   params.Gender,
-			Active:   false,
-			Locked:   false,
-			Code:     rand.String(),
+		hash, err := s.PasswordHasher().Hash(params.Password)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
 		}
-		if err = s.UserManager().Validate(user); err != nil {
-			return HttpError(ctx, fiber.StatusUnprocessableEntity, err)
+		user := &models.UserModel{
+			Name:            params.Name,
+			Email:           params.Email,
+			Password:        hash,
+			PasswordChanged: time.Now().Unix(),
+			Gender:          params.Gender,
+			Active:          false,
+			Locked:          false,
+			Code:            rand.String(),
 		}
-		if err = s.UserManager().Create(user); err != nil {
+		// the unique email index decides concurrent registrations
+		if err = s.UserManager().Create(ctx.UserContext(), user); errors.Is(err, models.ErrAlreadyExists) {
+			auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionRegister, Subject: user.Email, Application: params.Code}, errEmailTaken)
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, errEmailTaken)
+		} else if err != nil {
 			return HttpError(ctx, fiber.StatusInternalServerError, err)
 		}
 
-		vUrl, err := user.GetActionUrl(ctx, "/verification", models.UserActionActivation, config.Crypto.PrivateKey)
+		audit(ctx, s, &models.AuditModel{
+			Action:      models.AuditActionRegister,
+			Outcome:     models.AuditOutcomeSuccess,
+			TargetId:    user.Id,
+			Subject:     user.Email,
+			Application: params.Code,
+		})
+
+		base, err := publicUrl(ctx, s, params.Code)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		vUrl, err := user.GetActionUrl(base, "/verification", models.UserActionActivation, config.Crypto.KeyRing.Active())
 		if err != nil {
 			return HttpError(ctx, fiber.StatusInternalServerError, err)
 		}
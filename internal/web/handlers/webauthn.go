@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/passkey"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+)
+
+// WebAuthnRegisterBeginHandler godoc
+// @Summary begin passkey registration
+// @Description credential creation options for navigator.credentials.create
+// @Id webauthn-register-begin
+// @Tags mfa
+// @Param Authorization header string true "bearer token"
+// @Produce json
+// @Success 200 {object} protocol.CredentialCreation
+// @Failure 404 {object} fiber.Error
+// @Failure 500 {object} fiber.Error
+// @Router /user/webauthn/register/begin [post]
+func WebAuthnRegisterBeginHandler(s models.SSOer, passkeys *passkey.Service) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		user, err := s.UserManager().ById(ctx.UserContext(), CtxClaims(ctx).Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+
+		options, err := passkeys.BeginRegistration(ctx.UserContext(), user)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		ctx.Set("Cache-Control", "no-store")
+		return ctx.Status(fiber.StatusOK).JSON(options)
+	}
+}
+
+// WebAuthnRegisterFinishHandler godoc
+// @Summary finish passkey registration
+// @Description verifies the attestation returned by navigator.credentials.create and stores the passkey,
+// @Description a registered passkey enables two-factor authentication, recovery codes are returned when it was not enabled before
+// @Id webauthn-register-finish
+// @Tags mfa
+// @Param Authorization header string true "bearer token"
+// @Param name query string false "passkey name"
+// @Param params body object true "public key credential"
+// @Accept json
+// @Produce json
+// @Success 201 {object} types.WebAuthnCredentialResponse
+// @Failure 400 {object} fiber.Error
+// @Failure 404 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /user/webauthn/register/finish [post]
+func WebAuthnRegisterFinishHandler(s models.SSOer, passkeys *passkey.Service, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		ctx.Set("Content-Type", "application/json")
+		params := &types.WebAuthnRegisterFinishRequest{}
+		if err := ctx.QueryParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		user, err := s.UserManager().ById(ctx.UserContext(), CtxClaims(ctx).Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+
+		item, err := passkeys.FinishRegistration(ctx.UserContext(), user, params.Name, ctx.Body())
+		if err == passkey.ErrInvalidCredential {
+			auditFailure(ctx, s, &models.AuditModel{Action: models.AuditActionPasskeyRegister, TargetId: user.Id, Subject: user.Email}, err)
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		} else if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		codes, err := syncMfaEnabled(ctx.UserContext(), s, user)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionPasskeyRegister,
+			Outcome:  models.AuditOutcomeSuccess,
+			TargetId: user.Id,
+			Subject:  user.Email,
+			Detail:   item.Name,
+		})
+		out := webAuthnCredentialResponse(item)
+		out.RecoveryCodes = codes
+		return ctx.Status(fiber.StatusCreated).JSON(out)
+	}
+}
+
+// WebAuthnCredentialsHandler godoc
+// @Summary user passkeys
+// @Description passkeys registered by the current user
+// @Id webauthn-credentials
+// @Tags mfa
+// @Param Authorization header string true "bearer token"
+// @Produce json
+// @Success 200 {array} types.WebAuthnCredentialResponse
+// @Failure 500 {object} fiber.Error
+// @Router /user/webauthn/credentials [get]
+func WebAuthnCredentialsHandler(s models.SSOer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		items, err := s.WebAuthnCredentialManager().ByUser(ctx.UserContext(), CtxClaims(ctx).Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		out := make([]types.WebAuthnCredentialResponse, 0, len(items))
+		for _, item := range items {
+			out = append(out, webAuthnCredentialResponse(item))
+		}
+		return ctx.Status(fiber.StatusOK).JSON(out)
+	}
+}
+
+// WebAuthnCredentialDeleteHandler godoc
+// @Summary delete passkey
+// @Description removes one of the current user passkeys, two-factor authentication is disabled with the last one
+// @Description unless an authenticator app is enabled
+// @Id webauthn-credential-delete
+// @Tags mfa
+// @Param Authorization header string true "bearer token"
+// @Param params body types.WebAuthnCredentialDeleteRequest true "request body"
+// @Accept json
+// @Produce json
+// @Success 204
+// @Failure 404 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /user/webauthn/credentials/delete [post]
+func WebAuthnCredentialDeleteHandler(s models.SSOer, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		ctx.Set("Content-Type", "application/json")
+		params := &types.WebAuthnCredentialDeleteRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		user, err := s.UserManager().ById(ctx.UserContext(), CtxClaims(ctx).Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+
+		count, err := s.WebAuthnCredentialManager().Delete(ctx.UserContext(), user.Id, params.Id)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if count == 0 {
+			return fiber.NewError(fiber.StatusNotFound)
+		}
+		if _, err = syncMfaEnabled(ctx.UserContext(), s, user); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		audit(ctx, s, &models.AuditModel{
+			Action:   models.AuditActionPasskeyDelete,
+			Outcome:  models.AuditOutcomeSuccess,
+			TargetId: user.Id,
+			Subject:  user.Email,
+			Detail:   strconv.FormatInt(params.Id, 10),
+		})
+		return ctx.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// WebAuthnLoginBeginHandler godoc
+// @Summary begin passkey login
+// @Description credential request options for navigator.credentials.get, with mfa_token the passkey is checked
+// @Description as the second factor, otherwise it signs the user in without a password
+// @Id webauthn-login-begin
+// @Tags sso
+// @Param params body types.WebAuthnLoginBeginRequest true "request body"
+// @Accept json
+// @Produce json
+// @Success 200 {object} protocol.CredentialAssertion
+// @Failure 400 {object} fiber.Error
+// @Failure 401 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /auth_token/webauthn/begin [post]
+func WebAuthnLoginBeginHandler(config *internal.Config, s models.SSOer, passkeys *passkey.Service, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		ctx.Set("Content-Type", "application/json")
+		params := &types.WebAuthnLoginBeginRequest{}
+		if err := ctx.BodyParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		var user *models.UserModel
+		var err error
+		ceremony := models.WebAuthnCeremonyLogin
+		if params.MfaToken != "" {
+			ceremony = models.WebAuthnCeremonyMfa
+			user, err = parseMfaToken(ctx.UserContext(), config, s, params.MfaToken)
+			if err == errMfaInvalid {
+				return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+			}
+		} else if params.Email != "" {
+			// unknown email gets the discoverable options, so the response does not tell whether the user exists
+			user, err = s.UserManager().ByEmail(ctx.UserContext(), params.Email)
+		}
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+
+		options, err := passkeys.BeginLogin(ctx.UserContext(), user, ceremony)
+		if err == passkey.ErrNoCredentials {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		} else if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		ctx.Set("Cache-Control", "no-store")
+		return ctx.Status(fiber.StatusOK).JSON(options)
+	}
+}
+
+// WebAuthnTokenLoginHandler godoc
+// @Summary passkey auth token
+// @Description verifies the assertion returned by navigator.credentials.get and responds with the tokens
+// @Id webauthn-auth-token
+// @Tags sso
+// @Param code query string true "application code"
+// @Param mfa_token query string false "mfa token returned by auth token"
+// @Param params body object true "public key credential"
+// @Accept json
+// @Produce json
+// @Success 200 {object} types.UserTokenResponse
+// @Failure 400 {object} fiber.Error
+// @Failure 401 {object} fiber.Error
+// @Failure 422 {object} fiber.Error
+// @Router /auth_token/webauthn [post]
+func WebAuthnTokenLoginHandler(config *internal.Config, s models.SSOer, passkeys *passkey.Service, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		ctx.Set("Content-Type", "application/json")
+		params := &types.WebAuthnTokenLoginRequest{}
+		if err := ctx.QueryParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), params.Code)
+		if err != nil || app == nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		user, err := passkeyLogin(ctx, config, s, passkeys, params.MfaToken)
+		if err == errMfaInvalid || err == passkey.ErrInvalidCredential {
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		} else if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		return userTokenResponse(ctx, s, user, app, true)
+	}
+}
+
+// WebAuthnCookieLoginHandler completes the login form or the oauth authorization sign in with a passkey.
+// It is called by the login page script, so it responds with the url the browser goes to next; the oauth
+// flow continues at the authorize endpoint which issues the code for the new sso session.
+func WebAuthnCookieLoginHandler(config *internal.Config, s models.SSOer, passkeys *passkey.Service, validator *internal.ServiceValidator) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		ctx.Set("Content-Type", "application/json")
+		params := &types.WebAuthnLoginFinishRequest{}
+		if err := ctx.QueryParser(params); err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+
+		validationErrors := HandleValidation(validator.Validate(params))
+		if validationErrors != nil {
+			return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+		}
+
+		if params.ClientId != "" {
+			authorizeParams := &types.AuthorizeRequest{}
+			if err := ctx.QueryParser(authorizeParams); err != nil {
+				return HttpError(ctx, fiber.StatusBadRequest, err)
+			}
+			if _, err := authorizeClient(ctx.UserContext(), s, authorizeParams); err != nil {
+				return HttpError(ctx, fiber.StatusBadRequest, err)
+			}
+			validationErrors = HandleValidation(validator.Validate(authorizeParams))
+			if validationErrors != nil {
+				return HttpError(ctx, fiber.StatusUnprocessableEntity, validationErrors)
+			}
+
+			user, err := passkeyLogin(ctx, config, s, passkeys, params.MfaToken)
+			if err == errMfaInvalid || err == passkey.ErrInvalidCredential {
+				return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+			} else if err != nil {
+				return HttpError(ctx, fiber.StatusInternalServerError, err)
+			}
+			session, err := startSession(ctx, s, user, authorizeParams.ClientId, time.Hour*time.Duration(s.RefreshTokenValidHours()), true)
+			if err != nil {
+				return HttpError(ctx, fiber.StatusInternalServerError, err)
+			}
+			if err = setSessionCookie(ctx, s, user, session); err != nil {
+				return HttpError(ctx, fiber.StatusInternalServerError, err)
+			}
+
+			q := url.Values{}
+			ctx.Context().QueryArgs().VisitAll(func(key, value []byte) {
+				q.Add(string(key), string(value))
+			})
+			q.Del("prompt")
+			q.Del("mfa_token")
+			out := types.WebAuthnLoginResponse{RedirectUrl: "/oauth/authorize?" + q.Encode()}
+			return ctx.Status(fiber.StatusOK).JSON(out)
+		}
+
+		app, err := s.ApplicationManager().ByCode(ctx.UserContext(), params.Code)
+		if err != nil || app == nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+		redirectUrl, err := loginRedirectUrl(app, params.RedirectRequest)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusBadRequest, err)
+		}
+		user, err := passkeyLogin(ctx, config, s, passkeys, params.MfaToken)
+		if err == errMfaInvalid || err == passkey.ErrInvalidCredential {
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		} else if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		session, err := startSession(ctx, s, user, app.Code, time.Hour*time.Duration(s.CTValidHours()), true)
+		if err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		if err = setSessionCookies(ctx, s, user, session, app); err != nil {
+			return HttpError(ctx, fiber.StatusInternalServerError, err)
+		}
+		out := types.WebAuthnLoginResponse{RedirectUrl: redirectUrl}
+		return ctx.Status(fiber.StatusOK).JSON(out)
+	}
+}
+
+// passkeyLogin verifies the assertion in the request body. With the mfa token the passkey has to belong to the
+// user who already entered the password, otherwise it is a passwordless login of the credential owner.
+// Either way both factors are proven, the passwordless ceremony requires user verification.
+func passkeyLogin(ctx *fiber.Ctx, config *internal.Config, s models.SSOer, passkeys *passkey.Service, mfaToken string) (*models.UserModel, error) {
+	failure := &models.AuditModel{Action: models.AuditActionPasskeyFailed}
+	if mfaToken != "" {
+		user, err := parseMfaToken(ctx.UserContext(), config, s, mfaToken)
+		if err != nil {
+			auditFailure(ctx, s, failure, err)
+			return nil, err
+		}
+		if _, err = passkeys.FinishLogin(ctx.UserContext(), ctx.Body(), models.WebAuthnCeremonyMfa, user.Id); err != nil {
+			failure.TargetId, failure.Subject = user.Id, user.Email
+			auditFailure(ctx, s, failure, err)
+			return nil, err
+		}
+		return user, loginSucceeded(ctx.UserContext(), s, user)
+	}
+
+	user, err := passkeys.FinishLogin(ctx.UserContext(), ctx.Body(), models.WebAuthnCeremonyLogin, 0)
+	if err != nil {
+		auditFailure(ctx, s, failure, err)
+		return nil, err
+	}
+	if !user.Active || user.Locked || user.LockedTo > time.Now().Unix() {
+		failure.TargetId, failure.Subject = user.Id, user.Email
+		auditFailure(ctx, s, failure, errors.New("user is not active or locked"))
+		return nil, passkey.ErrInvalidCredential
+	}
+	return user, nil
+}
+
+func webAuthnCredentialResponse(item *models.WebAuthnCredentialModel) types.WebAuthnCredentialResponse {
+	return types.WebAuthnCredentialResponse{
+		Id:       item.Id,
+		Name:     item.Name,
+		Created:  item.Created,
+		LastUsed: item.LastUsed,
+	}
+}
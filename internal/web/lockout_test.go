@@ -0,0 +1,118 @@
+package web_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lockout", func() {
+	var (
+		ctx         = context.Background()
+		application *models.ApplicationModel
+		email       string
+	)
+
+	fail := func(times int) {
+		for i := 0; i < times; i++ {
+			resp := postJson("/v1/auth_token", map[string]string{"email": email, "password": "wrong password", "code": application.Code}, "")
+			Expect(resp.StatusCode).To(Equal(fiber.StatusUnauthorized))
+		}
+	}
+
+	lockedTo := func() int64 {
+		user, err := sso.UserManager().ByEmail(ctx, email)
+		Expect(err).NotTo(HaveOccurred())
+		return user.LockedTo
+	}
+
+	BeforeEach(func() {
+		application = newApplication()
+		email = uuid.NewString() + "@example.com"
+		register(application, email)
+		verify(email)
+	})
+
+	AfterEach(resetIpFailures)
+
+	It("locks the account after too many failed attempts", func() {
+		fail(int(config.Lockout.MaxAttempts) - 1)
+		Expect(lockedTo()).To(BeZero())
+		fail(1)
+		Expect(lockedTo()).To(BeNumerically("~", time.Now().Unix()+config.Lockout.LockMinutes*60, 5))
+
+		// the locked account refuses the right password the same as the wrong one
+		resp := postJson("/v1/auth_token", map[string]string{"email": email, "password": "wrong password", "code": application.Code}, "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusUnauthorized))
+		wrong, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		resp = postJson("/v1/auth_token", map[string]string{"email": email, "password": password, "code": application.Code}, "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusUnauthorized))
+		Expect(ioutil.ReadAll(resp.Body)).To(Equal(wrong))
+		Expect(login(newBrowser(), application, email, password).StatusCode).NotTo(Equal(fiber.StatusFound))
+	})
+
+	It("locks the account twice as long the next time", func() {
+		fail(int(config.Lockout.MaxAttempts))
+		user, err := sso.UserManager().ByEmail(ctx, email)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the first lock is over
+		user.LockedTo = time.Now().Unix() - 1
+		_, err = sso.UserManager().Update(ctx, user)
+		Expect(err).NotTo(HaveOccurred())
+
+		fail(int(config.Lockout.MaxAttempts))
+		Expect(lockedTo()).To(BeNumerically("~", time.Now().Unix()+2*config.Lockout.LockMinutes*60, 5))
+		counter, err := sso.LoginFailureManager().ByKey(ctx, models.LoginFailureScopeUser, strconv.FormatInt(user.Id, 10))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counter.Lockouts).To(BeEquivalentTo(2))
+	})
+
+	It("blocks the ip after too many failed attempts", func() {
+		limit := config.Lockout.IpMaxAttempts
+		config.Lockout.IpMaxAttempts = 3
+		defer func() {
+			config.Lockout.IpMaxAttempts = limit
+		}()
+
+		fail(2)
+		// the failures of unknown emails count as well
+		resp := postJson("/v1/auth_token", map[string]string{"email": "unknown@example.com", "password": "wrong password", "code": application.Code}, "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusUnauthorized))
+
+		resp = postJson("/v1/auth_token", map[string]string{"email": email, "password": password, "code": application.Code}, "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusTooManyRequests))
+		Expect(lockedTo()).To(BeZero())
+
+		resetIpFailures()
+		signIn(application, email, password)
+	})
+
+	It("unlocks the account by the admin", func() {
+		fail(int(config.Lockout.MaxAttempts))
+		user, err := sso.UserManager().ByEmail(ctx, email)
+		Expect(err).NotTo(HaveOccurred())
+		target := "/v1/admin/user/" + strconv.FormatInt(user.Id, 10) + "/unlock"
+
+		// the unlock needs the token of the admin
+		Expect(postJson(target, nil, "").StatusCode).To(Equal(fiber.StatusBadRequest))
+
+		token := adminToken()
+		Expect(postJson(target, nil, token).StatusCode).To(Equal(fiber.StatusNoContent))
+		Expect(lockedTo()).To(BeZero())
+		counter, err := sso.LoginFailureManager().ByKey(ctx, models.LoginFailureScopeUser, strconv.FormatInt(user.Id, 10))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counter).To(BeNil())
+		signIn(application, email, password)
+
+		Expect(postJson("/v1/admin/user/0/unlock", nil, token).StatusCode).To(Equal(fiber.StatusNotFound))
+	})
+})
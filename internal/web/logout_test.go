@@ -0,0 +1,108 @@
+package web_test
+
+import (
+	"context"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/handlers"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logout", func() {
+	var (
+		application *models.ApplicationModel
+		email       string
+		server      *httptest.Server
+		mu          sync.Mutex
+		tokens      []string
+	)
+
+	delivered := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), tokens...)
+	}
+
+	BeforeEach(func() {
+		tokens = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			tokens = append(tokens, r.PostFormValue("logout_token"))
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		application = newApplication()
+		application.BackchannelLogoutUrl = server.URL + "/backchannel"
+		application.FrontchannelLogoutUrl = "https://app.example.com/frontchannel?tab=1"
+		_, err := sso.ApplicationManager().Update(context.Background(), application)
+		Expect(err).NotTo(HaveOccurred())
+		email = uuid.NewString() + "@example.com"
+		register(application, email)
+		verify(email)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("notifies the applications of the session", func() {
+		b := newBrowser()
+		Expect(login(b, application, email, password).StatusCode).To(Equal(fiber.StatusFound))
+		claims, err := handlers.ParseSessionToken(config, b.cookies[sso.CookieName()].Value)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the application without the logout urls is left out
+		silent := newApplication()
+		Expect(b.get("/login?code=" + silent.Code).StatusCode).To(Equal(fiber.StatusFound))
+
+		resp := b.get("/logout?code=" + application.Code)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		match := regexp.MustCompile(`<iframe src="([^"]+)"`).FindAllStringSubmatch(string(body), -1)
+		Expect(match).To(HaveLen(1))
+		frontchannel, err := url.Parse(html.UnescapeString(match[0][1]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(frontchannel.Host + frontchannel.Path).To(Equal("app.example.com/frontchannel"))
+		Expect(frontchannel.Query().Get("tab")).To(Equal("1"))
+		Expect(frontchannel.Query().Get("sid")).To(Equal(claims.SessionId))
+		Expect(frontchannel.Query().Get("iss")).NotTo(BeEmpty())
+		Expect(string(body)).To(ContainSubstring(`href="/login?code=` + application.Code + `"`))
+
+		Eventually(delivered).Should(HaveLen(1))
+		logoutClaims := &internal.LogoutTokenClaims{}
+		_, err = jwt.ParseWithClaims(delivered()[0], logoutClaims, config.Crypto.KeyRing.Keyfunc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logoutClaims.SessionId).To(Equal(claims.SessionId))
+		Expect(logoutClaims.Audience).To(Equal(application.Code))
+		Expect(logoutClaims.Subject).To(Equal(strconv.FormatInt(claims.Id, 10)))
+		Expect(logoutClaims.Issuer).To(Equal(frontchannel.Query().Get("iss")))
+		Expect(logoutClaims.Events).To(HaveKey(internal.BackchannelLogoutEvent))
+		Expect(logoutClaims.ExpiresAt).To(BeNumerically("~", logoutClaims.IssuedAt+120, 1))
+	})
+
+	It("notifies the applications of the revoked session", func() {
+		out := signIn(application, email, password)
+		Expect(postJson("/v1/user/sessions/revoke_all", nil, out.Token).StatusCode).To(Equal(fiber.StatusNoContent))
+
+		Eventually(delivered).Should(HaveLen(1))
+		logoutClaims := &internal.LogoutTokenClaims{}
+		_, err := jwt.ParseWithClaims(delivered()[0], logoutClaims, config.Crypto.KeyRing.Keyfunc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(logoutClaims.Audience).To(Equal(application.Code))
+	})
+})
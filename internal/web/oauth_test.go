@@ -0,0 +1,151 @@
+package web_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/handlers"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	callback = "https://app.example.com/callback"
+	verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// authorizationCode returns the code the application gets on its callback, the browser has to be signed in
+func authorizationCode(b *browser, application *models.ApplicationModel, scope, nonce string) string {
+	resp := b.get("/oauth/authorize?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {application.Code},
+		"redirect_uri":          {callback},
+		"scope":                 {scope},
+		"nonce":                 {nonce},
+		"code_challenge":        {internal.PKCEChallenge(verifier)},
+		"code_challenge_method": {internal.PKCEMethodS256},
+	}.Encode())
+	Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+	location, err := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(location.Query().Get("code")).NotTo(BeEmpty())
+	return location.Query().Get("code")
+}
+
+// exchange posts the authorization code grant to the token endpoint
+func exchange(application *models.ApplicationModel, code, redirectUri, codeVerifier string) *http.Response {
+	return postForm("/oauth/token", url.Values{
+		"grant_type":    {internal.GrantTypeAuthorizationCode},
+		"client_id":     {application.Code},
+		"code":          {code},
+		"redirect_uri":  {redirectUri},
+		"code_verifier": {codeVerifier},
+	})
+}
+
+// oauthError decodes the error response of the token endpoint
+func oauthError(resp *http.Response) string {
+	out := types.OAuthErrorResponse{}
+	Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+	return out.Error
+}
+
+var _ = Describe("OAuth", func() {
+	var (
+		application *models.ApplicationModel
+		email       string
+		b           *browser
+	)
+
+	BeforeEach(func() {
+		application = newApplication()
+		email = uuid.NewString() + "@example.com"
+		register(application, email)
+		verify(email)
+		b = newBrowser()
+		Expect(login(b, application, email, password).StatusCode).To(Equal(fiber.StatusFound))
+	})
+
+	It("exchanges the code for the tokens once", func() {
+		code := authorizationCode(b, application, "", "")
+
+		resp := exchange(application, code, callback, verifier)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		Expect(resp.Header.Get(fiber.HeaderCacheControl)).To(Equal("no-store"))
+		out := types.TokenResponse{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		Expect(out.TokenType).To(Equal("Bearer"))
+		Expect(out.RefreshToken).NotTo(BeEmpty())
+		Expect(out.IdToken).To(BeEmpty())
+		claims, err := handlers.ParseSignInToken(config, out.AccessToken)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.Audience).To(Equal(application.Code))
+		Expect(postJson("/v1/user/me", nil, out.AccessToken).StatusCode).To(Equal(fiber.StatusOK))
+
+		resp = exchange(application, code, callback, verifier)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusBadRequest))
+		Expect(oauthError(resp)).To(Equal(handlers.OAuthErrInvalidGrant))
+	})
+
+	It("refuses the code for another redirect uri or code verifier", func() {
+		code := authorizationCode(b, application, "", "")
+
+		resp := exchange(application, code, "https://app.example.com/other", verifier)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusBadRequest))
+		Expect(oauthError(resp)).To(Equal(handlers.OAuthErrInvalidGrant))
+
+		resp = exchange(application, code, callback, strings.Repeat("v", 43))
+		Expect(resp.StatusCode).To(Equal(fiber.StatusBadRequest))
+		Expect(oauthError(resp)).To(Equal(handlers.OAuthErrInvalidGrant))
+
+		resp = exchange(newApplication(), code, callback, verifier)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusBadRequest))
+		Expect(oauthError(resp)).To(Equal(handlers.OAuthErrInvalidGrant))
+	})
+
+	It("refuses the expired code", func() {
+		claims, err := handlers.ParseSessionToken(config, b.cookies[sso.CookieName()].Value)
+		Expect(err).NotTo(HaveOccurred())
+		code := uuid.NewString()
+		Expect(sso.AuthorizationCodeManager().Create(context.Background(), &models.AuthorizationCodeModel{
+			Code:                internal.HashToken(code),
+			ClientId:            application.Code,
+			UserId:              claims.Id,
+			SessionId:           claims.SessionId,
+			RedirectUri:         callback,
+			CodeChallenge:       internal.PKCEChallenge(verifier),
+			CodeChallengeMethod: internal.PKCEMethodS256,
+			ExpiresAt:           time.Now().Add(-time.Second).Unix(),
+		})).To(Succeed())
+
+		resp := exchange(application, code, callback, verifier)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusBadRequest))
+		Expect(oauthError(resp)).To(Equal(handlers.OAuthErrInvalidGrant))
+	})
+
+	It("never redirects to the unregistered redirect uri", func() {
+		resp := b.get("/oauth/authorize?" + url.Values{
+			"response_type":         {"code"},
+			"client_id":             {application.Code},
+			"redirect_uri":          {"https://evil.example.com/callback"},
+			"code_challenge":        {internal.PKCEChallenge(verifier)},
+			"code_challenge_method": {internal.PKCEMethodS256},
+		}.Encode())
+		// the error page is shown to the user instead
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		Expect(resp.Header.Get(fiber.HeaderLocation)).To(BeEmpty())
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("redirect_uri is not registered"))
+	})
+})
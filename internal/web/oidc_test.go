@@ -0,0 +1,161 @@
+package web_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/handlers"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OpenID Connect", func() {
+	var (
+		application *models.ApplicationModel
+		email       string
+		b           *browser
+	)
+
+	// tokens returns the tokens the application gets for the scope
+	tokens := func(scope, nonce string) types.TokenResponse {
+		resp := exchange(application, authorizationCode(b, application, scope, nonce), callback, verifier)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		out := types.TokenResponse{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		return out
+	}
+
+	userInfo := func(token string) map[string]interface{} {
+		resp := getJson("/userinfo", token)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		out := map[string]interface{}{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		return out
+	}
+
+	discovery := func() types.OpenIdConfiguration {
+		resp := getJson("/.well-known/openid-configuration", "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		out := types.OpenIdConfiguration{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		return out
+	}
+
+	BeforeEach(func() {
+		application = newApplication()
+		email = uuid.NewString() + "@example.com"
+		register(application, email)
+		verify(email)
+		b = newBrowser()
+		Expect(login(b, application, email, password).StatusCode).To(Equal(fiber.StatusFound))
+	})
+
+	It("publishes the discovery document", func() {
+		out := discovery()
+		Expect(out.Issuer).NotTo(BeEmpty())
+		Expect(out.AuthorizationEndpoint).To(Equal(out.Issuer + "/oauth/authorize"))
+		Expect(out.TokenEndpoint).To(Equal(out.Issuer + "/oauth/token"))
+		Expect(out.UserInfoEndpoint).To(Equal(out.Issuer + "/userinfo"))
+		Expect(out.JwksUri).To(Equal(out.Issuer + "/.well-known/jwks.json"))
+		Expect(out.ScopesSupported).To(ConsistOf(internal.ScopeOpenId, internal.ScopeProfile, internal.ScopeEmail))
+		Expect(out.CodeChallengeMethodsSupported).To(ConsistOf(internal.PKCEMethodS256))
+		Expect(out.IdTokenSigningAlgValuesSupported).To(ConsistOf("RS256"))
+	})
+
+	It("signs the id_token by a key of the key set", func() {
+		out := tokens("openid email", "nonce")
+		Expect(out.IdToken).NotTo(BeEmpty())
+
+		resp := getJson("/.well-known/jwks.json", "")
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		set := types.JSONWebKeySet{}
+		Expect(json.NewDecoder(resp.Body).Decode(&set)).To(Succeed())
+		keys := map[string]*rsa.PublicKey{}
+		for _, key := range set.Keys {
+			Expect(key.Kty).To(Equal("RSA"))
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			Expect(err).NotTo(HaveOccurred())
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			Expect(err).NotTo(HaveOccurred())
+			keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		}
+
+		claims := &internal.IdTokenClaims{}
+		token, err := jwt.ParseWithClaims(out.IdToken, claims, func(token *jwt.Token) (interface{}, error) {
+			return keys[token.Header["kid"].(string)], nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.Method.Alg()).To(Equal("RS256"))
+
+		session, err := handlers.ParseSessionToken(config, b.cookies[sso.CookieName()].Value)
+		Expect(err).NotTo(HaveOccurred())
+		stored, err := sso.SessionManager().BySid(context.Background(), session.SessionId)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.Issuer).To(Equal(discovery().Issuer))
+		Expect(claims.Audience).To(Equal(application.Code))
+		Expect(claims.Subject).To(Equal(strconv.FormatInt(session.Id, 10)))
+		Expect(claims.Nonce).To(Equal("nonce"))
+		Expect(claims.SessionId).To(Equal(session.SessionId))
+		Expect(claims.AuthTime).To(Equal(stored.Created))
+		Expect(claims.Email).To(Equal(email))
+		Expect(claims.EmailVerified).To(BeTrue())
+		Expect(claims.Name).To(BeEmpty())
+
+		// no id_token without the openid scope
+		Expect(tokens("", "").IdToken).To(BeEmpty())
+	})
+
+	It("returns the claims of the granted scope from userinfo", func() {
+		Expect(userInfo(tokens("openid", "").AccessToken)).To(HaveLen(1))
+
+		info := userInfo(tokens("openid email", "").AccessToken)
+		Expect(info).To(HaveKeyWithValue("email", email))
+		Expect(info).To(HaveKeyWithValue("email_verified", true))
+		Expect(info).NotTo(HaveKey("name"))
+
+		info = userInfo(tokens("openid profile", "").AccessToken)
+		Expect(info).To(HaveKeyWithValue("name", "Test User"))
+		Expect(info).To(HaveKeyWithValue("gender", "f"))
+		Expect(info).NotTo(HaveKey("email"))
+
+		// the access token without the openid scope is not enough
+		resp := getJson("/userinfo", tokens("profile", "").AccessToken)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusForbidden))
+		Expect(resp.Header.Get("WWW-Authenticate")).To(ContainSubstring("insufficient_scope"))
+		Expect(getJson("/userinfo", signIn(application, email, password).Token).StatusCode).To(Equal(fiber.StatusForbidden))
+	})
+
+	It("refuses the other tokens of the key ring as the access token", func() {
+		out := tokens("openid", "")
+		claims, err := handlers.ParseSignInToken(config, out.AccessToken)
+		Expect(err).NotTo(HaveOccurred())
+		standard := jwt.StandardClaims{
+			Issuer:    "issuer",
+			Subject:   "1",
+			Audience:  application.Code,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		}
+
+		idToken, err := sso.BuildIdToken(&internal.IdTokenClaims{SessionId: claims.SessionId, StandardClaims: standard})
+		Expect(err).NotTo(HaveOccurred())
+		logoutToken, err := internal.GenLogoutTokenJWT(&internal.LogoutTokenClaims{SessionId: claims.SessionId, StandardClaims: standard}, config.Crypto.KeyRing.Active())
+		Expect(err).NotTo(HaveOccurred())
+		for _, token := range []string{idToken, logoutToken, out.IdToken} {
+			Expect(postJson("/v1/user/me", nil, token).StatusCode).To(Equal(fiber.StatusUnauthorized))
+			Expect(getJson("/userinfo", token).StatusCode).To(Equal(fiber.StatusUnauthorized))
+		}
+		Expect(getJson("/userinfo", out.AccessToken).StatusCode).To(Equal(fiber.StatusOK))
+	})
+})
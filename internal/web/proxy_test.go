@@ -0,0 +1,102 @@
+package web_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web"
+	"github.com/MiG-21/go-sso/internal/web/handlers"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Trusted proxies", func() {
+	var application *models.ApplicationModel
+
+	// forwarded posts the request as if it came through a proxy setting the forwarded headers
+	forwarded := func(server *fiber.App, target string, body interface{}) *http.Response {
+		data, err := json.Marshal(body)
+		Expect(err).NotTo(HaveOccurred())
+		req := httptest.NewRequest(fiber.MethodPost, target, bytes.NewReader(data))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderXForwardedHost, "sso.example.org")
+		req.Header.Set(fiber.HeaderXForwardedProto, "https")
+		req.Header.Set(fiber.HeaderXForwardedFor, "198.51.100.7")
+		resp, err := server.Test(req, -1)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+
+	registered := func(server *fiber.App) string {
+		email := uuid.NewString() + "@example.com"
+		resp := forwarded(server, "/v1/user/register", map[string]interface{}{
+			"name":             "Test User",
+			"email":            email,
+			"password":         password,
+			"confirm_password": password,
+			"gender":           "f",
+			"agreement":        true,
+			"code":             application.Code,
+		})
+		Expect(resp.StatusCode).To(Equal(fiber.StatusCreated))
+		return email
+	}
+
+	// sessionIp signs the user in and returns the address the session is recorded with
+	sessionIp := func(server *fiber.App, email string) string {
+		resp := forwarded(server, "/v1/auth_token", map[string]string{"email": email, "password": password, "code": application.Code})
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		out := types.UserTokenResponse{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		claims, err := handlers.ParseSignInToken(config, out.Token)
+		Expect(err).NotTo(HaveOccurred())
+		session, err := sso.SessionManager().BySid(context.Background(), claims.SessionId)
+		Expect(err).NotTo(HaveOccurred())
+		return session.Ip
+	}
+
+	BeforeEach(func() {
+		application = newApplication()
+	})
+
+	It("ignores the forwarded headers of the untrusted peer", func() {
+		email := registered(app)
+		Eventually(mails.link(email)).ShouldNot(BeNil())
+		link := mails.link(email)()
+		Expect(link.Scheme).To(Equal("http"))
+		Expect(link.Host).To(Equal("example.com"))
+
+		verify(email)
+		Expect(sessionIp(app, email)).To(Equal("0.0.0.0"))
+	})
+
+	It("honors the forwarded headers of the trusted proxy", func() {
+		trusted := *config
+		proxies, err := internal.NewTrustedProxies([]string{"0.0.0.0"})
+		Expect(err).NotTo(HaveOccurred())
+		trusted.Http.Proxies = proxies
+		params := serverParams
+		params.Config = &trusted
+		server := web.SetupServer(params)
+		defer func() {
+			_ = server.Shutdown()
+		}()
+
+		email := registered(server)
+		Eventually(mails.link(email)).ShouldNot(BeNil())
+		link := mails.link(email)()
+		Expect(link.Scheme).To(Equal("https"))
+		Expect(link.Host).To(Equal("sso.example.org"))
+
+		verify(email)
+		Expect(sessionIp(server, email)).To(Equal("198.51.100.7"))
+	})
+})
@@ -0,0 +1,98 @@
+package web_test
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Refresh token", func() {
+	var (
+		application *models.ApplicationModel
+		email       string
+	)
+
+	refresh := func(code, token string) (int, types.UserTokenResponse) {
+		resp := postJson("/v1/refresh_token", map[string]string{"code": code, "refresh_token": token}, "")
+		out := types.UserTokenResponse{}
+		if resp.StatusCode == fiber.StatusOK {
+			Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		}
+		return resp.StatusCode, out
+	}
+
+	BeforeEach(func() {
+		application = newApplication()
+		email = uuid.NewString() + "@example.com"
+		register(application, email)
+		verify(email)
+	})
+
+	It("rotates the refresh token", func() {
+		first := signIn(application, email, password)
+
+		status, second := refresh(application.Code, first.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusOK))
+		Expect(second.RefreshToken).NotTo(BeEmpty())
+		Expect(second.RefreshToken).NotTo(Equal(first.RefreshToken))
+		Expect(postJson("/v1/user/me", nil, second.Token).StatusCode).To(Equal(fiber.StatusOK))
+
+		status, third := refresh(application.Code, second.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusOK))
+		Expect(third.RefreshToken).NotTo(BeEmpty())
+	})
+
+	It("refuses the token of another application", func() {
+		first := signIn(application, email, password)
+		status, _ := refresh(newApplication().Code, first.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusUnauthorized))
+
+		// the token is still usable by its application
+		status, _ = refresh(application.Code, first.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusOK))
+	})
+
+	It("revokes the family when the used token comes back", func() {
+		first := signIn(application, email, password)
+		status, second := refresh(application.Code, first.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusOK))
+
+		status, _ = refresh(application.Code, first.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusUnauthorized))
+
+		// the token rotated from the reused one is revoked along with it
+		status, _ = refresh(application.Code, second.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusUnauthorized))
+
+		// the other sign in is a family of its own
+		other := signIn(application, email, password)
+		status, _ = refresh(application.Code, other.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusOK))
+	})
+	It("refuses the token while the account is locked", func() {
+		ctx := context.Background()
+		out := signIn(application, email, password)
+		user, err := sso.UserManager().ByEmail(ctx, email)
+		Expect(err).NotTo(HaveOccurred())
+		user.LockedTo = time.Now().Add(time.Hour).Unix()
+		_, err = sso.UserManager().Update(ctx, user)
+		Expect(err).NotTo(HaveOccurred())
+
+		status, _ := refresh(application.Code, out.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusUnauthorized))
+
+		// the token is not burned by the refusal
+		user.LockedTo = 0
+		_, err = sso.UserManager().Update(ctx, user)
+		Expect(err).NotTo(HaveOccurred())
+		status, _ = refresh(application.Code, out.RefreshToken)
+		Expect(status).To(Equal(fiber.StatusOK))
+	})
+})
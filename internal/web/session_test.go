@@ -0,0 +1,248 @@
+package web_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/web/handlers"
+	"github.com/MiG-21/go-sso/internal/web/types"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Session", func() {
+	var (
+		application *models.ApplicationModel
+		email       string
+	)
+
+	BeforeEach(func() {
+		application = newApplication()
+		email = uuid.NewString() + "@example.com"
+		register(application, email)
+		verify(email)
+	})
+
+	It("scopes the application cookie to the application", func() {
+		resp := login(newBrowser(), application, email, password)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+		cookies := map[string]*http.Cookie{}
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == sso.CookieName() {
+				cookies[cookie.Domain] = cookie
+			}
+		}
+		Expect(cookies).To(HaveLen(2))
+
+		appClaims, err := handlers.ParseSignInToken(config, cookies[application.Domain].Value)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(appClaims.Audience).To(Equal(application.Code))
+		ssoClaims, err := handlers.ParseSessionToken(config, cookies[sso.CookieDomain()].Value)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ssoClaims.Audience).To(BeEmpty())
+		Expect(appClaims.SessionId).To(Equal(ssoClaims.SessionId))
+
+		// the application token is not the sso session
+		b := newBrowser()
+		b.cookies[sso.CookieName()] = cookies[application.Domain]
+		Expect(b.get("/login?code=" + application.Code).StatusCode).To(Equal(fiber.StatusOK))
+		b.cookies[sso.CookieName()] = cookies[sso.CookieDomain()]
+		Expect(b.get("/login?code=" + application.Code).StatusCode).To(Equal(fiber.StatusFound))
+
+		// the api takes the token of the application which joined the session only
+		Expect(postJson("/v1/user/me", nil, cookies[application.Domain].Value).StatusCode).To(Equal(fiber.StatusOK))
+		other, err := sso.BuildJWTToken(appClaims.Id, nil, appClaims.SessionId, newApplication().Code, "", time.Now().Add(time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(postJson("/v1/user/me", nil, other).StatusCode).To(Equal(fiber.StatusUnauthorized))
+		// the sso cookie is no access token
+		Expect(postJson("/v1/user/me", nil, cookies[sso.CookieDomain()].Value).StatusCode).To(Equal(fiber.StatusUnauthorized))
+		Expect(getJson("/userinfo", cookies[sso.CookieDomain()].Value).StatusCode).To(Equal(fiber.StatusUnauthorized))
+	})
+
+	It("issues its own cookie to the application on the sso domain", func() {
+		application.Domain = sso.CookieDomain()
+		_, err := sso.ApplicationManager().Update(context.Background(), application)
+		Expect(err).NotTo(HaveOccurred())
+
+		b := newBrowser()
+		Expect(login(b, application, email, password).StatusCode).To(Equal(fiber.StatusFound))
+		name := sso.CookieName() + "_" + application.Code
+		Expect(b.cookies).To(HaveKey(name))
+		claims, err := handlers.ParseSignInToken(config, b.cookies[name].Value)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.Audience).To(Equal(application.Code))
+		Expect(postJson("/v1/user/me", nil, b.cookies[name].Value).StatusCode).To(Equal(fiber.StatusOK))
+		Expect(postJson("/v1/user/me", nil, b.cookies[sso.CookieName()].Value).StatusCode).To(Equal(fiber.StatusUnauthorized))
+
+		Expect(b.get("/logout?code=" + application.Code).StatusCode).To(Equal(fiber.StatusFound))
+		Expect(b.cookies).NotTo(HaveKey(name))
+		Expect(b.cookies).NotTo(HaveKey(sso.CookieName()))
+	})
+
+	It("reuses the sso session for the other applications", func() {
+		b := newBrowser()
+		Expect(login(b, application, email, password).StatusCode).To(Equal(fiber.StatusFound))
+		claims, err := handlers.ParseSessionToken(config, b.cookies[sso.CookieName()].Value)
+		Expect(err).NotTo(HaveOccurred())
+
+		other := newApplication()
+		other.RedirectUrl = "https://other.example.com/"
+		_, err = sso.ApplicationManager().Update(context.Background(), other)
+		Expect(err).NotTo(HaveOccurred())
+		resp := b.get("/login?code=" + other.Code)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+		Expect(resp.Header.Get(fiber.HeaderLocation)).To(Equal(other.RedirectUrl))
+		clients, err := sso.SessionClientManager().BySid(context.Background(), claims.SessionId)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clients).To(HaveLen(2))
+
+		// prompt=login asks for the password although the session is active
+		Expect(b.get("/login?prompt=login&code=" + other.Code).StatusCode).To(Equal(fiber.StatusOK))
+
+		authorize := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {other.Code},
+			"redirect_uri":          {"https://app.example.com/callback"},
+			"state":                 {"state"},
+			"code_challenge":        {strings.Repeat("c", 43)},
+			"code_challenge_method": {"S256"},
+		}
+		resp = b.get("/oauth/authorize?" + authorize.Encode())
+		Expect(resp.StatusCode).To(Equal(fiber.StatusFound))
+		location, err := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(location.Host).To(Equal("app.example.com"))
+		Expect(location.Query().Get("code")).NotTo(BeEmpty())
+		Expect(location.Query().Get("state")).To(Equal("state"))
+
+		authorize.Set("prompt", "login")
+		Expect(b.get("/oauth/authorize?" + authorize.Encode()).StatusCode).To(Equal(fiber.StatusOK))
+
+		// nothing is reused once the session is over
+		Expect(b.get("/logout?code=" + application.Code).StatusCode).To(Equal(fiber.StatusFound))
+		Expect(b.get("/login?code=" + other.Code).StatusCode).To(Equal(fiber.StatusOK))
+		authorize.Del("prompt")
+		Expect(b.get("/oauth/authorize?" + authorize.Encode()).StatusCode).To(Equal(fiber.StatusOK))
+	})
+
+	It("asks for the form when the session lacks the second factor or the password has expired", func() {
+		ctx := context.Background()
+		b := newBrowser()
+		Expect(login(b, application, email, password).StatusCode).To(Equal(fiber.StatusFound))
+		authorize := "/oauth/authorize?" + url.Values{
+			"response_type":         {"code"},
+			"client_id":             {application.Code},
+			"redirect_uri":          {"https://app.example.com/callback"},
+			"code_challenge":        {strings.Repeat("c", 43)},
+			"code_challenge_method": {"S256"},
+		}.Encode()
+		Expect(b.get(authorize).StatusCode).To(Equal(fiber.StatusFound))
+
+		// the role requires the second factor the session was not confirmed by
+		user, err := sso.UserManager().ByEmail(ctx, email)
+		Expect(err).NotTo(HaveOccurred())
+		role := user.Role
+		user.Role = "admin"
+		_, err = sso.UserManager().Update(ctx, user)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.get(authorize).StatusCode).To(Equal(fiber.StatusOK))
+		Expect(b.get("/login?code=" + application.Code).StatusCode).To(Equal(fiber.StatusOK))
+
+		user.Role = role
+		user.PasswordChanged = time.Now().Add(-48 * time.Hour).Unix()
+		_, err = sso.UserManager().Update(ctx, user)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.get(authorize).StatusCode).To(Equal(fiber.StatusFound))
+
+		maxAge := config.Password.MaxAgeDays
+		config.Password.MaxAgeDays = 1
+		defer func() {
+			config.Password.MaxAgeDays = maxAge
+		}()
+		Expect(b.get(authorize).StatusCode).To(Equal(fiber.StatusOK))
+		Expect(b.get("/login?code=" + application.Code).StatusCode).To(Equal(fiber.StatusOK))
+	})
+
+	It("cuts the long user agent of the session at the rune boundary", func() {
+		data, err := json.Marshal(map[string]string{"email": email, "password": password, "code": application.Code})
+		Expect(err).NotTo(HaveOccurred())
+		req := httptest.NewRequest(fiber.MethodPost, "/v1/auth_token", bytes.NewReader(data))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderUserAgent, strings.Repeat("é", 200))
+		resp, err := app.Test(req, -1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+
+		out := types.UserTokenResponse{}
+		Expect(json.NewDecoder(resp.Body).Decode(&out)).To(Succeed())
+		claims, err := handlers.ParseSignInToken(config, out.Token)
+		Expect(err).NotTo(HaveOccurred())
+		session, err := sso.SessionManager().BySid(context.Background(), claims.SessionId)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utf8.ValidString(session.UserAgent)).To(BeTrue())
+		Expect(session.UserAgent).To(Equal(strings.Repeat("é", 127)))
+	})
+
+	It("lists and revokes the sessions of the user", func() {
+		first := signIn(application, email, password)
+		second := signIn(application, email, password)
+
+		resp := getJson("/v1/user/sessions", first.Token)
+		Expect(resp.StatusCode).To(Equal(fiber.StatusOK))
+		var sessions []types.SessionResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&sessions)).To(Succeed())
+		Expect(sessions).To(HaveLen(2))
+		var other string
+		for _, session := range sessions {
+			Expect(session.ClientId).To(Equal(application.Code))
+			if !session.Current {
+				other = session.Sid
+			}
+		}
+		Expect(other).NotTo(BeEmpty())
+
+		Expect(postJson("/v1/user/sessions/revoke", map[string]string{"sid": other}, first.Token).StatusCode).To(Equal(fiber.StatusNoContent))
+		// the token of the revoked session is refused although it has not expired
+		Expect(postJson("/v1/user/me", nil, second.Token).StatusCode).To(Equal(fiber.StatusUnauthorized))
+		Expect(postJson("/v1/refresh_token", map[string]string{"code": application.Code, "refresh_token": second.RefreshToken}, "").StatusCode).To(Equal(fiber.StatusUnauthorized))
+		Expect(postJson("/v1/user/me", nil, first.Token).StatusCode).To(Equal(fiber.StatusOK))
+
+		Expect(postJson("/v1/user/sessions/revoke_all", nil, first.Token).StatusCode).To(Equal(fiber.StatusNoContent))
+		Expect(postJson("/v1/user/me", nil, first.Token).StatusCode).To(Equal(fiber.StatusUnauthorized))
+	})
+
+	It("revokes the session of another user by the admin only", func() {
+		out := signIn(application, email, password)
+		claims, err := handlers.ParseSignInToken(config, out.Token)
+		Expect(err).NotTo(HaveOccurred())
+		revoke := map[string]string{"sid": claims.SessionId}
+
+		// the session is not found among the sessions of the other user
+		stranger := uuid.NewString() + "@example.com"
+		register(application, stranger)
+		verify(stranger)
+		Expect(postJson("/v1/user/sessions/revoke", revoke, signIn(application, stranger, password).Token).StatusCode).To(Equal(fiber.StatusNotFound))
+		Expect(postJson("/v1/admin/session/revoke", revoke, out.Token).StatusCode).To(Equal(fiber.StatusUnauthorized))
+		Expect(postJson("/v1/user/me", nil, out.Token).StatusCode).To(Equal(fiber.StatusOK))
+
+		Expect(postJson("/v1/admin/session/revoke", revoke, adminToken()).StatusCode).To(Equal(fiber.StatusNoContent))
+		Expect(postJson("/v1/user/me", nil, out.Token).StatusCode).To(Equal(fiber.StatusUnauthorized))
+	})
+
+	It("issues the api tokens for the application", func() {
+		out := signIn(application, email, password)
+		claims, err := handlers.ParseSignInToken(config, out.Token)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.Audience).To(Equal(application.Code))
+	})
+})
@@ -7,10 +7,13 @@ import (
 	"github.com/MiG-21/go-sso/internal"
 	"github.com/MiG-21/go-sso/internal/event"
 	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/passkey"
+	"github.com/MiG-21/go-sso/internal/ratelimit"
 	"github.com/MiG-21/go-sso/internal/web/handlers"
 	swagger "github.com/arsmn/fiber-swagger/v2"
 	goJson "github.com/goccy/go-json"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/template/html"
@@ -26,11 +29,13 @@ type (
 	InitServerParams struct {
 		dig.In
 
-		Config       *internal.Config
-		Logger       *zerolog.Logger
-		Validator    *internal.ServiceValidator
-		Sso          models.SSOer
-		EventService *event.Service
+		Config         *internal.Config
+		Logger         *zerolog.Logger
+		Validator      *internal.ServiceValidator
+		Sso            models.SSOer
+		EventService   *event.Service
+		PasskeyService *passkey.Service
+		RateLimiter    *ratelimit.Limiter
 	}
 )
 
@@ -52,12 +57,19 @@ func SetupServer(p InitServerParams) *fiber.App {
 		DisableStartupMessage: true,
 		JSONDecoder:           goJson.Unmarshal,
 		JSONEncoder:           goJson.Marshal,
+		// X-Forwarded-Proto/Host are honored from the trusted proxies only
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          p.Config.Http.Proxies.Ranges(),
 	})
 
 	// Default middleware fiberApp
 	app.Use(recover.New())
+	// client ip behind the trusted proxies
+	app.Use(handlers.ClientIp(p.Config.Http.Proxies))
 	// requestId middleware
 	app.Use(requestid.New())
+	// deadline of the storage access
+	app.Use(handlers.RequestTimeout(time.Duration(p.Config.Http.ReqTimeout) * time.Second))
 	// logger middleware
 	app.Use(handlers.Logger(p.Logger))
 
@@ -70,17 +82,42 @@ func SetupServer(p InitServerParams) *fiber.App {
 		MaxAge:        3600,
 	})
 
-	app.Get("/login", handlers.LoginFormHandler(p.Validator))
-	app.Post("/login", handlers.AuthCookieHandler(p.Sso, p.Validator))
-	app.Get("/logout", handlers.LogoutHandler(p.Sso, p.Validator))
-	app.Get("/verification", handlers.VerificationHandler(p.Config, p.Sso, p.Validator))
+	// html forms, the csrf middleware issues the token on the form pages and checks it on submit
+	csrfHandler := handlers.Csrf(p.Config)
+	app.Use("/login", csrfHandler)
+	app.Use("/password", csrfHandler)
+	app.Use("/oauth/authorize", csrfHandler)
+
+	app.Get("/login", handlers.LoginFormHandler(p.Config, p.Sso, p.Validator))
+	app.Post("/login", handlers.RateLimit(p.RateLimiter, "login"), handlers.AuthCookieHandler(p.Config, p.Sso, p.Validator, p.EventService))
+	app.Post("/login/mfa", handlers.RateLimit(p.RateLimiter, "mfa"), handlers.AuthCookieMfaHandler(p.Config, p.Sso, p.Validator, p.EventService))
+	app.Post("/login/webauthn/begin", handlers.RateLimit(p.RateLimiter, "webauthn"), handlers.WebAuthnLoginBeginHandler(p.Config, p.Sso, p.PasskeyService, p.Validator))
+	app.Post("/login/webauthn/finish", handlers.RateLimit(p.RateLimiter, "webauthn"), handlers.WebAuthnCookieLoginHandler(p.Config, p.Sso, p.PasskeyService, p.Validator))
+	app.Get("/logout", handlers.LogoutHandler(p.Config, p.Sso, p.Validator, p.EventService))
+	app.Get("/verification", handlers.RateLimit(p.RateLimiter, "verification"), handlers.VerificationHandler(p.Config, p.Sso, p.Validator))
 	app.Get("/verified", handlers.VerifiedHandler())
 	passGroup := app.Group("password")
 	passGroup.Get("/recover", handlers.PasswordRecoverFormHandler())
-	passGroup.Post("/recover", handlers.PasswordRecoverHandler(p.Config, p.Sso, p.Validator, p.EventService))
+	passGroup.Post("/recover", handlers.RateLimit(p.RateLimiter, "password_recover"), handlers.PasswordRecoverHandler(p.Config, p.Sso, p.Validator, p.EventService))
 	passGroup.Get("/recover/send", handlers.PasswordRecoverSendHandler())
 	passGroup.Get("/change", handlers.PasswordChangeFormHandler(p.Config, p.Validator))
-	passGroup.Post("/change", handlers.PasswordChangeHandler(p.Sso, p.Validator))
+	passGroup.Post("/change", handlers.RateLimit(p.RateLimiter, "password_change"), handlers.PasswordChangeHandler(p.Sso, p.Validator))
+
+	// oauth / openid connect routes, token, discovery and userinfo endpoints are called by browser based clients
+	corsHandler := cors.New()
+	app.Use("/oauth/token", corsHandler)
+	app.Use("/.well-known", corsHandler)
+	app.Use("/userinfo", corsHandler)
+
+	oauthGroup := app.Group("oauth")
+	oauthGroup.Get("/authorize", handlers.AuthorizeFormHandler(p.Config, p.Sso, p.Validator))
+	oauthGroup.Post("/authorize", handlers.RateLimit(p.RateLimiter, "login"), handlers.AuthorizeHandler(p.Config, p.Sso, p.Validator, p.EventService))
+	oauthGroup.Post("/authorize/mfa", handlers.RateLimit(p.RateLimiter, "mfa"), handlers.AuthorizeMfaHandler(p.Config, p.Sso, p.Validator, p.EventService))
+	oauthGroup.Post("/token", handlers.RateLimit(p.RateLimiter, "token"), handlers.TokenHandler(p.Sso, p.Validator))
+	app.Get("/.well-known/openid-configuration", handlers.OpenIdConfigurationHandler(p.Sso))
+	app.Get("/.well-known/jwks.json", handlers.JWKSHandler(p.Config))
+	app.Get("/userinfo", handlers.OpenIdUserInfoHandler(p.Config, p.Sso))
+	app.Post("/userinfo", handlers.OpenIdUserInfoHandler(p.Config, p.Sso))
 
 	// API routes
 	versionGroup := app.Group("v1")
@@ -89,17 +126,41 @@ func SetupServer(p InitServerParams) *fiber.App {
 	healthGroup.Get("/ping", handlers.HealthPingHandler)
 	healthGroup.Get("/info", handlers.HealthInfoHandler(p.Config))
 
-	versionGroup.Post("/auth_token", handlers.AuthTokenHandler(p.Sso, p.Validator))
+	versionGroup.Post("/auth_token", handlers.RateLimit(p.RateLimiter, "login"), handlers.AuthTokenHandler(p.Sso, p.Validator, p.EventService))
+	versionGroup.Post("/auth_token/mfa", handlers.RateLimit(p.RateLimiter, "mfa"), handlers.AuthTokenMfaHandler(p.Config, p.Sso, p.Validator, p.EventService))
+	versionGroup.Post("/auth_token/webauthn/begin", handlers.RateLimit(p.RateLimiter, "webauthn"), handlers.WebAuthnLoginBeginHandler(p.Config, p.Sso, p.PasskeyService, p.Validator))
+	versionGroup.Post("/auth_token/webauthn", handlers.RateLimit(p.RateLimiter, "webauthn"), handlers.WebAuthnTokenLoginHandler(p.Config, p.Sso, p.PasskeyService, p.Validator))
+	versionGroup.Post("/refresh_token", handlers.RateLimit(p.RateLimiter, "token"), handlers.RefreshTokenHandler(p.Sso, p.Validator))
 
 	// user routes
 	userGroup := versionGroup.Group("user")
-	userGroup.Post("/register", handlers.CreateUserHandler(p.Config, p.Sso, p.Validator, p.EventService))
-	userGroup.Post("/me", handlers.Authenticate(p.Config), handlers.UserInfoHandler(p.Sso))
+	userGroup.Post("/register", handlers.RateLimit(p.RateLimiter, "register"), handlers.CreateUserHandler(p.Config, p.Sso, p.Validator, p.EventService))
+	userGroup.Post("/me", handlers.Authenticate(p.Config, p.Sso), handlers.UserInfoHandler(p.Sso))
+	userGroup.Get("/sessions", handlers.Authenticate(p.Config, p.Sso), handlers.UserSessionsHandler(p.Sso))
+	userGroup.Post("/sessions/revoke", handlers.Authenticate(p.Config, p.Sso), handlers.UserSessionRevokeHandler(p.Sso, p.Validator, p.EventService))
+	userGroup.Post("/sessions/revoke_all", handlers.Authenticate(p.Config, p.Sso), handlers.UserSessionsRevokeAllHandler(p.Sso, p.EventService))
+	userGroup.Post("/mfa/totp/enroll", handlers.Authenticate(p.Config, p.Sso), handlers.TotpEnrollHandler(p.Sso))
+	userGroup.Post("/mfa/totp/confirm", handlers.Authenticate(p.Config, p.Sso), handlers.TotpConfirmHandler(p.Sso, p.Validator))
+	userGroup.Post("/mfa/totp/disable", handlers.Authenticate(p.Config, p.Sso), handlers.TotpDisableHandler(p.Sso, p.Validator))
+	userGroup.Post("/mfa/recovery_codes", handlers.Authenticate(p.Config, p.Sso), handlers.RecoveryCodesHandler(p.Sso))
+	userGroup.Post("/webauthn/register/begin", handlers.Authenticate(p.Config, p.Sso), handlers.WebAuthnRegisterBeginHandler(p.Sso, p.PasskeyService))
+	userGroup.Post("/webauthn/register/finish", handlers.Authenticate(p.Config, p.Sso), handlers.WebAuthnRegisterFinishHandler(p.Sso, p.PasskeyService, p.Validator))
+	userGroup.Get("/webauthn/credentials", handlers.Authenticate(p.Config, p.Sso), handlers.WebAuthnCredentialsHandler(p.Sso))
+	userGroup.Post("/webauthn/credentials/delete", handlers.Authenticate(p.Config, p.Sso), handlers.WebAuthnCredentialDeleteHandler(p.Sso, p.Validator))
 
 	// application routes
-	appGroup := versionGroup.Group("application", handlers.Authenticate(p.Config, "admin"))
+	appGroup := versionGroup.Group("application", handlers.Authenticate(p.Config, p.Sso, "admin"))
 	appGroup.Post("/create", handlers.CreateApplicationHandler(p.Sso, p.Validator))
 
+	// admin routes
+	adminGroup := versionGroup.Group("admin", handlers.Authenticate(p.Config, p.Sso, "admin"))
+	adminGroup.Get("/user/:id/sessions", handlers.AdminUserSessionsHandler(p.Sso))
+	adminGroup.Post("/user/:id/sessions/revoke_all", handlers.AdminUserSessionsRevokeAllHandler(p.Sso, p.EventService))
+	adminGroup.Post("/user/:id/unlock", handlers.AdminUserUnlockHandler(p.Sso))
+	adminGroup.Get("/audit", handlers.AdminAuditHandler(p.Sso, p.Validator))
+	adminGroup.Get("/audit/export", handlers.AdminAuditExportHandler(p.Sso, p.Validator))
+	adminGroup.Post("/session/revoke", handlers.AdminSessionRevokeHandler(p.Sso, p.Validator, p.EventService))
+
 	// swagger
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
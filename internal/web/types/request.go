@@ -1,18 +1,30 @@
 package types
 
 type (
+	// RedirectRequest is the page of the application the browser returns to after the login or the logout, it has
+	// to be registered for the application, State is passed back untouched.
+	RedirectRequest struct {
+		RedirectUri string `json:"-" query:"redirect_uri" form:"redirect_uri" validate:"omitempty,url,max=2048"`
+		State       string `json:"-" query:"state" form:"state" validate:"max=512"`
+	}
+
 	AuthRequest struct {
+		RedirectRequest
 		Email    string `json:"email" form:"email" validate:"required"`
 		Password string `json:"password" form:"password" validate:"required"`
 		Code     string `json:"code" form:"code" validate:"required"`
 	}
 
 	LoginLogoutRequest struct {
-		Code string `query:"code" validate:"required"`
+		RedirectRequest
+		Code   string `query:"code" validate:"required"`
+		Prompt string `query:"prompt" validate:"omitempty,oneof=login"`
 	}
 
 	PasswordRecoverRequest struct {
 		Email string `json:"email" form:"email" validate:"required"`
+		// Code is the application the link is sent for, its public url is used when set
+		Code string `json:"code" form:"code" query:"code"`
 	}
 
 	PasswordChangeRequest struct {
@@ -28,6 +40,8 @@ type (
 		ConfirmPassword string `json:"confirm_password" form:"confirm_password" validate:"required"`
 		Gender          string `json:"gender" form:"gender" validate:"required"`
 		Agreement       bool   `json:"agreement" form:"agreement" validate:"required"`
+		// Code is the application the user registers with, its public url is used for the verification link
+		Code string `json:"code" form:"code"`
 	}
 
 	UserVerificationRequest struct {
@@ -38,5 +52,107 @@ type (
 		Application string `json:"application" validate:"required"`
 		Domain      string `json:"domain" validate:"required"`
 		RedirectUrl string `json:"redirect_url" validate:"required,url"`
+		// RedirectUris are the other redirect uris, * matches a part of the host label or of the path segment
+		RedirectUris           []string `json:"redirect_uris" validate:"omitempty,max=20,dive,url,max=255"`
+		PostLogoutRedirectUris []string `json:"post_logout_redirect_uris" validate:"omitempty,max=20,dive,url,max=255"`
+		// PublicUrl is the base of the links sent to the users of the application
+		PublicUrl             string `json:"public_url" validate:"omitempty,url,max=255"`
+		FrontchannelLogoutUrl string `json:"frontchannel_logout_url" validate:"omitempty,url"`
+		BackchannelLogoutUrl  string `json:"backchannel_logout_url" validate:"omitempty,url"`
+	}
+
+	AuthorizeRequest struct {
+		ResponseType        string `query:"response_type" form:"response_type" validate:"required,eq=code"`
+		ClientId            string `query:"client_id" form:"client_id" validate:"required"`
+		RedirectUri         string `query:"redirect_uri" form:"redirect_uri" validate:"required,url"`
+		Scope               string `query:"scope" form:"scope"`
+		State               string `query:"state" form:"state"`
+		Nonce               string `query:"nonce" form:"nonce"`
+		Prompt              string `query:"prompt" form:"prompt" validate:"omitempty,oneof=login"`
+		CodeChallenge       string `query:"code_challenge" form:"code_challenge" validate:"required,min=43,max=128"`
+		CodeChallengeMethod string `query:"code_challenge_method" form:"code_challenge_method" validate:"required,eq=S256"`
+	}
+
+	AuthorizeLoginRequest struct {
+		AuthorizeRequest
+		Email    string `form:"email" validate:"required"`
+		Password string `form:"password" validate:"required"`
+	}
+
+	TokenRequest struct {
+		GrantType    string `json:"grant_type" form:"grant_type" validate:"required"`
+		ClientId     string `json:"client_id" form:"client_id" validate:"required"`
+		Code         string `json:"code" form:"code"`
+		RedirectUri  string `json:"redirect_uri" form:"redirect_uri"`
+		CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+		RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	}
+
+	RefreshTokenRequest struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+		Code         string `json:"code" validate:"required"`
+	}
+
+	MfaLoginRequest struct {
+		RedirectRequest
+		MfaToken     string `json:"mfa_token" form:"mfa_token" validate:"required"`
+		Otp          string `json:"otp" form:"otp" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+		RecoveryCode string `json:"recovery_code" form:"recovery_code" validate:"omitempty,max=20"`
+		Code         string `json:"code" form:"code" validate:"required"`
+	}
+
+	AuthorizeMfaRequest struct {
+		AuthorizeRequest
+		MfaToken     string `form:"mfa_token" validate:"required"`
+		Otp          string `form:"otp" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+		RecoveryCode string `form:"recovery_code" validate:"omitempty,max=20"`
+	}
+
+	OtpRequest struct {
+		Otp string `json:"otp" validate:"required,numeric,len=6"`
+	}
+
+	WebAuthnLoginBeginRequest struct {
+		Email    string `json:"email" validate:"omitempty,email"`
+		MfaToken string `json:"mfa_token"`
+	}
+
+	WebAuthnLoginFinishRequest struct {
+		RedirectRequest
+		Code     string `query:"code" validate:"required_without=ClientId"`
+		ClientId string `query:"client_id"`
+		MfaToken string `query:"mfa_token"`
+	}
+
+	WebAuthnTokenLoginRequest struct {
+		Code     string `query:"code" validate:"required"`
+		MfaToken string `query:"mfa_token"`
+	}
+
+	WebAuthnRegisterFinishRequest struct {
+		Name string `query:"name" validate:"max=100"`
+	}
+
+	WebAuthnCredentialDeleteRequest struct {
+		Id int64 `json:"id" validate:"required"`
+	}
+
+	SessionRevokeRequest struct {
+		Sid string `json:"sid" validate:"required"`
+	}
+
+	// AuditQueryRequest filters the audit log, From and To are unix times, To is exclusive.
+	AuditQueryRequest struct {
+		Action      string `query:"action" validate:"max=50"`
+		Outcome     string `query:"outcome" validate:"omitempty,oneof=success failure"`
+		ActorId     int64  `query:"actor_id" validate:"min=0"`
+		TargetId    int64  `query:"target_id" validate:"min=0"`
+		Subject     string `query:"subject" validate:"max=255"`
+		Application string `query:"application" validate:"max=50"`
+		Ip          string `query:"ip" validate:"omitempty,ip"`
+		From        int64  `query:"from" validate:"min=0"`
+		To          int64  `query:"to" validate:"min=0"`
+		Page        int    `query:"page" validate:"min=0"`
+		PerPage     int    `query:"per_page" validate:"min=0,max=500"`
 	}
 )
@@ -2,7 +2,24 @@ package types
 
 type (
 	UserTokenResponse struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		ExpiresIn    int64  `json:"expires_in,omitempty"`
+	}
+
+	MfaChallengeResponse struct {
+		MfaRequired bool   `json:"mfa_required"`
+		MfaToken    string `json:"mfa_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+
+	RecoveryCodesResponse struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	TotpEnrollResponse struct {
+		Secret     string `json:"secret"`
+		OtpauthUri string `json:"otpauth_uri"`
 	}
 
 	UserCreateResponse struct {
@@ -11,22 +28,128 @@ type (
 	}
 
 	UserInfoResponse struct {
-		Id       int64  `json:"id"`
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Gender   string `json:"gender"`
-		Data     string `json:"data"`
-		Created  int64  `json:"created"`
-		Updated  int64  `json:"updated"`
-		Active   bool   `json:"active"`
-		Locked   bool   `json:"locked"`
-		LockedTo int64  `json:"locked_to"`
+		Id         int64  `json:"id"`
+		Name       string `json:"name"`
+		Email      string `json:"email"`
+		Gender     string `json:"gender"`
+		Data       string `json:"data"`
+		Created    int64  `json:"created"`
+		Updated    int64  `json:"updated"`
+		Active     bool   `json:"active"`
+		Locked     bool   `json:"locked"`
+		LockedTo   int64  `json:"locked_to"`
+		MfaEnabled bool   `json:"mfa_enabled"`
 	}
 
 	ApplicationCreateResponse struct {
-		Application string `json:"application"`
-		Domain      string `json:"domain"`
+		Application            string   `json:"application"`
+		Domain                 string   `json:"domain"`
+		RedirectUrl            string   `json:"redirect_url"`
+		RedirectUris           []string `json:"redirect_uris,omitempty"`
+		PostLogoutRedirectUris []string `json:"post_logout_redirect_uris,omitempty"`
+		PublicUrl              string   `json:"public_url,omitempty"`
+		FrontchannelLogoutUrl  string   `json:"frontchannel_logout_url,omitempty"`
+		BackchannelLogoutUrl   string   `json:"backchannel_logout_url,omitempty"`
+		Code                   string   `json:"code"`
+	}
+
+	TokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		Scope        string `json:"scope,omitempty"`
+		IdToken      string `json:"id_token,omitempty"`
+	}
+
+	OAuthErrorResponse struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description,omitempty"`
+	}
+
+	OpenIdConfiguration struct {
+		Issuer                             string   `json:"issuer"`
+		AuthorizationEndpoint              string   `json:"authorization_endpoint"`
+		TokenEndpoint                      string   `json:"token_endpoint"`
+		UserInfoEndpoint                   string   `json:"userinfo_endpoint"`
+		JwksUri                            string   `json:"jwks_uri"`
+		ScopesSupported                    []string `json:"scopes_supported"`
+		ResponseTypesSupported             []string `json:"response_types_supported"`
+		GrantTypesSupported                []string `json:"grant_types_supported"`
+		SubjectTypesSupported              []string `json:"subject_types_supported"`
+		IdTokenSigningAlgValuesSupported   []string `json:"id_token_signing_alg_values_supported"`
+		TokenEndpointAuthMethodsSupported  []string `json:"token_endpoint_auth_methods_supported"`
+		CodeChallengeMethodsSupported      []string `json:"code_challenge_methods_supported"`
+		ClaimsSupported                    []string `json:"claims_supported"`
+		FrontchannelLogoutSupported        bool     `json:"frontchannel_logout_supported"`
+		FrontchannelLogoutSessionSupported bool     `json:"frontchannel_logout_session_supported"`
+		BackchannelLogoutSupported         bool     `json:"backchannel_logout_supported"`
+		BackchannelLogoutSessionSupported  bool     `json:"backchannel_logout_session_supported"`
+	}
+
+	OpenIdUserInfoResponse struct {
+		Sub           string `json:"sub"`
+		Name          string `json:"name,omitempty"`
+		Gender        string `json:"gender,omitempty"`
+		Email         string `json:"email,omitempty"`
+		EmailVerified *bool  `json:"email_verified,omitempty"`
+		UpdatedAt     int64  `json:"updated_at,omitempty"`
+	}
+
+	JSONWebKey struct {
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+
+	JSONWebKeySet struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+
+	WebAuthnCredentialResponse struct {
+		Id            int64    `json:"id"`
+		Name          string   `json:"name"`
+		Created       int64    `json:"created"`
+		LastUsed      int64    `json:"last_used"`
+		RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	}
+
+	WebAuthnLoginResponse struct {
 		RedirectUrl string `json:"redirect_url"`
-		Code        string `json:"code"`
+	}
+
+	SessionResponse struct {
+		Sid       string `json:"sid"`
+		ClientId  string `json:"client_id"`
+		Ip        string `json:"ip"`
+		UserAgent string `json:"user_agent"`
+		Created   int64  `json:"created"`
+		LastSeen  int64  `json:"last_seen"`
+		ExpiresAt int64  `json:"expires_at"`
+		Current   bool   `json:"current"`
+	}
+
+	AuditEntryResponse struct {
+		Id          int64  `json:"id"`
+		Action      string `json:"action"`
+		Outcome     string `json:"outcome"`
+		ActorId     int64  `json:"actor_id,omitempty"`
+		TargetId    int64  `json:"target_id,omitempty"`
+		Subject     string `json:"subject,omitempty"`
+		Application string `json:"application,omitempty"`
+		Ip          string `json:"ip"`
+		UserAgent   string `json:"user_agent"`
+		RequestId   string `json:"request_id"`
+		Detail      string `json:"detail,omitempty"`
+		Created     int64  `json:"created"`
+	}
+
+	AuditLogResponse struct {
+		Items   []AuditEntryResponse `json:"items"`
+		Total   int64                `json:"total"`
+		Page    int                  `json:"page"`
+		PerPage int                  `json:"per_page"`
 	}
 )
@@ -1,18 +1,92 @@
 package views
 
 import (
+	"github.com/MiG-21/go-sso/internal/web/types"
 	"github.com/gofiber/fiber/v2"
 )
 
-func LoginFormViewData(code string, errs ...error) fiber.Map {
+// CsrfLocalsKey is the key the csrf middleware stores the token of the request under, the form views put it
+// into the csrf_token hidden field.
+const CsrfLocalsKey = "csrf_token"
+
+func CsrfToken(ctx *fiber.Ctx) string {
+	token, _ := ctx.Locals(CsrfLocalsKey).(string)
+	return token
+}
+
+func LoginFormViewData(ctx *fiber.Ctx, code string, redirect types.RedirectRequest, errs ...error) fiber.Map {
+	return fiber.Map{
+		"Code":        code,
+		"RedirectUri": redirect.RedirectUri,
+		"State":       redirect.State,
+		"Errors":      errs,
+		"CsrfToken":   CsrfToken(ctx),
+	}
+}
+
+func PasswordRecoverFormViewData(ctx *fiber.Ctx, code string, errs ...error) fiber.Map {
 	return fiber.Map{
-		"Code":   code,
-		"Errors": errs,
+		"Code":      code,
+		"Errors":    errs,
+		"CsrfToken": CsrfToken(ctx),
 	}
 }
 
-func PasswordRecoverFormViewData(code string, errs ...error) fiber.Map {
-	return LoginFormViewData(code, errs...)
+func PasswordRecoverEmailFormViewData(ctx *fiber.Ctx, code string, errs ...error) fiber.Map {
+	return fiber.Map{
+		"Code":      code,
+		"Errors":    errs,
+		"CsrfToken": CsrfToken(ctx),
+	}
+}
+
+func AuthorizeFormViewData(ctx *fiber.Ctx, params *types.AuthorizeRequest, errs ...error) fiber.Map {
+	return fiber.Map{
+		"Request":   params,
+		"Errors":    errs,
+		"CsrfToken": CsrfToken(ctx),
+	}
+}
+
+func MfaFormViewData(ctx *fiber.Ctx, action, mfaToken string, fields map[string]string, errs ...error) fiber.Map {
+	return fiber.Map{
+		"Action":    action,
+		"MfaToken":  mfaToken,
+		"Fields":    fields,
+		"Errors":    errs,
+		"CsrfToken": CsrfToken(ctx),
+	}
+}
+
+func LoginMfaFormViewData(ctx *fiber.Ctx, code string, redirect types.RedirectRequest, mfaToken string, errs ...error) fiber.Map {
+	fields := map[string]string{
+		"code":         code,
+		"redirect_uri": redirect.RedirectUri,
+		"state":        redirect.State,
+	}
+	return MfaFormViewData(ctx, "/login/mfa", mfaToken, fields, errs...)
+}
+
+func AuthorizeMfaFormViewData(ctx *fiber.Ctx, params *types.AuthorizeRequest, mfaToken string, errs ...error) fiber.Map {
+	fields := map[string]string{
+		"response_type":         params.ResponseType,
+		"client_id":             params.ClientId,
+		"redirect_uri":          params.RedirectUri,
+		"scope":                 params.Scope,
+		"state":                 params.State,
+		"nonce":                 params.Nonce,
+		"prompt":                params.Prompt,
+		"code_challenge":        params.CodeChallenge,
+		"code_challenge_method": params.CodeChallengeMethod,
+	}
+	return MfaFormViewData(ctx, "/oauth/authorize/mfa", mfaToken, fields, errs...)
+}
+
+func LogoutViewData(frontchannelUrls []string, redirectUrl string) fiber.Map {
+	return fiber.Map{
+		"FrontchannelUrls": frontchannelUrls,
+		"RedirectUrl":      redirectUrl,
+	}
 }
 
 func ErrorViewData(code int, message string) fiber.Map {
@@ -0,0 +1,112 @@
+package web_test
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/MiG-21/go-sso/internal"
+	"github.com/MiG-21/go-sso/internal/dao"
+	"github.com/MiG-21/go-sso/internal/event"
+	"github.com/MiG-21/go-sso/internal/logout"
+	"github.com/MiG-21/go-sso/internal/models"
+	"github.com/MiG-21/go-sso/internal/passkey"
+	"github.com/MiG-21/go-sso/internal/ratelimit"
+	"github.com/MiG-21/go-sso/internal/web"
+	"github.com/gofiber/fiber/v2"
+	"github.com/ilyakaznacheev/cleanenv"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+)
+
+func TestWeb(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Web Suite")
+}
+
+// mailbox keeps the links the mail service would send, by the recipient
+type mailbox struct {
+	mu    sync.Mutex
+	links map[string]*url.URL
+}
+
+func (m *mailbox) receive(email string, link *url.URL) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.links[email] = link
+}
+
+func (m *mailbox) link(email string) func() *url.URL {
+	return func() *url.URL {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.links[email]
+	}
+}
+
+var (
+	app          *fiber.App
+	serverParams web.InitServerParams
+	config       *internal.Config
+	sso          models.SSOer
+	eventService *event.Service
+	mails        = &mailbox{links: map[string]*url.URL{}}
+)
+
+var _ = BeforeSuite(func() {
+	config = &internal.Config{AppName: "go-sso"}
+	Expect(cleanenv.ReadEnv(config)).To(Succeed())
+	config.Database.Driver = dao.DriverMemory
+	config.Frontend.Path = "../../web/"
+	config.Crypto.PrivateKeyPath = "../../test/key_pair/demo.rsa"
+	config.Crypto.PublicKeyPath = "../../test/key_pair/demo.rsa.pub"
+	config.Password.Hashing.Algorithm = internal.HashAlgorithmBcrypt
+	config.Password.Hashing.BcryptCost = 4
+	config.RateLimit.Enabled = false
+	Expect(internal.InitConfig(config)).To(Succeed())
+
+	logger := zerolog.Nop()
+	sr := dao.SetupDao(config)
+	Expect(sr.Error).NotTo(HaveOccurred())
+	sso = sr.SSOer
+
+	eventService = event.SetupEventService(&logger)
+	Expect(eventService.Listen()).To(Succeed())
+	eventService.AddListener(event.UserCreatedEvent, func(data interface{}) error {
+		e := data.(*event.UserCreated)
+		mails.receive(e.UserEmail, e.VerificationUrl)
+		return nil
+	})
+	eventService.AddListener(event.PasswordRecoverEvent, func(data interface{}) error {
+		e := data.(*event.UserPasswordRecover)
+		mails.receive(e.UserEmail, e.VerificationUrl)
+		return nil
+	})
+
+	ls := logout.SetupService(config, sso, eventService)
+	Expect(ls.Error).NotTo(HaveOccurred())
+
+	ps := passkey.SetupService(config, sso)
+	Expect(ps.Error).NotTo(HaveOccurred())
+
+	serverParams = web.InitServerParams{
+		Config:         config,
+		Logger:         &logger,
+		Validator:      internal.SetupValidator(),
+		Sso:            sso,
+		EventService:   eventService,
+		PasskeyService: ps.PasskeyService,
+		RateLimiter:    ratelimit.SetupLimiter(config).Limiter,
+	}
+	app = web.SetupServer(serverParams)
+})
+
+var _ = AfterSuite(func() {
+	if app != nil {
+		_ = app.Shutdown()
+	}
+	if eventService != nil {
+		_ = eventService.Shutdown()
+	}
+})
@@ -0,0 +1,79 @@
+// passkey sign in for the sso login, authorize and two-factor forms
+(function () {
+    function decode(value) {
+        var s = atob(value.replace(/-/g, '+').replace(/_/g, '/'));
+        return Uint8Array.from(s, function (c) { return c.charCodeAt(0); });
+    }
+
+    function encode(buffer) {
+        var s = String.fromCharCode.apply(null, new Uint8Array(buffer));
+        return btoa(s).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+
+    function post(url, body, csrfToken) {
+        return fetch(url, {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: {'Content-Type': 'application/json', 'X-Csrf-Token': csrfToken},
+            body: JSON.stringify(body)
+        }).then(function (response) {
+            if (!response.ok) {
+                return response.text().then(function (text) { throw new Error(text || response.statusText); });
+            }
+            return response.json();
+        });
+    }
+
+    function passkeyLogin(form) {
+        var error = document.getElementById('passkeyError');
+        error.classList.add('d-none');
+
+        var data = new FormData(form);
+        var csrfToken = data.get('csrf_token') || '';
+        var begin = {email: data.get('email') || '', mfa_token: data.get('mfa_token') || ''};
+        var query = new URLSearchParams();
+        data.forEach(function (value, key) {
+            if (key !== 'email' && key !== 'password' && key !== 'otp' && key !== 'recovery_code' && key !== 'csrf_token' && value !== '') {
+                query.append(key, value);
+            }
+        });
+
+        post('/login/webauthn/begin', begin, csrfToken).then(function (options) {
+            var publicKey = options.publicKey;
+            publicKey.challenge = decode(publicKey.challenge);
+            (publicKey.allowCredentials || []).forEach(function (c) { c.id = decode(c.id); });
+            return navigator.credentials.get({publicKey: publicKey});
+        }).then(function (credential) {
+            return post('/login/webauthn/finish?' + query.toString(), {
+                id: credential.id,
+                rawId: encode(credential.rawId),
+                type: credential.type,
+                response: {
+                    authenticatorData: encode(credential.response.authenticatorData),
+                    clientDataJSON: encode(credential.response.clientDataJSON),
+                    signature: encode(credential.response.signature),
+                    userHandle: credential.response.userHandle ? encode(credential.response.userHandle) : ''
+                }
+            }, csrfToken);
+        }).then(function (result) {
+            window.location.href = result.redirect_url;
+        }).catch(function (e) {
+            error.textContent = e.message;
+            error.classList.remove('d-none');
+        });
+    }
+
+    document.addEventListener('DOMContentLoaded', function () {
+        var button = document.getElementById('passkeyButton');
+        if (!button) {
+            return;
+        }
+        if (!window.PublicKeyCredential) {
+            button.classList.add('d-none');
+            return;
+        }
+        button.addEventListener('click', function () {
+            passkeyLogin(button.form);
+        });
+    });
+})();